@@ -1,19 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/prashanth1k/gingest"
 	"github.com/prashanth1k/gingest/internal/ingester"
-	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/tokenizer"
 	"github.com/prashanth1k/gingest/internal/utils"
 )
 
+// stdoutOutput is the --output value that writes the digest to stdout
+const stdoutOutput = "-"
+
+// defaultPruneAge is how long a mirror may go unused before cache prune removes it
+const defaultPruneAge = 30 * 24 * time.Hour
+
 // Version information - set during build with ldflags
 var (
 	Version   = "dev"     // Version number
@@ -26,6 +38,8 @@ func printUsage() {
 
 USAGE:
     gingest --source=<path|url> [OPTIONS]
+    gingest diff --base=<rev> [--head=<rev>] [--source=<path|url>] [OPTIONS]
+    gingest cache list|prune|clear [OPTIONS]
 
 EXAMPLES:
     # Basic usage with default exclusions
@@ -34,28 +48,144 @@ EXAMPLES:
     # Remote repository
     gingest --source=https://github.com/user/repo.git --output=repo.md
 
+    # One service of a monorepo, pasted from the browser
+    gingest --source=https://github.com/org/repo/tree/main/services/api
+
+    # Reproducible digest of a tag or a pinned commit
+    gingest --source=https://github.com/user/repo.git --ref=v1.4.0
+    gingest --source=https://github.com/user/repo.git --ref=3f2a9c1
+
+    # Digest an old release of a local repository without touching the working copy
+    gingest --source=. --rev=v1.2.0 --output=v1.2.0.md
+
+    # Add the last 20 commits and who last touched each file
+    gingest --source=. --history=20
+
+    # Review prompt: patches and post-change content of the files changed since main
+    gingest diff --base=main --head=HEAD --output=review.md
+
+    # Also include unchanged files that import or mention a changed file
+    gingest diff --source=https://github.com/user/repo.git --base=v1.3.0 --head=v1.4.0 --related
+
+    # Keep a mirror of the repository and only fetch new commits next time
+    gingest --source=https://github.com/user/repo.git --cache
+
+    # Structured output for retrieval pipelines
+    gingest --source=./project --format=json --output=digest.json
+    gingest --source=./project --format=jsonl --output=files.jsonl
+
+    # XML-tagged documents for long-context prompts
+    gingest --source=./project --format=xml --output=digest.xml
+
+    # Number every line so the model can cite lines or write patches
+    gingest --source=./project --line-numbers
+
+    # Save tokens: drop comments (keeping license headers) and blank lines
+    gingest --source=./project --strip-comments --keep-license --compact-whitespace
+
+    # Most frequently changed files first, and first to be kept under a budget
+    gingest --source=. --order=churn --max-tokens=100000
+
+    # Core packages first, then the rest in the usual order
+    gingest --source=./project --order-globs="src/core/**,*.go"
+
+    # Fit the digest into a 100k token context window, keeping src/ first
+    gingest --source=./project --max-tokens=100000 --priority-globs="src/*,*.go"
+
+    # Split a monorepo into chunks of at most 50k tokens (digest-001.md, ...)
+    gingest --source=./monorepo --split-tokens=50000
+
+    # Stream the digest to stdout for use in a pipeline
+    gingest --source=. --output=- | llm-cli
+
+    # Write files as they are read to keep memory flat on large repositories
+    gingest --source=./monorepo --stream --output=monorepo.md
+
     # Add custom exclusions to defaults
     gingest --source=./project --exclude="*.custom,temp-*,debug/"
 
+    # Leave out untracked scratch files, build output and local secrets
+    gingest --source=. --tracked-only
+
     # Include only specific file types (overrides all exclusions)
     gingest --source=./project --include="*.go,*.py,*.js"
 
     # Mixed: include specific types but exclude test files
     gingest --source=./project --include="*.go,*.py" --exclude="*_test.go,test_*"
 
+    # Recursive globs, alternatives and directory-only patterns
+    gingest --source=./project --include="src/**/*.{go,proto}" --exclude="**/testdata/**,generated/"
+
     # Disable all exclusions (process everything)
-    gingest --source=./project --exclude=""
+    gingest --source=./project --exclude="" --no-gitignore
 
     # Multiple directories and file patterns
     gingest --source=./project --exclude="logs/,cache/,*.tmp,*.backup"
 
 OPTIONS:
-    --source=<path|url>    Source path (local directory or Git URL) [REQUIRED]
-    --output=<file>        Output file path (default: digest.md)
+    --source=<path|url>    Source path (local directory, Git URL or repository web
+                           URL such as .../tree/main/services/api) [REQUIRED]
+    --output=<file>        Output file path, or - for stdout (default: digest.md)
+    --format=<name>        Output format: markdown, json, jsonl or xml (default: markdown)
+    --max-tokens=<n>       Token budget for the whole digest; files are kept in full,
+                           truncated or omitted to fit (default: 0 = unlimited)
+    --priority=<name>      Which files to keep first under --max-tokens: readme
+                           (the file order), smallest, shallowest or globs
+                           (default: readme)
+    --priority-globs=<p>   Comma-separated globs kept first, most important first
+    --order=<name>         File order: path (README first, then alphabetical), churn
+                           (most commits first), recent (last committed first),
+                           size (largest first), depth (shallowest first) or
+                           custom (--order-globs first) (default: path)
+    --order-globs=<p>      Comma-separated globs whose files come first with
+                           --order=custom, in glob order; implies --order=custom
+    --split-tokens=<n>     Split the digest into numbered chunks of at most n tokens
+    --split-bytes=<n>      Split the digest into numbered chunks of at most n bytes
     --branch=<name>        Target branch for Git repositories
+    --ref=<ref>            Branch, tag or full or short commit SHA to check out for
+                           Git repositories; the resolved commit goes in the summary
+    --rev=<rev>            Read a local Git repository at this tag, branch or commit
+                           from its object database instead of the working tree
+    --line-numbers         Prefix each line of file content with its line number in
+                           the file; notebook cells are numbered from 1 each
+    --strip-comments       Remove comments from Go, Python, JavaScript, TypeScript,
+                           Java, C, C++, Rust, shell and YAML files, leaving strings
+                           alone; the summary reports the bytes and tokens saved
+    --keep-license         Keep license and copyright headers; implies --strip-comments
+    --keep-doc-comments    Keep doc comments (Go declaration comments, /** */, Rust's
+                           /// and //!); implies --strip-comments
+    --compact-whitespace   Remove trailing whitespace and blank lines; runs of blank
+                           lines in Markdown and text collapse into one. With
+                           --line-numbers, lines keep their numbers in the file
+    --history=<n>          Add a History section with the last n commits that changed
+                           the digested files, and each file's last commit to its
+                           FILE: header (Git repositories only; default: 0 = none)
+    --base=<rev>           gingest diff: revision the changes are made against [REQUIRED]
+    --head=<rev>           gingest diff: revision holding the changes (default: HEAD)
+    --related              gingest diff: also include unchanged files that import or
+                           mention a changed file by name
+    --subdir=<path>        Only process this directory of the source, still
+                           honoring ignore files from the source root
+    --cache                Keep a mirror of remote repositories in the clone cache
+                           and fetch only new commits on later runs; see
+                           gingest cache --help
+    --cache-dir=<path>     Clone cache directory; implies --cache (default:
+                           gingest/repos in the user cache directory)
     --maxsize=<bytes>      Maximum file size in bytes (default: 2MB)
     --exclude=<patterns>   Comma-separated exclude patterns (adds to defaults)
     --include=<patterns>   Comma-separated include patterns (overrides excludes)
+    --workers=<n>          Maximum number of files read concurrently
+                           (default: 0 = twice the number of CPUs)
+    --stream               Write each file as soon as it is read instead of loading
+                           the whole repository first; statistics go at the end
+                           (markdown or jsonl, no --max-tokens, --history or
+                           splitting)
+    --no-progress          Don't show a progress bar (on a terminal) or periodic
+                           progress lines (otherwise)
+    --tracked-only         Only process files tracked by Git (git ls-files, including
+                           staged files); the summary counts skipped untracked files
+    --no-gitignore         Don't apply .gitignore files, .git/info/exclude or
+                           core.excludesFile
     --version              Show version information
     --help, -h             Show this help message
 
@@ -75,26 +205,99 @@ DESCRIPTION:
 
     Custom --exclude patterns are ADDED to defaults. Use --exclude="" to disable
     all exclusions. Include patterns override both default and custom exclusions.
+    Patterns support ** (any number of directories), {a,b} alternatives and a
+    trailing / for directory-only patterns.
+
+    The project's own .gitignore files are honored (including nested files,
+    ! negations, anchored / patterns and **), along with .git/info/exclude and
+    core.excludesFile for Git work trees. Use --no-gitignore to turn this off.
+
+    Per-project settings can be checked in as .gingestignore (extra exclusions)
+    and .gingestinclude (files to keep) in gitignore syntax, at the source root
+    or in any subdirectory. --include on the command line replaces .gingestinclude.
+
+    --order=churn and --order=recent read the commit log like --history. Files
+    that were never committed come last, and ties keep the path order. Under
+    --max-tokens, files are kept in the file order unless --priority says
+    otherwise, so the files ordered first survive truncation.
+
+    --history reads the commit log of the revision being digested. Remote
+    repositories are then cloned with their full history but without the
+    contents of old files, instead of only the checked out commit.
+
+    gingest diff digests only the files that changed between --base and --head
+    of a local repository (--source defaults to .) or a remote one. Each changed
+    file gets its unified diff followed by its full content at --head; renamed,
+    deleted and binary files are marked in the DIFF header and the tree, and the
+    summary counts files changed and lines added and removed. Neither revision is
+    checked out, and --include, --exclude and ignore files select the files.
 
 For more information, visit: https://github.com/prashanth1k/gingest
 `)
 }
 
+// exitOnError exits with a message for err. When the run was interrupted it
+// reports that instead and uses the conventional exit code 130.
+func exitOnError(ctx context.Context, message string, err error) {
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted: partial output and temporary files removed")
+		os.Exit(130)
+	}
+	log.Fatalf("%s: %v", message, err)
+}
+
 func main() {
 	// Define CLI flags
-	var sourcePath = flag.String("source", "", "Source path (local directory or Git URL)")
+	var sourcePath = flag.String("source", "", "Source path (local directory, Git URL or repository web URL)")
 	var outputFile = flag.String("output", "digest.md", "Output file path")
 	var targetBranch = flag.String("branch", "", "Target branch for Git repositories")
+	var subdir = flag.String("subdir", "", "Only process this directory of the source")
+	var rev = flag.String("rev", "", "Read a local Git repository at this revision instead of the working tree")
+	var ref = flag.String("ref", "", "Branch, tag or commit SHA to check out for Git repositories")
+	var useCache = flag.Bool("cache", false, "Keep mirrors of remote repositories in the clone cache")
+	var cacheDir = flag.String("cache-dir", "", "Clone cache directory (implies --cache)")
 	var maxFileSize = flag.Int64("maxsize", 2*1024*1024, "Maximum file size in bytes (default: 2MB)")
 	var excludePatterns = flag.String("exclude", "", "Comma-separated exclude patterns")
 	var includePatterns = flag.String("include", "", "Comma-separated include patterns")
+	var outputFormat = flag.String("format", "markdown", "Output format: markdown, json, jsonl or xml")
+	var maxTokens = flag.Int("max-tokens", 0, "Token budget for the whole digest (0 = unlimited)")
+	var budgetPriority = flag.String("priority", "", "Which files to keep first under --max-tokens: readme, smallest, shallowest or globs")
+	var priorityGlobs = flag.String("priority-globs", "", "Comma-separated glob patterns kept first under --max-tokens, most important first")
+	var fileOrder = flag.String("order", "", "File order: path, churn, recent, size, depth or custom")
+	var orderGlobs = flag.String("order-globs", "", "Comma-separated glob patterns whose files come first with --order=custom")
+	var splitTokens = flag.Int("split-tokens", 0, "Split the digest into numbered chunks of at most this many tokens (0 = no split)")
+	var splitBytes = flag.Int("split-bytes", 0, "Split the digest into numbered chunks of at most this many bytes (0 = no split)")
+	var lineNumbers = flag.Bool("line-numbers", false, "Prefix each line of file content with its line number")
+	var stripComments = flag.Bool("strip-comments", false, "Remove comments from source files in supported languages")
+	var keepLicense = flag.Bool("keep-license", false, "Keep license and copyright headers (implies --strip-comments)")
+	var keepDocComments = flag.Bool("keep-doc-comments", false, "Keep doc comments (implies --strip-comments)")
+	var compactWhitespace = flag.Bool("compact-whitespace", false, "Remove trailing whitespace and blank lines")
+	var history = flag.Int("history", 0, "Add the last n commits that changed the digested files and each file's last commit (0 = none)")
+	var trackedOnly = flag.Bool("tracked-only", false, "Only process files tracked by Git, including staged files")
+	var noGitignore = flag.Bool("no-gitignore", false, "Don't apply .gitignore files, .git/info/exclude or core.excludesFile")
+	var workers = flag.Int("workers", 0, "Maximum number of files read concurrently (0 = twice the number of CPUs)")
+	var noProgress = flag.Bool("no-progress", false, "Don't report progress while processing")
+	var stream = flag.Bool("stream", false, "Write each file as soon as it is read instead of loading the whole repository first")
 	var showVersion = flag.Bool("version", false, "Show version information")
+	var diffBase = flag.String("base", "", "gingest diff: revision the changes are made against")
+	var diffHead = flag.String("head", "", "gingest diff: revision holding the changes (default: HEAD)")
+	var diffRelated = flag.Bool("related", false, "gingest diff: also include unchanged files that reference a changed file")
 
 	// Set custom usage function
 	flag.Usage = printUsage
 
-	// Parse flags
-	flag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCache(os.Args[2:])
+		return
+	}
+
+	// Parse flags; gingest diff takes the same flags plus --base, --head and --related
+	diffMode := len(os.Args) > 1 && os.Args[1] == "diff"
+	if diffMode {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
 	// Handle version flag
 	if *showVersion {
@@ -105,6 +308,26 @@ func main() {
 		return
 	}
 
+	if diffMode {
+		if *diffBase == "" {
+			fmt.Fprintf(os.Stderr, "Error: gingest diff requires --base\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *targetBranch != "" || *ref != "" || *rev != "" || *stream || *history > 0 || *fileOrder != "" || *orderGlobs != "" || *maxTokens > 0 || *splitTokens > 0 || *splitBytes > 0 {
+			fmt.Fprintf(os.Stderr, "Error: gingest diff compares --base and --head; --branch, --ref, --rev, --stream, --history, --order, --max-tokens and splitting don't apply\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *sourcePath == "" {
+			*sourcePath = "."
+		}
+	} else if *diffBase != "" || *diffHead != "" || *diffRelated {
+		fmt.Fprintf(os.Stderr, "Error: --base, --head and --related apply to gingest diff\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	// Check if source is provided
 	if *sourcePath == "" {
 		fmt.Fprintf(os.Stderr, "Error: --source is required\n\n")
@@ -112,98 +335,365 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	format, err := ingester.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Repository web URLs name the clone URL, a ref and a directory; explicit
+	// --branch, --ref and --subdir flags win over the URL
+	if repoURL, ok := utils.ParseRepoURL(*sourcePath); ok {
+		*sourcePath = repoURL.CloneURL
+		if *ref == "" && *targetBranch == "" && !diffMode {
+			*ref = repoURL.Ref
+		}
+		if *subdir == "" {
+			*subdir = repoURL.Subpath
+		}
+	}
+
+	// Without --priority or --order the library picks the one implied by the globs
+	var priority gingest.Priority
+	if *budgetPriority != "" {
+		if priority, err = ingester.ParsePriority(*budgetPriority); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+	var order gingest.Order
+	if *fileOrder != "" {
+		if order, err = ingester.ParseOrder(*fileOrder); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	// Chunked digests are numbered Markdown files next to --output
+	split := *splitTokens > 0 || *splitBytes > 0
+	if split && (format != ingester.FormatMarkdown || *outputFile == stdoutOutput) {
+		fmt.Fprintf(os.Stderr, "Error: --split-tokens and --split-bytes require markdown output to a file\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *ref != "" && *targetBranch != "" {
+		fmt.Fprintf(os.Stderr, "Error: use either --branch or --ref, not both\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *rev != "" && utils.IsGitURL(*sourcePath) {
+		fmt.Fprintf(os.Stderr, "Error: --rev applies to local Git repositories; use --ref for remote ones\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Streamed digests are written before the total is known
+	if *stream && (!ingester.CanStream(format) || *maxTokens > 0 || *history > 0 || split) {
+		fmt.Fprintf(os.Stderr, "Error: --stream requires markdown or jsonl output without --max-tokens, --history or splitting\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// When the digest goes to stdout, progress messages go to stderr so pipelines stay clean
+	var logOut io.Writer = os.Stdout
+	if *outputFile == stdoutOutput {
+		logOut = os.Stderr
+	}
+
+	// Set up signal handling for graceful shutdown: the first signal cancels
+	// the run and cleans up, a second one falls back to the default behavior
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	// Print parsed values
-	fmt.Printf("Source Path: %s\n", *sourcePath)
-	fmt.Printf("Output File: %s\n", *outputFile)
-	fmt.Printf("Max File Size: %d bytes (%.1f MB)\n", *maxFileSize, float64(*maxFileSize)/(1024*1024))
+	fmt.Fprintf(logOut, "Source Path: %s\n", *sourcePath)
+	fmt.Fprintf(logOut, "Output File: %s\n", *outputFile)
+	fmt.Fprintf(logOut, "Output Format: %s\n", format)
+	fmt.Fprintf(logOut, "Max File Size: %d bytes (%.1f MB)\n", *maxFileSize, float64(*maxFileSize)/(1024*1024))
 	if *targetBranch != "" {
-		fmt.Printf("Target Branch: %s\n", *targetBranch)
+		fmt.Fprintf(logOut, "Target Branch: %s\n", *targetBranch)
+	}
+	if *ref != "" {
+		fmt.Fprintf(logOut, "Ref: %s\n", *ref)
+	}
+	if *rev != "" {
+		fmt.Fprintf(logOut, "Revision: %s\n", *rev)
+	}
+	if diffMode {
+		if *diffHead == "" {
+			*diffHead = "HEAD"
+		}
+		fmt.Fprintf(logOut, "Diff: %s..%s\n", *diffBase, *diffHead)
+	}
+	if *subdir != "" {
+		fmt.Fprintf(logOut, "Subdirectory: %s\n", *subdir)
 	}
 	if *excludePatterns != "" {
-		fmt.Printf("Exclude Patterns: %s\n", *excludePatterns)
+		fmt.Fprintf(logOut, "Exclude Patterns: %s\n", *excludePatterns)
 	}
 	if *includePatterns != "" {
-		fmt.Printf("Include Patterns: %s\n", *includePatterns)
+		fmt.Fprintf(logOut, "Include Patterns: %s\n", *includePatterns)
+	}
+	if *noGitignore {
+		fmt.Fprintln(logOut, "Gitignore: disabled")
+	}
+	if *trackedOnly {
+		fmt.Fprintln(logOut, "Files: tracked by Git only")
+	}
+	if *lineNumbers {
+		fmt.Fprintln(logOut, "Line Numbers: enabled")
+	}
+	if *stripComments || *keepLicense || *keepDocComments {
+		var kept []string
+		if *keepLicense {
+			kept = append(kept, "license headers")
+		}
+		if *keepDocComments {
+			kept = append(kept, "doc comments")
+		}
+		if len(kept) > 0 {
+			fmt.Fprintf(logOut, "Strip Comments: enabled (keeping %s)\n", strings.Join(kept, " and "))
+		} else {
+			fmt.Fprintln(logOut, "Strip Comments: enabled")
+		}
+	}
+	if *compactWhitespace {
+		fmt.Fprintln(logOut, "Compact Whitespace: enabled")
+	}
+	if *history > 0 {
+		fmt.Fprintf(logOut, "History: last %d commits\n", *history)
+	}
+	if order != "" && order != gingest.OrderPath {
+		fmt.Fprintf(logOut, "File Order: %s\n", order)
+	}
+
+	config := gingest.Config{
+		Source:            *sourcePath,
+		OutputFile:        *outputFile,
+		Format:            format,
+		TargetBranch:      *targetBranch,
+		Ref:               *ref,
+		Subdir:            *subdir,
+		Rev:               *rev,
+		TrackedOnly:       *trackedOnly,
+		Order:             order,
+		OrderGlobs:        utils.ParsePatterns(*orderGlobs),
+		LineNumbers:       *lineNumbers,
+		StripComments:     *stripComments,
+		KeepLicense:       *keepLicense,
+		KeepDocComments:   *keepDocComments,
+		CompactWhitespace: *compactWhitespace,
+		History:           *history,
+		MaxFileSize:       *maxFileSize,
+		IncludePatterns:   utils.ParsePatterns(*includePatterns),
+		ExcludePatterns:   utils.ParsePatterns(*excludePatterns),
+		NoGitignore:       *noGitignore,
+		MaxTokens:         *maxTokens,
+		Priority:          priority,
+		PriorityGlobs:     utils.ParsePatterns(*priorityGlobs),
+		SplitTokens:       *splitTokens,
+		SplitBytes:        *splitBytes,
+		Workers:           *workers,
+		Stream:            *stream,
+	}
+	if *outputFile == stdoutOutput {
+		config.Output = os.Stdout
+	}
+	if diffMode {
+		config.DiffBase = *diffBase
+		config.DiffHead = *diffHead
+		config.DiffRelated = *diffRelated
 	}
 
-	// Parse patterns
-	var excludeList []string
-	// Check if exclude flag was explicitly set
+	// Custom exclude patterns are added to the defaults; --exclude="" disables all exclusions
 	excludeFlag := flag.Lookup("exclude")
 	if excludeFlag != nil && excludeFlag.Value.String() != excludeFlag.DefValue {
-		// Flag was explicitly set
-		if *excludePatterns == "" {
-			// --exclude="" means disable all exclusions
-			excludeList = []string{}
-		} else {
-			// Add custom patterns to defaults
-			excludeList = utils.GetDefaultExcludePatterns()
-			customPatterns := utils.ParsePatterns(*excludePatterns)
-			excludeList = append(excludeList, customPatterns...)
-		}
-	} else {
-		// Flag was not set, use comprehensive default exclusions
-		excludeList = utils.GetDefaultExcludePatterns()
+		config.NoDefaultExcludes = *excludePatterns == ""
 	}
-	includeList := utils.ParsePatterns(*includePatterns)
 
-	var filesData []types.FileInfo
-	var stats types.Stats
-	var err error
+	if *useCache || *cacheDir != "" {
+		config.CacheDir = resolveCacheDir(*cacheDir)
+		fmt.Fprintf(logOut, "Clone Cache: %s\n", config.CacheDir)
+	}
 
-	// Check if source is a Git URL
-	if utils.IsGitURL(*sourcePath) {
-		// Check if git is available
-		if !utils.IsGitAvailable() {
-			log.Fatal("Error: git command not found. Please install Git to process remote repositories.")
-		}
+	// Progress is drawn as a bar on a terminal and as periodic lines otherwise
+	var renderer *progress.Renderer
+	if !*noProgress {
+		renderer = progress.NewRenderer(logOut, progress.IsTerminal(logOut))
+		config.Progress = renderer.Handle
+	}
 
-		fmt.Printf("Processing remote Git repository: %s\n", *sourcePath)
-		if *targetBranch != "" {
-			fmt.Printf("Cloning branch: %s\n", *targetBranch)
+	isRemote := utils.IsGitURL(*sourcePath)
+	switch {
+	case diffMode && isRemote:
+		fmt.Fprintf(logOut, "Diffing remote Git repository: %s\n", *sourcePath)
+	case diffMode:
+		fmt.Fprintf(logOut, "Diffing local repository: %s\n", *sourcePath)
+	case *stream && isRemote:
+		fmt.Fprintf(logOut, "Streaming remote Git repository: %s\n", *sourcePath)
+	case *stream:
+		fmt.Fprintf(logOut, "Streaming local directory: %s\n", *sourcePath)
+	case isRemote:
+		fmt.Fprintf(logOut, "Processing remote Git repository: %s\n", *sourcePath)
+		if *ref != "" {
+			fmt.Fprintf(logOut, "Fetching ref: %s\n", *ref)
+		} else if *targetBranch != "" {
+			fmt.Fprintf(logOut, "Cloning branch: %s\n", *targetBranch)
 		} else {
-			fmt.Println("Cloning default branch...")
+			fmt.Fprintln(logOut, "Cloning default branch...")
 		}
+	default:
+		fmt.Fprintf(logOut, "Processing local directory: %s\n", *sourcePath)
+		fmt.Fprintln(logOut, "Scanning files...")
+	}
+
+	result, err := gingest.ProcessAndWriteDigestWithResultContext(ctx, config)
+	renderer.Finish()
+	if err != nil {
+		exitOnError(ctx, "Error", err)
+	}
+	stats := result.Stats
+
+	switch {
+	case diffMode:
+		fmt.Fprintf(logOut, "Compared %s at %s with %s at %s: %d files changed.\n",
+			stats.Diff.Base, stats.Diff.BaseCommit, stats.Diff.Head, stats.Diff.HeadCommit, stats.Diff.FilesChanged)
+	case isRemote:
+		fmt.Fprintf(logOut, "Clone successful at commit %s.\n", stats.Commit)
+	case stats.Commit != "":
+		fmt.Fprintf(logOut, "Read revision %s at commit %s.\n", *rev, stats.Commit)
+	}
+	if *maxTokens > 0 {
+		fmt.Fprintf(logOut, "Token budget %d: %d files truncated, %d omitted\n", *maxTokens, stats.NumTruncatedFiles, stats.NumOmittedFiles)
+	}
 
-		_, filesData, stats, err = ingester.ProcessRemoteRepoWithPatterns(*sourcePath, *targetBranch, *maxFileSize, includeList, excludeList)
-		if err != nil {
-			log.Fatalf("Error processing remote repository: %v", err)
+	// Streamed digests don't keep the files around to list them
+	if !*stream {
+		fmt.Fprintf(logOut, "Found %d files:\n", len(result.Files))
+		for _, fileInfo := range result.Files {
+			if fileInfo.Error != nil {
+				fmt.Fprintf(logOut, "  %s (ERROR: %v)\n", fileInfo.RelativePath, fileInfo.Error)
+			} else if fileInfo.Change != nil {
+				fmt.Fprintf(logOut, "  %s (%s)\n", fileInfo.RelativePath, utils.FormatChange(fileInfo.Change))
+			} else if fileInfo.Omitted {
+				fmt.Fprintf(logOut, "  %s (omitted: over token budget)\n", fileInfo.RelativePath)
+			} else {
+				fmt.Fprintf(logOut, "  %s (%d bytes, %s)\n", fileInfo.RelativePath, len(fileInfo.Content), tokenizer.Format(fileInfo.Tokens))
+			}
 		}
-		fmt.Println("Clone successful.")
-	} else if info, err := os.Stat(*sourcePath); err == nil && info.IsDir() {
-		fmt.Printf("Processing local directory: %s\n", *sourcePath)
-		fmt.Println("Scanning files...")
-
-		filesData, stats, err = ingester.ProcessLocalDirectoryWithPatterns(*sourcePath, *maxFileSize, includeList, excludeList)
-		if err != nil {
-			log.Fatalf("Error processing directory: %v", err)
+	}
+
+	if len(result.Chunks) > 0 {
+		fmt.Fprintf(logOut, "Digest created in %d chunks:\n", len(result.Chunks))
+		for _, chunk := range result.Chunks {
+			fmt.Fprintf(logOut, "  %s\n", chunk)
 		}
+	} else if *outputFile == stdoutOutput {
+		fmt.Fprintln(logOut, "Digest written to stdout")
 	} else {
-		log.Fatal("Source must be a valid local directory or Git URL")
+		fmt.Fprintf(logOut, "Digest created: %s\n", *outputFile)
 	}
 
-	fmt.Printf("Found %d files:\n", len(filesData))
-	for _, fileInfo := range filesData {
-		if fileInfo.Error != nil {
-			fmt.Printf("  %s (ERROR: %v)\n", fileInfo.RelativePath, fileInfo.Error)
-		} else {
-			fmt.Printf("  %s (%d bytes)\n", fileInfo.RelativePath, len(fileInfo.Content))
-		}
+	// Print summary to stdout
+	fmt.Fprintln(logOut, "\n"+utils.GenerateSummaryString(stats))
+}
+
+func printCacheUsage() {
+	fmt.Fprintf(os.Stderr, `gingest cache - Manage the clone cache used with --cache
+
+USAGE:
+    gingest cache list  [--cache-dir=<path>]
+    gingest cache prune [--cache-dir=<path>] [--max-age=<duration>]
+    gingest cache clear [--cache-dir=<path>]
+
+COMMANDS:
+    list                   Show the cached mirrors, most recently used first
+    prune                  Remove mirrors not used within --max-age
+    clear                  Remove all mirrors
+
+OPTIONS:
+    --cache-dir=<path>     Cache directory (default: gingest/repos in the user
+                           cache directory)
+    --max-age=<duration>   Age for prune, such as 72h (default: 720h = 30 days)
+
+Mirrors in use by a running digest are never removed.
+`)
+}
+
+// resolveCacheDir returns cacheDir, or the default cache directory if it is empty
+func resolveCacheDir(cacheDir string) string {
+	if cacheDir != "" {
+		return cacheDir
 	}
+	dir, err := gingest.DefaultCacheDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v; pass --cache-dir\n", err)
+		os.Exit(1)
+	}
+	return dir
+}
+
+// runCache runs the cache subcommand with the arguments after "cache"
+func runCache(args []string) {
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	flags.Usage = printCacheUsage
+	var cacheDir = flags.String("cache-dir", "", "Cache directory")
+	var maxAge = flags.Duration("max-age", defaultPruneAge, "Remove mirrors not used for this long")
+
+	if len(args) == 0 {
+		printCacheUsage()
+		os.Exit(1)
+	}
+	command := args[0]
+	flags.Parse(args[1:])
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n\n", flags.Arg(0))
+		printCacheUsage()
+		os.Exit(1)
+	}
+	dir := resolveCacheDir(*cacheDir)
 
-	// Write digest to output file
-	fmt.Printf("Writing digest to %s...\n", *outputFile)
-	err = ingester.WriteDigest(*outputFile, filesData, stats)
+	var entries []gingest.CacheEntry
+	var err error
+	switch command {
+	case "list":
+		entries, err = gingest.ListCache(dir)
+	case "prune":
+		entries, err = gingest.PruneCache(dir, *maxAge)
+	case "clear":
+		entries, err = gingest.ClearCache(dir)
+	case "help", "-h", "--help":
+		printCacheUsage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown cache command %q\n\n", command)
+		printCacheUsage()
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Fatalf("Error writing digest: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("Digest created: %s\n", *outputFile)
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+		fmt.Printf("%-10s  %s  %s\n", progress.FormatBytes(entry.Size), entry.LastUsed.Format("2006-01-02 15:04"), entry.URL)
+	}
 
-	// Print summary to stdout
-	fmt.Println("\n" + utils.GenerateSummaryString(stats))
+	switch command {
+	case "list":
+		fmt.Printf("%d mirrors, %s in %s\n", len(entries), progress.FormatBytes(total), dir)
+	default:
+		fmt.Printf("Removed %d mirrors, %s\n", len(entries), progress.FormatBytes(total))
+	}
 }
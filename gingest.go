@@ -0,0 +1,505 @@
+// Package gingest converts local directories and remote Git repositories into
+// consolidated, LLM-friendly text digests.
+//
+// It is the supported public API on top of the internal ingester packages. The
+// gingest CLI maps its flags onto a Config and runs
+// ProcessAndWriteDigestWithResultContext, so both produce the same digests.
+package gingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/ingester"
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// DefaultOutputFile is the digest path used when Config.OutputFile is empty
+const DefaultOutputFile = "digest.md"
+
+// Format identifies an output format for digests
+type Format = ingester.Format
+
+// Supported digest output formats
+const (
+	FormatMarkdown = ingester.FormatMarkdown
+	FormatJSON     = ingester.FormatJSON
+	FormatJSONL    = ingester.FormatJSONL
+	FormatXML      = ingester.FormatXML
+)
+
+// TokenEstimator estimates the number of tokens in a piece of text
+type TokenEstimator = tokenizer.Estimator
+
+// TokenEstimatorFunc adapts an ordinary function to the TokenEstimator interface
+type TokenEstimatorFunc = tokenizer.EstimatorFunc
+
+// Priority decides which files are kept first when a digest must fit a token budget
+type Priority = ingester.Priority
+
+// Supported budget priorities
+const (
+	PriorityReadme     = ingester.PriorityReadme
+	PrioritySmallest   = ingester.PrioritySmallest
+	PriorityShallowest = ingester.PriorityShallowest
+	PriorityGlobs      = ingester.PriorityGlobs
+)
+
+// Order decides the order of the files in a digest
+type Order = ingester.Order
+
+// Supported file orders
+const (
+	OrderPath   = ingester.OrderPath
+	OrderChurn  = ingester.OrderChurn
+	OrderRecent = ingester.OrderRecent
+	OrderSize   = ingester.OrderSize
+	OrderDepth  = ingester.OrderDepth
+	OrderCustom = ingester.OrderCustom
+)
+
+// ProgressEvent is a progress update reported while a digest is built
+type ProgressEvent = progress.Event
+
+// ProgressKind identifies what a ProgressEvent reports
+type ProgressKind = progress.Kind
+
+// ProgressFunc receives progress events. Calls are never made concurrently,
+// but they come from the goroutines doing the work, so it should return quickly.
+type ProgressFunc = progress.Func
+
+// Progress event kinds
+const (
+	ProgressCloneProgress  = progress.KindCloneProgress
+	ProgressFileDiscovered = progress.KindFileDiscovered
+	ProgressFileRead       = progress.KindFileRead
+	ProgressFileSkipped    = progress.KindFileSkipped
+	ProgressBytesWritten   = progress.KindBytesWritten
+)
+
+// CacheEntry describes a cached repository mirror
+type CacheEntry = ingester.CacheEntry
+
+// FileInfo represents information about a processed file
+type FileInfo = types.FileInfo
+
+// FileChange describes how a file changed in a diff digest
+type FileChange = types.FileChange
+
+// DiffStats summarizes the changes in a diff digest
+type DiffStats = types.DiffStats
+
+// Change statuses of files in a diff digest
+const (
+	ChangeAdded    = types.ChangeAdded
+	ChangeModified = types.ChangeModified
+	ChangeDeleted  = types.ChangeDeleted
+	ChangeRenamed  = types.ChangeRenamed
+)
+
+// Commit describes a commit in the history section or the last commit of a file
+type Commit = types.Commit
+
+// Stats represents processing statistics
+type Stats = types.Stats
+
+// Config controls how a codebase is processed into a digest
+type Config struct {
+	Source            string         // Local directory path, Git repository URL or repository web URL (such as .../tree/main/dir)
+	OutputFile        string         // Output file path for the digest (default: digest.md)
+	Output            io.Writer      // Destination for the digest; overrides OutputFile when set
+	Format            Format         // Output format (default: FormatMarkdown)
+	TargetBranch      string         // Target branch for Git repositories (optional)
+	Ref               string         // Branch, tag or commit SHA to check out for Git repositories; can't be combined with TargetBranch
+	Subdir            string         // Only process this directory of the source (default: the directory in a web URL, else everything)
+	Rev               string         // Read a local Git repository at this revision instead of its working tree (optional)
+	TrackedOnly       bool           // Only process files tracked by Git, including staged ones; untracked files are counted in Stats
+	Order             Order          // Order of the files in the digest; a token budget keeps files in this order by default (default: OrderPath)
+	OrderGlobs        []string       // Glob patterns for OrderCustom, first in the digest first; imply OrderCustom when Order is empty
+	LineNumbers       bool           // Prefix each line of content with its line number in the file, numbering notebook cells separately
+	StripComments     bool           // Remove comments from Go, Python, JavaScript, TypeScript, Java, C, C++, Rust, shell and YAML files
+	KeepLicense       bool           // Keep license and copyright headers when stripping comments; implies StripComments
+	KeepDocComments   bool           // Keep doc comments, such as Go declaration comments and /** */ blocks, when stripping comments; implies StripComments
+	CompactWhitespace bool           // Remove trailing whitespace and blank lines; runs of blank lines in prose collapse into one
+	History           int            // Include the last N commits that changed the digested files and each file's last commit (0 = none)
+	DiffBase          string         // Digest only the files changed from this revision to DiffHead, with their patches (optional)
+	DiffHead          string         // Revision holding the changes for DiffBase (default: HEAD)
+	DiffRelated       bool           // With DiffBase, also include unchanged files that reference a changed file
+	MaxFileSize       int64          // Maximum file size in bytes (0 = no limit)
+	IncludePatterns   []string       // Glob patterns for files to include (overrides excludes)
+	ExcludePatterns   []string       // Glob patterns for files to exclude (added to defaults)
+	NoDefaultExcludes bool           // Disable the built-in default exclusions
+	NoGitignore       bool           // Disable .gitignore, .git/info/exclude and core.excludesFile
+	TokenEstimator    TokenEstimator // Token estimator for per-file counts (default: offline cl100k-style heuristic)
+	MaxTokens         int            // Token budget for the whole digest (0 = unlimited)
+	Priority          Priority       // Which files to keep first under MaxTokens (default: PriorityReadme)
+	PriorityGlobs     []string       // Glob patterns kept first with PriorityGlobs, most important first; imply PriorityGlobs when Priority is empty
+	SplitTokens       int            // Split the Markdown digest into numbered chunks of at most this many tokens (0 = no split)
+	SplitBytes        int            // Split the Markdown digest into numbered chunks of at most this many bytes (0 = no split)
+	Workers           int            // Maximum number of files read concurrently (0 = twice the number of CPUs)
+	Stream            bool           // Write files as they are read instead of loading them all first (Markdown and JSONL only, no History)
+	Progress          ProgressFunc   // Receives progress events for the clone, walk, reads and writes (optional)
+	CacheDir          string         // Reuse mirrors of remote repositories kept here, fetching only new commits (optional, see DefaultCacheDir)
+}
+
+// Result holds the processed files and statistics for a codebase
+type Result struct {
+	Files  []FileInfo
+	Stats  Stats
+	Chunks []string // Paths of the chunk files when the digest was split
+}
+
+// excludePatterns returns the effective exclude patterns for the config,
+// mirroring the CLI: custom patterns are added to the defaults.
+func (c Config) excludePatterns() []string {
+	var patterns []string
+	if !c.NoDefaultExcludes {
+		patterns = append(patterns, utils.GetDefaultExcludePatterns()...)
+	}
+	return append(patterns, c.ExcludePatterns...)
+}
+
+// ingesterConfig converts the public config into the ingester's config
+func (c Config) ingesterConfig() ingester.Config {
+	return ingester.Config{
+		MaxFileSize:       c.MaxFileSize,
+		IncludePatterns:   c.IncludePatterns,
+		ExcludePatterns:   c.excludePatterns(),
+		TokenEstimator:    c.TokenEstimator,
+		NoGitignore:       c.NoGitignore,
+		Workers:           c.Workers,
+		Progress:          c.Progress,
+		Ref:               c.Ref,
+		Subdir:            c.Subdir,
+		CacheDir:          c.CacheDir,
+		Rev:               c.Rev,
+		TrackedOnly:       c.TrackedOnly,
+		History:           c.History,
+		Order:             c.Order,
+		OrderGlobs:        c.OrderGlobs,
+		LineNumbers:       c.LineNumbers,
+		StripComments:     c.StripComments,
+		KeepLicense:       c.KeepLicense,
+		KeepDocComments:   c.KeepDocComments,
+		CompactWhitespace: c.CompactWhitespace,
+	}
+}
+
+// resolveSource splits a repository web URL in Source into the clone URL and
+// the ref and directory it names. An explicit Ref, TargetBranch or Subdir
+// takes precedence over the URL, and diff digests only take the directory.
+func (c Config) resolveSource() Config {
+	repoURL, ok := utils.ParseRepoURL(c.Source)
+	if !ok {
+		return c
+	}
+
+	c.Source = repoURL.CloneURL
+	if c.Ref == "" && c.TargetBranch == "" && c.DiffBase == "" {
+		c.Ref = repoURL.Ref
+	}
+	if c.Subdir == "" {
+		c.Subdir = repoURL.Subpath
+	}
+	return c
+}
+
+// withDefaults fills in the settings implied by other fields, mirroring the
+// CLI: OrderGlobs without an Order selects OrderCustom, PriorityGlobs
+// without a Priority selects PriorityGlobs, and KeepLicense or
+// KeepDocComments turns on StripComments.
+func (c Config) withDefaults() Config {
+	if c.Order == "" && len(c.OrderGlobs) > 0 {
+		c.Order = OrderCustom
+	}
+	if c.Priority == "" && len(c.PriorityGlobs) > 0 {
+		c.Priority = PriorityGlobs
+	}
+	if c.KeepLicense || c.KeepDocComments {
+		c.StripComments = true
+	}
+	return c
+}
+
+// diffOptions returns the revisions compared by a diff digest
+func (c Config) diffOptions() ingester.DiffOptions {
+	return ingester.DiffOptions{Base: c.DiffBase, Head: c.DiffHead, Related: c.DiffRelated}
+}
+
+// validate rejects settings that can't be combined. The buffered and the
+// streamed paths both run it on the resolved config, so they accept the same
+// configs.
+func (c Config) validate() error {
+	switch {
+	case c.Source == "":
+		return fmt.Errorf("source is required")
+	case c.Ref != "" && c.TargetBranch != "":
+		return fmt.Errorf("use either TargetBranch or Ref, not both")
+	case c.Rev != "" && utils.IsGitURL(c.Source):
+		return fmt.Errorf("rev applies to local Git repositories; use Ref for remote repositories")
+	case c.DiffBase == "" && (c.DiffHead != "" || c.DiffRelated):
+		return fmt.Errorf("DiffHead and DiffRelated require DiffBase")
+	case c.DiffBase != "" && (c.TargetBranch != "" || c.Ref != "" || c.Rev != "" || c.MaxTokens > 0 || c.History > 0 || (c.Order != "" && c.Order != OrderPath)):
+		return fmt.Errorf("diff digests compare DiffBase and DiffHead and can't be combined with a branch, ref, rev, history, file order or token budget")
+	case c.split() && (c.Output != nil || (c.Format != "" && c.Format != FormatMarkdown)):
+		return fmt.Errorf("split digests require Markdown output to a file")
+	case c.DiffBase != "" && c.split():
+		return fmt.Errorf("diff digests can't be split")
+	case c.Stream && !ingester.CanStream(c.Format):
+		return fmt.Errorf("streamed digests require Markdown or JSONL output")
+	case c.Stream && (c.MaxTokens > 0 || c.split()):
+		return fmt.Errorf("streamed digests can't be combined with a token budget or split output")
+	case c.Stream && (c.DiffBase != "" || c.History > 0):
+		return fmt.Errorf("streamed digests can't be combined with a diff or history")
+	}
+	return nil
+}
+
+// split reports whether the digest should be written as numbered chunks
+func (c Config) split() bool {
+	return c.SplitTokens > 0 || c.SplitBytes > 0
+}
+
+// outputFile returns the configured output path or the default
+func (c Config) outputFile() string {
+	if c.OutputFile == "" {
+		return DefaultOutputFile
+	}
+	return c.OutputFile
+}
+
+// Process ingests the configured source and returns the files and statistics
+func Process(config Config) (*Result, error) {
+	return ProcessContext(context.Background(), config)
+}
+
+// ProcessContext ingests the configured source and returns the files and
+// statistics. Cancelling ctx stops the clone, walk and reads promptly, removes
+// any temporary clone and returns ctx.Err().
+func ProcessContext(ctx context.Context, config Config) (*Result, error) {
+	config = config.resolveSource().withDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	ingesterConfig := config.ingesterConfig()
+
+	var filesData []types.FileInfo
+	var stats types.Stats
+	var err error
+
+	if utils.IsGitURL(config.Source) {
+		if !utils.IsGitAvailable() {
+			return nil, fmt.Errorf("git command not found: install Git to process remote repositories")
+		}
+		if config.DiffBase != "" {
+			filesData, stats, err = ingester.DiffRemoteRepoContext(ctx, config.Source, config.diffOptions(), ingesterConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff remote repository: %w", err)
+			}
+		} else {
+			_, filesData, stats, err = ingester.ProcessRemoteRepoContext(ctx, config.Source, config.TargetBranch, ingesterConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process remote repository: %w", err)
+			}
+		}
+	} else if config.DiffBase != "" {
+		filesData, stats, err = ingester.DiffLocalDirectoryContext(ctx, config.Source, config.diffOptions(), ingesterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff directory: %w", err)
+		}
+	} else {
+		info, statErr := os.Stat(config.Source)
+		if statErr != nil || !info.IsDir() {
+			return nil, fmt.Errorf("source must be a valid local directory or Git URL: %s", config.Source)
+		}
+		filesData, stats, err = ingester.ProcessLocalDirectoryContext(ctx, config.Source, ingesterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process directory: %w", err)
+		}
+	}
+
+	if config.MaxTokens > 0 {
+		filesData, stats = ingester.ApplyTokenBudget(filesData, stats, ingester.Budget{
+			MaxTokens:     config.MaxTokens,
+			Priority:      config.Priority,
+			PriorityGlobs: config.PriorityGlobs,
+			Format:        config.Format,
+			Estimator:     config.TokenEstimator,
+		})
+	}
+
+	return &Result{Files: filesData, Stats: stats}, nil
+}
+
+// ProcessCodebase ingests the configured source and returns the processed files
+func ProcessCodebase(config Config) ([]FileInfo, error) {
+	result, err := Process(config)
+	if err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// ProcessCodebaseWithStats ingests the configured source and returns files and statistics
+func ProcessCodebaseWithStats(config Config) ([]FileInfo, Stats, error) {
+	result, err := Process(config)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	return result.Files, result.Stats, nil
+}
+
+// WriteDigest writes the result as a Markdown digest to the given file path
+func (r *Result) WriteDigest(outputFilePath string) error {
+	return ingester.WriteDigest(outputFilePath, r.Files, r.Stats)
+}
+
+// WriteDigestTo writes the result as a Markdown digest to w
+func (r *Result) WriteDigestTo(w io.Writer) error {
+	return ingester.WriteDigestTo(w, r.Files, r.Stats)
+}
+
+// WriteDigestFormat writes the result as a digest in the given format to w
+func (r *Result) WriteDigestFormat(w io.Writer, format Format) error {
+	return ingester.WriteDigestFormat(w, format, r.Files, r.Stats)
+}
+
+// WriteChunkedDigest writes the result as numbered Markdown chunks next to
+// outputFilePath (digest-001.md, digest-002.md, ...) and returns their paths
+func (r *Result) WriteChunkedDigest(outputFilePath string, maxTokens, maxBytes int, estimator TokenEstimator) ([]string, error) {
+	return r.writeChunkedDigest(context.Background(), outputFilePath, maxTokens, maxBytes, estimator, nil)
+}
+
+// writeChunkedDigest writes the chunks, removing them again if ctx is cancelled
+func (r *Result) writeChunkedDigest(ctx context.Context, outputFilePath string, maxTokens, maxBytes int, estimator TokenEstimator, progressFunc ProgressFunc) ([]string, error) {
+	return ingester.WriteChunkedDigestContext(ctx, outputFilePath, r.Files, r.Stats, ingester.ChunkLimits{
+		MaxTokens: maxTokens,
+		MaxBytes:  maxBytes,
+		Estimator: estimator,
+		Progress:  progressFunc,
+	})
+}
+
+// ProcessAndWriteDigestWithResult ingests the configured source, writes the
+// digest to config.Output (or config.OutputFile) and returns the structured result.
+// With SplitTokens or SplitBytes set, numbered chunks are written next to
+// config.OutputFile instead and listed in Result.Chunks. With Stream set,
+// files are written as they are read and Result.Files is left empty.
+func ProcessAndWriteDigestWithResult(config Config) (*Result, error) {
+	return ProcessAndWriteDigestWithResultContext(context.Background(), config)
+}
+
+// ProcessAndWriteDigestWithResultContext is ProcessAndWriteDigestWithResult
+// with cancellation. A partially written output file is removed when ctx is
+// cancelled or writing fails.
+func ProcessAndWriteDigestWithResultContext(ctx context.Context, config Config) (*Result, error) {
+	config = config.resolveSource().withDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	// The walk, the read workers and the writer all report progress, so they
+	// share one lock to keep calls to config.Progress from overlapping
+	config.Progress = progress.Serialize(config.Progress)
+	if config.Stream {
+		return streamDigest(ctx, config)
+	}
+
+	result, err := ProcessContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := progress.NewCounter(config.Progress)
+	switch {
+	case config.split():
+		result.Chunks, err = result.writeChunkedDigest(ctx, config.outputFile(), config.SplitTokens, config.SplitBytes, config.TokenEstimator, config.Progress)
+	case config.Output != nil:
+		err = ingester.WriteDigestFormatContext(ctx, counter.Writer(config.Output), config.Format, result.Files, result.Stats)
+	default:
+		err = ingester.WriteFile(config.outputFile(), func(w io.Writer) error {
+			return ingester.WriteDigestFormatContext(ctx, counter.Writer(w), config.Format, result.Files, result.Stats)
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write digest: %w", err)
+	}
+
+	return result, nil
+}
+
+// streamDigest writes the digest while files are read, so only a bounded
+// number of files is held in memory. The result carries statistics only.
+// config has been resolved and validated.
+func streamDigest(ctx context.Context, config Config) (*Result, error) {
+	isRemote := utils.IsGitURL(config.Source)
+	if isRemote && !utils.IsGitAvailable() {
+		return nil, fmt.Errorf("git command not found: install Git to process remote repositories")
+	}
+	if !isRemote {
+		info, statErr := os.Stat(config.Source)
+		if statErr != nil || !info.IsDir() {
+			return nil, fmt.Errorf("source must be a valid local directory or Git URL: %s", config.Source)
+		}
+	}
+
+	var stats types.Stats
+	counter := progress.NewCounter(config.Progress)
+	write := func(w io.Writer) error {
+		var err error
+		w = counter.Writer(w)
+		if isRemote {
+			stats, err = ingester.StreamRemoteRepoContext(ctx, w, config.Format, config.Source, config.TargetBranch, config.ingesterConfig())
+		} else {
+			stats, err = ingester.StreamLocalDirectoryContext(ctx, w, config.Format, config.Source, config.ingesterConfig())
+		}
+		return err
+	}
+
+	var err error
+	if config.Output != nil {
+		err = write(config.Output)
+	} else {
+		err = ingester.WriteFile(config.outputFile(), write)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream digest: %w", err)
+	}
+
+	return &Result{Stats: stats}, nil
+}
+
+// ProcessAndWriteDigest ingests the configured source and writes the digest to
+// config.Output, or to config.OutputFile when no writer is set
+func ProcessAndWriteDigest(config Config) error {
+	_, err := ProcessAndWriteDigestWithResult(config)
+	return err
+}
+
+// DefaultCacheDir returns the default directory for Config.CacheDir, below
+// the user's cache directory
+func DefaultCacheDir() (string, error) {
+	return ingester.DefaultCacheDir()
+}
+
+// ListCache returns the repository mirrors in cacheDir, most recently used first
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	return ingester.ListCache(cacheDir)
+}
+
+// PruneCache removes the mirrors in cacheDir that haven't been used for
+// maxAge and returns them. Mirrors in use by a running digest are kept.
+func PruneCache(cacheDir string, maxAge time.Duration) ([]CacheEntry, error) {
+	return ingester.PruneCache(cacheDir, maxAge)
+}
+
+// ClearCache removes every mirror in cacheDir that isn't in use and returns them
+func ClearCache(cacheDir string) ([]CacheEntry, error) {
+	return ingester.ClearCache(cacheDir)
+}
@@ -0,0 +1,421 @@
+package gingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func createLibraryTestFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	files := map[string]string{
+		"README.md":        "# Library Test\n",
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"main_test.go":     "package main\n",
+		"debug.log":        "log line\n",
+		"subdir/nested.go": "package subdir\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func resultPaths(files []FileInfo) map[string]bool {
+	paths := make(map[string]bool)
+	for _, fileInfo := range files {
+		paths[fileInfo.RelativePath] = true
+	}
+	return paths
+}
+
+func TestProcess(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	result, err := Process(Config{Source: testDir})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	paths := resultPaths(result.Files)
+	for _, expected := range []string{"README.md", "main.go", "main_test.go", "subdir/nested.go"} {
+		if !paths[expected] {
+			t.Errorf("Expected %s in result", expected)
+		}
+	}
+
+	// *.log is part of the default exclusions
+	if paths["debug.log"] {
+		t.Error("debug.log should be excluded by default")
+	}
+
+	if result.Stats.NumFilesProcessed != 4 {
+		t.Errorf("Expected 4 processed files, got %d", result.Stats.NumFilesProcessed)
+	}
+
+	totalTokens := 0
+	for _, fileInfo := range result.Files {
+		if fileInfo.Tokens == 0 {
+			t.Errorf("Expected a token count for %s", fileInfo.RelativePath)
+		}
+		totalTokens += fileInfo.Tokens
+	}
+	if result.Stats.TotalTokens != totalTokens {
+		t.Errorf("Expected %d total tokens, got %d", totalTokens, result.Stats.TotalTokens)
+	}
+}
+
+func TestProcess_TokenEstimator(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	perFile := TokenEstimatorFunc(func(text string) int { return 10 })
+	result, err := Process(Config{Source: testDir, TokenEstimator: perFile})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if result.Stats.TotalTokens != 10*len(result.Files) {
+		t.Errorf("Expected custom estimator totals, got %d", result.Stats.TotalTokens)
+	}
+}
+
+func TestProcess_Patterns(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	files, err := ProcessCodebase(Config{
+		Source:          testDir,
+		IncludePatterns: []string{"*.go"},
+	})
+	if err != nil {
+		t.Fatalf("ProcessCodebase failed: %v", err)
+	}
+
+	paths := resultPaths(files)
+	if !paths["main.go"] || !paths["main_test.go"] {
+		t.Errorf("Expected Go files in result, got %v", paths)
+	}
+	if paths["README.md"] {
+		t.Error("README.md should not match include patterns")
+	}
+
+	files, _, err = ProcessCodebaseWithStats(Config{Source: testDir, NoDefaultExcludes: true})
+	if err != nil {
+		t.Fatalf("ProcessCodebaseWithStats failed: %v", err)
+	}
+	if !resultPaths(files)["debug.log"] {
+		t.Error("debug.log should be included when default exclusions are disabled")
+	}
+}
+
+func TestProcess_OrderGlobs(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	// OrderGlobs alone selects the custom order, as --order-globs does
+	result, err := Process(Config{Source: testDir, OrderGlobs: []string{"subdir/*"}})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for _, fileInfo := range result.Files {
+		if fileInfo.RelativePath == "subdir/nested.go" && fileInfo.Rank != 1 {
+			t.Errorf("Expected subdir/nested.go first, got rank %d", fileInfo.Rank)
+		}
+	}
+	if result.Stats.Order != string(OrderCustom) {
+		t.Errorf("Expected order %q, got %q", OrderCustom, result.Stats.Order)
+	}
+}
+
+func TestProcess_PriorityGlobs(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	// PriorityGlobs alone keeps matching files first, as --priority-globs does.
+	// The budget leaves room for the summary, tree and one small file.
+	result, err := Process(Config{Source: testDir, MaxTokens: 300, PriorityGlobs: []string{"subdir/*"}})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for _, fileInfo := range result.Files {
+		if expected := fileInfo.RelativePath != "subdir/nested.go"; fileInfo.Omitted != expected {
+			t.Errorf("Expected %s omitted to be %v, got %v", fileInfo.RelativePath, expected, fileInfo.Omitted)
+		}
+	}
+}
+
+func TestProcess_KeepDocComments(t *testing.T) {
+	testDir := t.TempDir()
+	content := "package main\n\n// Run is documented\nfunc Run() {\n\t// inside\n}\n"
+	if err := os.WriteFile(filepath.Join(testDir, "main.go"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create main.go: %v", err)
+	}
+
+	// KeepDocComments alone strips the other comments, as --keep-doc-comments does
+	files, err := ProcessCodebase(Config{Source: testDir, KeepDocComments: true})
+	if err != nil {
+		t.Fatalf("ProcessCodebase failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(files))
+	}
+	if expected := "package main\n\n// Run is documented\nfunc Run() {\n}\n"; files[0].Content != expected {
+		t.Errorf("Expected %q, got %q", expected, files[0].Content)
+	}
+}
+
+func TestProcess_InvalidSource(t *testing.T) {
+	if _, err := Process(Config{}); err == nil {
+		t.Error("Expected error for empty source")
+	}
+
+	if _, err := Process(Config{Source: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("Expected error for non-existent source")
+	}
+
+	for _, stream := range []bool{false, true} {
+		config := Config{Source: "https://github.com/user/repo.git", TargetBranch: "main", Ref: "v1.0", Stream: stream, Output: &bytes.Buffer{}}
+		if _, err := ProcessAndWriteDigestWithResult(config); err == nil || !strings.Contains(err.Error(), "not both") {
+			t.Errorf("Expected TargetBranch and Ref to be rejected together (stream %v), got %v", stream, err)
+		}
+	}
+
+	if _, err := Process(Config{Source: "https://github.com/user/repo.git", Rev: "v1.0"}); err == nil || !strings.Contains(err.Error(), "use Ref") {
+		t.Errorf("Expected Rev to be rejected for a remote repository, got %v", err)
+	}
+
+	if _, err := Process(Config{Source: t.TempDir(), DiffBase: "main", MaxTokens: 1000}); err == nil || !strings.Contains(err.Error(), "diff digests") {
+		t.Errorf("Expected a token budget to be rejected for a diff, got %v", err)
+	}
+
+	if _, err := Process(Config{Source: t.TempDir(), DiffBase: "main", Order: OrderChurn}); err == nil || !strings.Contains(err.Error(), "diff digests") {
+		t.Errorf("Expected a file order to be rejected for a diff, got %v", err)
+	}
+
+	if _, err := Process(Config{Source: t.TempDir(), DiffBase: "main", History: 5}); err == nil || !strings.Contains(err.Error(), "diff digests") {
+		t.Errorf("Expected history to be rejected for a diff, got %v", err)
+	}
+
+	if _, err := Process(Config{Source: t.TempDir(), DiffRelated: true}); err == nil || !strings.Contains(err.Error(), "require DiffBase") {
+		t.Errorf("Expected DiffRelated to be rejected without DiffBase, got %v", err)
+	}
+}
+
+func TestProcessAndWriteDigest(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+
+	err := ProcessAndWriteDigest(Config{Source: testDir, OutputFile: outputFile})
+	if err != nil {
+		t.Fatalf("ProcessAndWriteDigest failed: %v", err)
+	}
+
+	digest, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read digest: %v", err)
+	}
+
+	digestStr := string(digest)
+	if !strings.Contains(digestStr, "# Codebase Digest Summary") {
+		t.Error("Summary header not found in digest")
+	}
+	if !strings.Contains(digestStr, "FILE: subdir/nested.go") {
+		t.Error("Nested file not found in digest")
+	}
+}
+
+func TestProcessAndWriteDigest_Writer(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	var buf bytes.Buffer
+	result, err := ProcessAndWriteDigestWithResult(Config{Source: testDir, Output: &buf})
+	if err != nil {
+		t.Fatalf("ProcessAndWriteDigestWithResult failed: %v", err)
+	}
+
+	if len(result.Files) == 0 {
+		t.Error("Expected files in result")
+	}
+	if !strings.Contains(buf.String(), "FILE: README.md") {
+		t.Error("README.md not found in digest written to writer")
+	}
+
+	// Nothing should be written to the default output file when a writer is set
+	if _, err := os.Stat(DefaultOutputFile); err == nil {
+		t.Errorf("%s should not be created when Output is set", DefaultOutputFile)
+	}
+}
+
+func TestProcessAndWriteDigest_Split(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+
+	result, err := ProcessAndWriteDigestWithResult(Config{Source: testDir, OutputFile: outputFile, SplitBytes: 800})
+	if err != nil {
+		t.Fatalf("ProcessAndWriteDigestWithResult failed: %v", err)
+	}
+
+	if len(result.Chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %v", result.Chunks)
+	}
+	for _, chunk := range result.Chunks {
+		info, err := os.Stat(chunk)
+		if err != nil {
+			t.Fatalf("Chunk %s was not created: %v", chunk, err)
+		}
+		if info.Size() > 800 {
+			t.Errorf("Chunk %s is %d bytes, limit is 800", chunk, info.Size())
+		}
+	}
+	if _, err := os.Stat(outputFile); err == nil {
+		t.Error("Unsplit digest should not be written when splitting")
+	}
+
+	// Splitting only applies to Markdown files
+	if _, err := ProcessAndWriteDigestWithResult(Config{Source: testDir, Format: FormatJSON, SplitBytes: 800}); err == nil {
+		t.Error("Expected error when splitting a JSON digest")
+	}
+}
+
+func TestProcessAndWriteDigest_Stream(t *testing.T) {
+	testDir := t.TempDir()
+	createLibraryTestFiles(t, testDir)
+
+	var streamed, buffered bytes.Buffer
+	result, err := ProcessAndWriteDigestWithResult(Config{Source: testDir, Output: &streamed, Stream: true})
+	if err != nil {
+		t.Fatalf("ProcessAndWriteDigestWithResult failed: %v", err)
+	}
+	expected, err := ProcessAndWriteDigestWithResult(Config{Source: testDir, Output: &buffered})
+	if err != nil {
+		t.Fatalf("ProcessAndWriteDigestWithResult failed: %v", err)
+	}
+
+	if len(result.Files) != 0 {
+		t.Errorf("Expected no files in a streamed result, got %d", len(result.Files))
+	}
+	if result.Stats.NumFilesProcessed != expected.Stats.NumFilesProcessed || result.Stats.TotalTokens != expected.Stats.TotalTokens {
+		t.Errorf("Expected stats %+v, got %+v", expected.Stats, result.Stats)
+	}
+	if !strings.Contains(streamed.String(), "## Statistics") {
+		t.Error("Expected streamed digest to end with statistics")
+	}
+
+	// Streaming needs a format that can be written file by file
+	for _, config := range []Config{
+		{Source: testDir, Output: &streamed, Stream: true, Format: FormatJSON},
+		{Source: testDir, Output: &streamed, Stream: true, MaxTokens: 100},
+		{Source: testDir, Output: &streamed, Stream: true, DiffBase: "main"},
+		{Source: testDir, Output: &streamed, Stream: true, History: 5},
+	} {
+		if _, err := ProcessAndWriteDigestWithResult(config); err == nil {
+			t.Errorf("Expected error for streamed config %+v", config)
+		}
+	}
+}
+
+func TestProcessAndWriteDigest_StreamValidation(t *testing.T) {
+	testDir := t.TempDir()
+
+	// Streamed and buffered digests reject the same settings with the same error
+	for _, config := range []Config{
+		{Source: testDir, DiffHead: "HEAD"},
+		{Source: testDir, DiffRelated: true},
+		{Source: testDir, Order: OrderChurn, DiffBase: "main"},
+		{Source: "https://github.com/user/repo.git", Rev: "v1.0"},
+	} {
+		config.Output = io.Discard
+		_, bufferedErr := ProcessAndWriteDigestWithResult(config)
+		config.Stream = true
+		_, streamedErr := ProcessAndWriteDigestWithResult(config)
+		if bufferedErr == nil || streamedErr == nil || streamedErr.Error() != bufferedErr.Error() {
+			t.Errorf("Expected the same error for %+v, got %v and %v", config, bufferedErr, streamedErr)
+		}
+	}
+}
+
+func TestProcessAndWriteDigest_StreamProgress(t *testing.T) {
+	testDir := t.TempDir()
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(testDir, fmt.Sprintf("file%03d.go", i))
+		if err := os.WriteFile(path, []byte(strings.Repeat("package main\n", 50)), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	// Read events come from the workers while the writer reports bytes; the
+	// callback is unsynchronized, so run with -race to catch overlapping calls
+	var inFlight int32
+	var events int
+	config := Config{Source: testDir, Output: io.Discard, Stream: true, Workers: 8, Progress: func(event ProgressEvent) {
+		if atomic.AddInt32(&inFlight, 1) > 1 {
+			t.Errorf("Progress called concurrently for a %s event", event.Kind)
+		}
+		events++
+		runtime.Gosched()
+		atomic.AddInt32(&inFlight, -1)
+	}}
+	if _, err := ProcessAndWriteDigestWithResult(config); err != nil {
+		t.Fatalf("ProcessAndWriteDigestWithResult failed: %v", err)
+	}
+	if events == 0 {
+		t.Error("Expected progress events")
+	}
+}
+
+func TestConfig_ResolveSource(t *testing.T) {
+	testCases := []struct {
+		config   Config
+		expected Config
+		desc     string
+	}{
+		{
+			Config{Source: "https://github.com/org/repo/tree/main/services/api"},
+			Config{Source: "https://github.com/org/repo", Ref: "main", Subdir: "services/api"},
+			"Web URL fills ref and subdirectory",
+		},
+		{
+			Config{Source: "https://github.com/org/repo/tree/main/services/api", TargetBranch: "dev", Subdir: "lib"},
+			Config{Source: "https://github.com/org/repo", TargetBranch: "dev", Subdir: "lib"},
+			"Explicit settings win",
+		},
+		{
+			Config{Source: "https://github.com/org/repo/tree/main/services/api", DiffBase: "v1"},
+			Config{Source: "https://github.com/org/repo", Subdir: "services/api"},
+			"Diffs compare their own revisions",
+		},
+		{
+			Config{Source: "git@github.com:org/repo.git", Ref: "v1"},
+			Config{Source: "git@github.com:org/repo.git", Ref: "v1"},
+			"Clone URLs are left alone",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result := tc.config.resolveSource()
+			if result.Source != tc.expected.Source || result.Ref != tc.expected.Ref ||
+				result.TargetBranch != tc.expected.TargetBranch || result.Subdir != tc.expected.Subdir {
+				t.Errorf("Expected %+v, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+// Package ignore implements .gitignore pattern matching for directory walks
+package ignore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// Names of the per-directory files read by the walker
+const (
+	GitignoreFile      = ".gitignore"      // Git's ignore file
+	GingestIgnoreFile  = ".gingestignore"  // Project-level exclusions for digests, in gitignore syntax
+	GingestIncludeFile = ".gingestinclude" // Project-level include list for digests, in gitignore syntax
+)
+
+// GlobalExcludesFile is the name Files reports the user's core.excludesFile as
+const GlobalExcludesFile = "core.excludesFile"
+
+// pattern is a single parsed line of an ignore file
+type pattern struct {
+	base     string // Directory of the ignore file relative to the root ("" for the root)
+	glob     string // Glob matched with utils.MatchDoublestar
+	negate   bool   // Pattern started with "!" and re-includes matches
+	dirOnly  bool   // Pattern ended with "/" and only matches directories
+	anchored bool   // Pattern contains a "/" and matches relative to base
+	above    string // Path of the root relative to an ignore file above it ("" for files at or below the root)
+}
+
+// Matcher holds ignore patterns in precedence order: later patterns win.
+// Paths are slash-separated and relative to the walk root.
+type Matcher struct {
+	patterns []pattern
+	files    []string // Ignore files that were read, in the order they were added
+}
+
+// New returns an empty Matcher
+func New() *Matcher {
+	return &Matcher{}
+}
+
+// AddPatterns adds gitignore-style lines that apply to paths below base,
+// a slash-separated directory relative to the root ("" for the root)
+func (m *Matcher) AddPatterns(base string, lines []string) {
+	m.addPatterns(base, "", lines)
+}
+
+// addPatterns adds gitignore-style lines below base. Lines of an ignore file
+// in a directory above the root match paths prefixed with above, the path of
+// the root relative to that directory.
+func (m *Matcher) addPatterns(base, above string, lines []string) {
+	for _, line := range lines {
+		if p, ok := parsePattern(base, line); ok {
+			p.above = above
+			m.patterns = append(m.patterns, p)
+		}
+	}
+}
+
+// AddFile reads an ignore file and adds its patterns below base. It reports
+// whether the file existed; a missing file is not an error.
+func (m *Matcher) AddFile(filePath, base string) (bool, error) {
+	return m.addFile(filePath, base, "", func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	})
+}
+
+// AddFileFS reads the ignore file name from fsys like AddFile. Files reports
+// it as filePath, which places it for the caller.
+func (m *Matcher) AddFileFS(fsys fs.FS, name, filePath, base string) (bool, error) {
+	return m.addFile(filePath, base, "", func() (io.ReadCloser, error) {
+		return fsys.Open(name)
+	})
+}
+
+// addFile reads the ignore file returned by open and adds its patterns like addPatterns
+func (m *Matcher) addFile(filePath, base, above string, open func() (io.ReadCloser, error)) (bool, error) {
+	file, err := open()
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read ignore file %s: %w", filePath, err)
+	}
+
+	m.addPatterns(base, above, lines)
+	m.files = append(m.files, filePath)
+	return true, nil
+}
+
+// Files returns the paths of the ignore files that were read, in order. The
+// user's core.excludesFile is reported as GlobalExcludesFile.
+func (m *Matcher) Files() []string {
+	return m.files
+}
+
+// AddGitExcludes adds the user's core.excludesFile and the repository's
+// info/exclude when root is in a Git work tree, including linked worktrees
+// and submodules. When root is below the top level of the work tree, the
+// .gitignore files of the directories above it are added too. They all have
+// lower precedence than the .gitignore files in root and below, so call it
+// before adding any of those.
+func (m *Matcher) AddGitExcludes(ctx context.Context, root string) error {
+	tree, err := findWorkTree(ctx, root)
+	if err != nil || tree == nil {
+		return err
+	}
+
+	if excludesFile := globalExcludesFile(ctx, root); excludesFile != "" {
+		open := func() (io.ReadCloser, error) { return os.Open(excludesFile) }
+		if _, err := m.addFile(GlobalExcludesFile, "", tree.prefix, open); err != nil {
+			return err
+		}
+	}
+	if err := m.addFileAbove(filepath.Join(tree.gitDir, "info", "exclude"), tree.prefix); err != nil {
+		return err
+	}
+
+	// Parent .gitignore files, from the top level down to root's parent
+	dir, prefix := tree.topLevel, tree.prefix
+	for prefix != "" {
+		if err := m.addFileAbove(filepath.Join(dir, GitignoreFile), prefix); err != nil {
+			return err
+		}
+		segment, rest, _ := strings.Cut(prefix, "/")
+		dir, prefix = filepath.Join(dir, segment), rest
+	}
+	return nil
+}
+
+// addFileAbove adds the ignore file at filePath, whose directory root is at
+// prefix below
+func (m *Matcher) addFileAbove(filePath, prefix string) error {
+	_, err := m.addFile(filePath, "", prefix, func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	})
+	return err
+}
+
+// workTree locates a directory within a Git work tree
+type workTree struct {
+	topLevel string // Top level of the work tree
+	prefix   string // Slash-separated path of the directory below topLevel ("" at the top level)
+	gitDir   string // Git directory holding info/exclude
+}
+
+// findWorkTree returns the work tree containing root, or nil if there is
+// none. Paths are kept relative to root as given rather than resolved like
+// --show-toplevel does, so symbolic links in root don't move the top level.
+// Without a usable git only root/.git is looked at.
+func findWorkTree(ctx context.Context, root string) (*workTree, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", root, "rev-parse", "--is-inside-work-tree", "--show-cdup", "--show-prefix", "--git-common-dir").Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		gitDir, err := commonGitDir(root)
+		if err != nil || gitDir == "" {
+			return nil, err
+		}
+		return &workTree{topLevel: root, gitDir: gitDir}, nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "true" {
+		return nil, nil
+	}
+	gitDir := lines[3]
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	return &workTree{
+		topLevel: filepath.Join(root, lines[1]),
+		prefix:   strings.TrimSuffix(lines[2], "/"),
+		gitDir:   gitDir,
+	}, nil
+}
+
+// commonGitDir returns the Git directory holding info/exclude for the work
+// tree at root, or "" if root isn't one. Linked worktrees and submodules have
+// a .git file pointing at their Git directory with "gitdir: <path>", and a
+// linked worktree's Git directory names the shared one in its commondir file.
+func commonGitDir(root string) (string, error) {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", nil
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+
+	gitDir, err := readGitPath(dotGit, root, "gitdir:")
+	if err != nil || gitDir == "" {
+		return "", err
+	}
+	commonDir, err := readGitPath(filepath.Join(gitDir, "commondir"), gitDir, "")
+	if err != nil {
+		return "", err
+	}
+	if commonDir != "" {
+		return commonDir, nil
+	}
+	return gitDir, nil
+}
+
+// readGitPath reads a path from a Git pointer file after prefix, resolving
+// it against dir when relative. A missing file or prefix gives "".
+func readGitPath(filePath, dir, prefix string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, prefix) {
+		return "", nil
+	}
+	target := strings.TrimSpace(strings.TrimPrefix(line, prefix))
+	if target == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, nil
+}
+
+// globalExcludesFile returns the path of core.excludesFile, falling back to
+// Git's default of $XDG_CONFIG_HOME/git/ignore
+func globalExcludesFile(ctx context.Context, root string) string {
+	out, err := exec.CommandContext(ctx, "git", "-C", root, "config", "--path", "--get", "core.excludesFile").Output()
+	if err == nil {
+		if excludesFile := strings.TrimSpace(string(out)); excludesFile != "" {
+			return excludesFile
+		}
+	}
+
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// Match reports whether relPath itself is ignored. The last matching pattern
+// decides, so "!" patterns can re-include earlier matches. Callers walking a
+// tree are expected to skip ignored directories, as Git never looks inside them.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].matches(relPath, isDir) {
+			return !m.patterns[i].negate
+		}
+	}
+	return false
+}
+
+// MatchWithParents is like Match, but patterns matching a parent directory
+// also count, so a directory pattern selects everything inside it. This suits
+// include lists, where a later "!" pattern can still drop a single file.
+func (m *Matcher) MatchWithParents(relPath string, isDir bool) bool {
+	parts := strings.Split(relPath, "/")
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].matches(relPath, isDir) {
+			return !m.patterns[i].negate
+		}
+		for j := 1; j < len(parts); j++ {
+			if m.patterns[i].matches(strings.Join(parts[:j], "/"), true) {
+				return !m.patterns[i].negate
+			}
+		}
+	}
+	return false
+}
+
+// Applies reports whether any pattern was added for relPath's directory or
+// one of its parents
+func (m *Matcher) Applies(relPath string) bool {
+	for _, p := range m.patterns {
+		if p.base == "" || strings.HasPrefix(relPath, p.base+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePattern parses a single ignore file line, returning false for blank
+// lines and comments
+func parsePattern(base, line string) (pattern, bool) {
+	line = trimTrailingSpaces(strings.TrimSuffix(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.HasPrefix(line, "/") {
+		p.anchored = true
+		line = line[1:]
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+	}
+
+	// Git spells negated character classes [!...], path.Match spells them [^...]
+	p.glob = strings.ReplaceAll(line, "[!", "[^")
+
+	return p, true
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped with a backslash
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// matches reports whether the pattern matches relPath
+func (p pattern) matches(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.above != "" {
+		relPath = p.above + "/" + relPath
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relPath, p.base+"/") {
+			return false
+		}
+		relPath = relPath[len(p.base)+1:]
+	}
+
+	// Patterns without a slash match a name at any depth
+	if !p.anchored {
+		return utils.MatchDoublestar(p.glob, path.Base(relPath))
+	}
+	return utils.MatchDoublestar(p.glob, relPath)
+}
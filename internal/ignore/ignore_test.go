@@ -0,0 +1,318 @@
+package ignore
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		expected bool
+		desc     string
+	}{
+		{[]string{"*.log"}, "debug.log", false, true, "Basename glob at root"},
+		{[]string{"*.log"}, "logs/deep/debug.log", false, true, "Basename glob at any depth"},
+		{[]string{"*.log", "!keep.log"}, "logs/keep.log", false, false, "Negation re-includes"},
+		{[]string{"!keep.log", "*.log"}, "keep.log", false, true, "Later pattern wins"},
+		{[]string{"/build"}, "build", true, true, "Anchored pattern at root"},
+		{[]string{"/build"}, "src/build", true, false, "Anchored pattern not nested"},
+		{[]string{"build/"}, "build", false, false, "Directory pattern skips files"},
+		{[]string{"build/"}, "src/build", true, true, "Directory pattern at any depth"},
+		{[]string{"docs/*.md"}, "docs/guide.md", false, true, "Pattern with slash is anchored"},
+		{[]string{"docs/*.md"}, "src/docs/guide.md", false, false, "Pattern with slash is not nested"},
+		{[]string{"docs/*.md"}, "docs/api/guide.md", false, false, "Single star does not cross directories"},
+		{[]string{"**/testdata"}, "a/b/testdata", true, true, "Leading double star"},
+		{[]string{"**/testdata"}, "testdata", true, true, "Leading double star matches root"},
+		{[]string{"src/**/*.gen.go"}, "src/a/b/x.gen.go", false, true, "Middle double star"},
+		{[]string{"src/**/*.gen.go"}, "src/x.gen.go", false, true, "Middle double star matches zero directories"},
+		{[]string{"out/**"}, "out/a/b.txt", false, true, "Trailing double star matches contents"},
+		{[]string{"out/**"}, "out", true, false, "Trailing double star does not match the directory"},
+		{[]string{"# comment", "", "\\#file"}, "#file", false, true, "Comments, blank lines and escaped hash"},
+		{[]string{"\\!important"}, "!important", false, true, "Escaped exclamation mark"},
+		{[]string{"trailing   "}, "trailing", false, true, "Trailing spaces are trimmed"},
+		{[]string{"file[!0-9].txt"}, "filea.txt", false, true, "Negated character class"},
+		{[]string{"file[!0-9].txt"}, "file1.txt", false, false, "Negated character class excludes"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			matcher := New()
+			matcher.AddPatterns("", tc.patterns)
+			if result := matcher.Match(tc.path, tc.isDir); result != tc.expected {
+				t.Errorf("Match(%q) with %q: expected %v, got %v", tc.path, tc.patterns, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestMatch_NestedBase(t *testing.T) {
+	matcher := New()
+	matcher.AddPatterns("", []string{"*.tmp"})
+	matcher.AddPatterns("pkg", []string{"/generated", "!keep.tmp"})
+
+	testCases := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"pkg/generated", true, true},
+		{"generated", true, false},
+		{"other/generated", true, false},
+		{"pkg/keep.tmp", false, false},
+		{"keep.tmp", false, true},
+		{"pkg/sub/keep.tmp", false, false},
+	}
+
+	for _, tc := range testCases {
+		if result := matcher.Match(tc.path, tc.isDir); result != tc.expected {
+			t.Errorf("Match(%q): expected %v, got %v", tc.path, tc.expected, result)
+		}
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	tempDir := t.TempDir()
+	ignoreFile := filepath.Join(tempDir, GitignoreFile)
+	if err := os.WriteFile(ignoreFile, []byte("*.log\r\n!keep.log\n"), 0644); err != nil {
+		t.Fatalf("Failed to create ignore file: %v", err)
+	}
+
+	matcher := New()
+	found, err := matcher.AddFile(ignoreFile, "")
+	if err != nil || !found {
+		t.Fatalf("AddFile failed: found=%v err=%v", found, err)
+	}
+	if !matcher.Match("debug.log", false) || matcher.Match("keep.log", false) {
+		t.Error("Patterns from file were not applied")
+	}
+
+	found, err = matcher.AddFile(filepath.Join(tempDir, "missing"), "")
+	if err != nil || found {
+		t.Errorf("Expected missing file to be skipped, got found=%v err=%v", found, err)
+	}
+}
+
+func TestAddFileFS(t *testing.T) {
+	fsys := fstest.MapFS{"pkg/.gitignore": {Data: []byte("*.tmp\n")}}
+
+	matcher := New()
+	found, err := matcher.AddFileFS(fsys, "pkg/.gitignore", "/repo/pkg/.gitignore", "pkg")
+	if err != nil || !found {
+		t.Fatalf("AddFileFS failed: found=%v err=%v", found, err)
+	}
+	if !matcher.Match("pkg/a.tmp", false) || matcher.Match("a.tmp", false) {
+		t.Error("Patterns from file were not applied below their base")
+	}
+	if files := matcher.Files(); len(files) != 1 || files[0] != "/repo/pkg/.gitignore" {
+		t.Errorf("Expected the file path to be recorded, got %v", files)
+	}
+
+	found, err = matcher.AddFileFS(fsys, "missing/.gitignore", "/repo/missing/.gitignore", "missing")
+	if err != nil || found {
+		t.Errorf("Expected missing file to be skipped, got found=%v err=%v", found, err)
+	}
+}
+
+func TestAddGitExcludes(t *testing.T) {
+	tempDir := t.TempDir()
+	configHome := t.TempDir()
+
+	// Isolate from the user's Git configuration
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(configHome, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	files := map[string]string{
+		filepath.Join(tempDir, ".git", "info", "exclude"): "local.txt\n",
+		filepath.Join(configHome, "git", "ignore"):        "*.swp\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	matcher := New()
+	if err := matcher.AddGitExcludes(context.Background(), tempDir); err != nil {
+		t.Fatalf("AddGitExcludes failed: %v", err)
+	}
+	if !matcher.Match("local.txt", false) {
+		t.Error("Expected .git/info/exclude to be applied")
+	}
+	if !matcher.Match("src/main.go.swp", false) {
+		t.Error("Expected global excludes file to be applied")
+	}
+
+	// Directories that are not Git work trees get no Git excludes
+	matcher = New()
+	if err := matcher.AddGitExcludes(context.Background(), t.TempDir()); err != nil {
+		t.Fatalf("AddGitExcludes failed: %v", err)
+	}
+	if matcher.Match("main.go.swp", false) {
+		t.Error("Expected no excludes outside a Git work tree")
+	}
+}
+
+func TestAddGitExcludes_GitFile(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(configHome, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	// A submodule points at its own Git directory, and a linked worktree at
+	// one whose commondir names the main repository's
+	repo := t.TempDir()
+	submodule := filepath.Join(repo, "lib")
+	worktree := t.TempDir()
+	files := map[string]string{
+		filepath.Join(repo, ".git", "info", "exclude"):                   "main.txt\n",
+		filepath.Join(repo, ".git", "modules", "lib", "info", "exclude"): "submodule.txt\n",
+		filepath.Join(submodule, ".git"):                                 "gitdir: ../.git/modules/lib\n",
+		filepath.Join(repo, ".git", "worktrees", "feature", "commondir"): "../..\n",
+		filepath.Join(worktree, ".git"):                                  "gitdir: " + filepath.Join(repo, ".git", "worktrees", "feature") + "\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	testCases := []struct {
+		root     string
+		excluded string
+		desc     string
+	}{
+		{submodule, "submodule.txt", "Submodule"},
+		{worktree, "main.txt", "Linked worktree"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			matcher := New()
+			if err := matcher.AddGitExcludes(context.Background(), tc.root); err != nil {
+				t.Fatalf("AddGitExcludes failed: %v", err)
+			}
+			if !matcher.Match(tc.excluded, false) {
+				t.Errorf("Expected %s to be excluded by the info/exclude of the Git directory", tc.excluded)
+			}
+		})
+	}
+}
+
+func TestAddGitExcludes_Subdirectory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	configHome := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(configHome, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, output)
+	}
+	root := filepath.Join(repo, "web", "app")
+	files := map[string]string{
+		filepath.Join(repo, ".git", "info", "exclude"): "/web/app/local.txt\n",
+		filepath.Join(repo, ".gitignore"):              "*.log\n/build/\n/web/app/dist/\n",
+		filepath.Join(repo, "web", ".gitignore"):       "generated/\n",
+		filepath.Join(root, "main.go"):                 "package main\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	matcher := New()
+	if err := matcher.AddGitExcludes(context.Background(), root); err != nil {
+		t.Fatalf("AddGitExcludes failed: %v", err)
+	}
+
+	// Patterns match relative to the directory of their file, not root
+	testCases := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"local.txt", false, true},
+		{"src/local.txt", false, false},
+		{"debug.log", false, true},
+		{"dist", true, true},
+		{"build", true, false},
+		{"src/generated", true, true},
+		{"main.go", false, false},
+	}
+	for _, tc := range testCases {
+		if result := matcher.Match(tc.path, tc.isDir); result != tc.expected {
+			t.Errorf("Match(%q): expected %v, got %v", tc.path, tc.expected, result)
+		}
+	}
+
+	expectedFiles := []string{
+		filepath.Join(repo, ".git", "info", "exclude"),
+		filepath.Join(repo, ".gitignore"),
+		filepath.Join(repo, "web", ".gitignore"),
+	}
+	if got := matcher.Files(); strings.Join(got, ",") != strings.Join(expectedFiles, ",") {
+		t.Errorf("Expected ignore files %v, got %v", expectedFiles, got)
+	}
+}
+
+func TestMatchWithParents(t *testing.T) {
+	matcher := New()
+	matcher.AddPatterns("", []string{"docs/", "*.go", "!*_test.go"})
+	matcher.AddPatterns("web", []string{"src"})
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"docs/guide.md", true},
+		{"docs/api/index.md", true},
+		{"main.go", true},
+		{"main_test.go", false},
+		{"web/src/app.js", true},
+		{"web/public/index.html", false},
+		{"README.md", false},
+	}
+
+	for _, tc := range testCases {
+		if result := matcher.MatchWithParents(tc.path, false); result != tc.expected {
+			t.Errorf("MatchWithParents(%q): expected %v, got %v", tc.path, tc.expected, result)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	matcher := New()
+	if matcher.Applies("main.go") {
+		t.Error("Empty matcher should not apply to any path")
+	}
+
+	matcher.AddPatterns("web", []string{"src"})
+	if !matcher.Applies("web/src/app.js") {
+		t.Error("Expected patterns for web to apply below web")
+	}
+	if matcher.Applies("main.go") || matcher.Applies("website/index.html") {
+		t.Error("Expected patterns for web not to apply outside web")
+	}
+}
@@ -0,0 +1,321 @@
+package ingester
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// Priority decides which files are kept first when a digest must fit a token budget
+type Priority string
+
+// Supported budget priorities
+const (
+	PriorityReadme     Priority = "readme"     // The digest order: README files first, then alphabetical, or the file order if one is set
+	PrioritySmallest   Priority = "smallest"   // Smallest files first, so as many files as possible fit
+	PriorityShallowest Priority = "shallowest" // Files closest to the root first
+	PriorityGlobs      Priority = "globs"      // Files matching the priority globs first, in glob order
+)
+
+// minTruncatedTokens is the smallest useful amount of content for a truncated file
+const minTruncatedTokens = 64
+
+// Budget describes a token budget for a digest
+type Budget struct {
+	MaxTokens     int                 // Maximum tokens for the whole digest
+	Priority      Priority            // Which files to keep first (default: PriorityReadme)
+	PriorityGlobs []string            // Glob patterns for PriorityGlobs, most important first
+	Format        Format              // Output format the digest is measured in (default: FormatMarkdown)
+	Estimator     tokenizer.Estimator // Token estimator (nil = tokenizer.Default)
+}
+
+// ParsePriority converts a priority name into a Priority
+func ParsePriority(name string) (Priority, error) {
+	switch Priority(strings.ToLower(strings.TrimSpace(name))) {
+	case "", PriorityReadme:
+		return PriorityReadme, nil
+	case PrioritySmallest:
+		return PrioritySmallest, nil
+	case PriorityShallowest:
+		return PriorityShallowest, nil
+	case PriorityGlobs, "glob":
+		return PriorityGlobs, nil
+	}
+	return "", fmt.Errorf("unsupported priority %q (expected readme, smallest, shallowest or globs)", name)
+}
+
+// ApplyTokenBudget decides for each file whether it is included in full,
+// truncated or omitted so the whole digest, written in budget.Format, fits
+// within budget.MaxTokens.
+// Omitted files stay in the result (and the tree) with Omitted set, and
+// the returned stats reflect the content that remains.
+func ApplyTokenBudget(filesData []types.FileInfo, stats types.Stats, budget Budget) ([]types.FileInfo, types.Stats) {
+	if budget.MaxTokens <= 0 {
+		return filesData, stats
+	}
+
+	estimator := tokenizer.Or(budget.Estimator)
+	result := make([]types.FileInfo, len(filesData))
+	copy(result, filesData)
+
+	stats.TokenBudget = budget.MaxTokens
+
+	// The summary and tree are always written, so they are paid for first
+	layout := budgetLayout{format: budget.Format, estimator: estimator, numFiles: len(result)}
+	remaining := budget.MaxTokens - layout.fixedOverhead(result, stats)
+
+	for _, index := range budgetOrder(result, budget) {
+		fileInfo := &result[index]
+
+		headerTokens := layout.fileOverhead(*fileInfo)
+		cost := headerTokens + layout.contentTokens(*fileInfo)
+
+		switch {
+		case cost <= remaining:
+			remaining -= cost
+		case fileInfo.SkipReason == "" && remaining-headerTokens >= minTruncatedTokens:
+			truncateToTokens(fileInfo, remaining-headerTokens, layout.contentEstimator())
+			remaining -= headerTokens + fileInfo.Tokens
+			fileInfo.Tokens = estimator.CountTokens(fileInfo.Content)
+		default:
+			fileInfo.Omitted = true
+		}
+	}
+
+	// Recompute content totals for what is left in the digest
+	stats.TotalTokens = 0
+	stats.TotalContentBytes = 0
+	stats.NumTruncatedFiles = 0
+	stats.NumOmittedFiles = 0
+	for _, fileInfo := range result {
+		if fileInfo.Error != nil {
+			continue
+		}
+		if fileInfo.Omitted {
+			stats.NumOmittedFiles++
+			continue
+		}
+		if fileInfo.Truncated {
+			stats.NumTruncatedFiles++
+		}
+		if fileInfo.SkipReason == "" {
+			stats.TotalContentBytes += int64(len(fileInfo.Content))
+		}
+		stats.TotalTokens += fileInfo.Tokens
+	}
+
+	return result, stats
+}
+
+// budgetLayout measures the parts of a digest in one output format that a
+// token budget pays for
+type budgetLayout struct {
+	format    Format
+	estimator tokenizer.Estimator
+	numFiles  int // Number of files, the widest document index in XML
+}
+
+// fixedOverhead estimates the tokens used by the summary, the history and the tree once
+// the budget has been applied. Counts and annotations are not known yet, so
+// the widest possible values are assumed to stay within the budget.
+func (l budgetLayout) fixedOverhead(filesData []types.FileInfo, stats types.Stats) int {
+	stats.NumTruncatedFiles = len(filesData)
+	stats.NumOmittedFiles = len(filesData)
+
+	worstCase := make([]types.FileInfo, len(filesData))
+	for i, fileInfo := range filesData {
+		fileInfo.Truncated = fileInfo.SkipReason == ""
+		worstCase[i] = fileInfo
+	}
+
+	switch l.format {
+	case FormatJSON:
+		// The files are measured on their own, so the digest is encoded without them
+		encoded, _ := json.MarshalIndent(jsonDigest{
+			Generated: time.Now().Format(time.RFC3339),
+			Stats:     stats,
+			Tree:      treeString(worstCase, stats),
+			Files:     []jsonFile{},
+		}, "", "  ")
+		return l.estimator.CountTokens(string(encoded) + "\n")
+	case FormatJSONL:
+		// JSONL has only the file records
+		return 0
+	case FormatXML:
+		var header strings.Builder
+		buffered := bufio.NewWriter(&header)
+		writeXMLHeader(buffered, worstCase, stats)
+		buffered.Flush()
+		return l.estimator.CountTokens(header.String() + xmlFooter)
+	}
+
+	return l.estimator.CountTokens(utils.GenerateSummaryString(stats)) +
+		l.estimator.CountTokens(utils.GenerateHistoryString(stats.History)) +
+		l.estimator.CountTokens(treeSection(worstCase, stats))
+}
+
+// fileOverhead estimates the tokens written around a file's content
+func (l budgetLayout) fileOverhead(fileInfo types.FileInfo) int {
+	switch l.format {
+	case FormatJSON, FormatJSONL:
+		record := newJSONFile(fileInfo)
+		record.Content = ""
+		record.Truncated = fileInfo.SkipReason == ""
+		if l.format == FormatJSONL {
+			encoded, _ := json.Marshal(record)
+			return l.estimator.CountTokens(string(encoded) + "\n")
+		}
+		// Records in the files array are indented and separated by commas
+		encoded, _ := json.MarshalIndent(record, "    ", "  ")
+		return l.estimator.CountTokens("    " + string(encoded) + ",\n")
+	case FormatXML:
+		fileInfo.Content = ""
+		var document strings.Builder
+		buffered := bufio.NewWriter(&document)
+		writeXMLDocument(buffered, l.numFiles, fileInfo)
+		buffered.Flush()
+		return l.estimator.CountTokens(document.String())
+	}
+
+	// Truncated content ends without a newline, which the closing fence adds
+	open, closing := contentFence(fileInfo, fileLanguage(fileInfo))
+	return l.estimator.CountTokens(fileHeader(fileInfo.RelativePath, fileInfo.LastCommit) + open + "\n" + closing + fileFooter)
+}
+
+// contentTokens estimates the tokens of a file's content as it is written
+func (l budgetLayout) contentTokens(fileInfo types.FileInfo) int {
+	switch l.format {
+	case FormatJSON, FormatJSONL:
+		// JSON drops the placeholder content of skipped files
+		if fileInfo.SkipReason != "" {
+			return 0
+		}
+	case FormatMarkdown, "":
+		return fileInfo.Tokens
+	}
+	return l.contentEstimator().CountTokens(fileInfo.Content)
+}
+
+// contentEstimator counts the tokens of content once it is escaped or
+// wrapped for the output format
+func (l budgetLayout) contentEstimator() tokenizer.Estimator {
+	switch l.format {
+	case FormatJSON, FormatJSONL:
+		return tokenizer.EstimatorFunc(func(content string) int {
+			encoded, _ := json.Marshal(content)
+			return l.estimator.CountTokens(string(encoded[1 : len(encoded)-1]))
+		})
+	case FormatXML:
+		return tokenizer.EstimatorFunc(func(content string) int {
+			return l.estimator.CountTokens(cdata(content))
+		})
+	}
+	return l.estimator
+}
+
+// budgetOrder returns the indexes of files without errors in budget priority order
+func budgetOrder(filesData []types.FileInfo, budget Budget) []int {
+	var indexes []int
+	for i, fileInfo := range filesData {
+		if fileInfo.Error == nil {
+			indexes = append(indexes, i)
+		}
+	}
+
+	// Start from the digest order so ties are broken the same way everywhere
+	digestRank := make(map[string]int)
+	for rank, fileInfo := range orderFiles(filesData) {
+		digestRank[fileInfo.RelativePath] = rank
+	}
+
+	less := func(a, b types.FileInfo) bool {
+		return digestRank[a.RelativePath] < digestRank[b.RelativePath]
+	}
+
+	switch budget.Priority {
+	case PrioritySmallest:
+		less = func(a, b types.FileInfo) bool {
+			if a.Tokens != b.Tokens {
+				return a.Tokens < b.Tokens
+			}
+			return digestRank[a.RelativePath] < digestRank[b.RelativePath]
+		}
+	case PriorityShallowest:
+		less = func(a, b types.FileInfo) bool {
+			depthA, depthB := strings.Count(a.RelativePath, "/"), strings.Count(b.RelativePath, "/")
+			if depthA != depthB {
+				return depthA < depthB
+			}
+			return digestRank[a.RelativePath] < digestRank[b.RelativePath]
+		}
+	case PriorityGlobs:
+		less = func(a, b types.FileInfo) bool {
+			rankA, rankB := globRank(a.RelativePath, budget.PriorityGlobs), globRank(b.RelativePath, budget.PriorityGlobs)
+			if rankA != rankB {
+				return rankA < rankB
+			}
+			return digestRank[a.RelativePath] < digestRank[b.RelativePath]
+		}
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return less(filesData[indexes[i]], filesData[indexes[j]])
+	})
+
+	return indexes
+}
+
+// globRank returns the index of the first glob matching relPath, or len(globs)
+func globRank(relPath string, globs []string) int {
+	for i, glob := range globs {
+		if utils.ShouldIncludeFile(relPath, []string{glob}, nil) {
+			return i
+		}
+	}
+	return len(globs)
+}
+
+// truncateToTokens cuts fileInfo.Content at a line boundary so that the
+// content plus a truncation notice fits within maxTokens
+func truncateToTokens(fileInfo *types.FileInfo, maxTokens int, estimator tokenizer.Estimator) {
+	// A trailing newline ends the last line rather than starting another one
+	totalLines := strings.Count(fileInfo.Content, "\n")
+	if !strings.HasSuffix(fileInfo.Content, "\n") {
+		totalLines++
+	}
+	lines := strings.SplitAfter(fileInfo.Content, "\n")[:totalLines]
+
+	// The notice goes on a line of its own after the lines shown
+	truncated := func(n int) string {
+		shown := strings.Join(lines[:n], "")
+		if shown != "" && !strings.HasSuffix(shown, "\n") {
+			shown += "\n"
+		}
+		return shown + fmt.Sprintf("[... truncated: showing %d of %d lines ...]", n, totalLines)
+	}
+
+	// Binary search for the longest prefix of lines that fits
+	fits := func(n int) bool {
+		return estimator.CountTokens(truncated(n)) <= maxTokens
+	}
+	low, high := 0, totalLines
+	for low < high {
+		mid := (low + high + 1) / 2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	fileInfo.Content = truncated(low)
+	fileInfo.Tokens = estimator.CountTokens(fileInfo.Content)
+	fileInfo.Truncated = true
+}
@@ -0,0 +1,204 @@
+package ingester
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// budgetTestData returns files whose token counts equal their length in
+// characters under the one-character-per-token estimator
+func budgetTestData() ([]types.FileInfo, types.Stats, tokenizer.Estimator) {
+	estimator := tokenizer.CharsPerToken(1)
+	contents := map[string]string{
+		"README.md":          "# Project\n",
+		"a_large.go":         strings.Repeat("var x = 1\n", 200),
+		"docs/guide.md":      strings.Repeat("guide\n", 20),
+		"src/core/engine.go": strings.Repeat("func run() {}\n", 30),
+		"z_small.txt":        "tiny\n",
+	}
+
+	var filesData []types.FileInfo
+	stats := types.Stats{Source: "project"}
+	for _, path := range []string{"README.md", "a_large.go", "docs/guide.md", "src/core/engine.go", "z_small.txt"} {
+		content := contents[path]
+		filesData = append(filesData, types.FileInfo{
+			RelativePath: path,
+			Content:      content,
+			Tokens:       estimator.CountTokens(content),
+		})
+		stats.AllPaths = append(stats.AllPaths, path)
+		stats.NumFilesProcessed++
+		stats.TotalTokens += estimator.CountTokens(content)
+	}
+
+	return filesData, stats, estimator
+}
+
+func findFile(filesData []types.FileInfo, relPath string) types.FileInfo {
+	for _, fileInfo := range filesData {
+		if fileInfo.RelativePath == relPath {
+			return fileInfo
+		}
+	}
+	return types.FileInfo{}
+}
+
+func TestParsePriority(t *testing.T) {
+	for _, name := range []string{"", "readme", "smallest", "shallowest", "globs", "GLOB"} {
+		if _, err := ParsePriority(name); err != nil {
+			t.Errorf("ParsePriority(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := ParsePriority("random"); err == nil {
+		t.Error("Expected error for unknown priority")
+	}
+}
+
+func TestApplyTokenBudget_Unlimited(t *testing.T) {
+	filesData, stats, estimator := budgetTestData()
+
+	result, resultStats := ApplyTokenBudget(filesData, stats, Budget{MaxTokens: 1000000, Estimator: estimator})
+	if resultStats.NumOmittedFiles != 0 || resultStats.NumTruncatedFiles != 0 {
+		t.Errorf("Expected nothing to be cut, got %d truncated, %d omitted", resultStats.NumTruncatedFiles, resultStats.NumOmittedFiles)
+	}
+	if resultStats.TotalTokens != stats.TotalTokens {
+		t.Errorf("Expected %d tokens, got %d", stats.TotalTokens, resultStats.TotalTokens)
+	}
+	if result[1].Content != filesData[1].Content {
+		t.Error("Content should be unchanged")
+	}
+}
+
+func TestApplyTokenBudget_FitsBudget(t *testing.T) {
+	for _, priority := range []Priority{PriorityReadme, PrioritySmallest, PriorityShallowest, PriorityGlobs} {
+		t.Run(string(priority), func(t *testing.T) {
+			filesData, stats, estimator := budgetTestData()
+			budget := Budget{MaxTokens: 1500, Priority: priority, PriorityGlobs: []string{"src/*"}, Estimator: estimator}
+
+			result, resultStats := ApplyTokenBudget(filesData, stats, budget)
+
+			var buf bytes.Buffer
+			if err := WriteDigestTo(&buf, result, resultStats); err != nil {
+				t.Fatalf("WriteDigestTo failed: %v", err)
+			}
+			if tokens := estimator.CountTokens(buf.String()); tokens > budget.MaxTokens {
+				t.Errorf("Digest uses %d tokens, budget is %d", tokens, budget.MaxTokens)
+			}
+			if resultStats.NumOmittedFiles+resultStats.NumTruncatedFiles == 0 {
+				t.Error("Expected some files to be cut to fit the budget")
+			}
+		})
+	}
+}
+
+func TestApplyTokenBudget_Formats(t *testing.T) {
+	for _, format := range []Format{FormatMarkdown, FormatJSON, FormatJSONL, FormatXML} {
+		t.Run(string(format), func(t *testing.T) {
+			filesData, stats, estimator := budgetTestData()
+			budget := Budget{MaxTokens: 2500, Format: format, Estimator: estimator}
+
+			result, resultStats := ApplyTokenBudget(filesData, stats, budget)
+
+			var buf bytes.Buffer
+			if err := WriteDigestFormat(&buf, format, result, resultStats); err != nil {
+				t.Fatalf("WriteDigestFormat failed: %v", err)
+			}
+			if tokens := estimator.CountTokens(buf.String()); tokens > budget.MaxTokens {
+				t.Errorf("Digest uses %d tokens, budget is %d", tokens, budget.MaxTokens)
+			}
+			if resultStats.NumOmittedFiles+resultStats.NumTruncatedFiles == 0 {
+				t.Error("Expected some files to be cut to fit the budget")
+			}
+		})
+	}
+}
+
+func TestApplyTokenBudget_Priorities(t *testing.T) {
+	filesData, stats, estimator := budgetTestData()
+
+	// Smallest first keeps every small file and cuts the large one
+	result, _ := ApplyTokenBudget(filesData, stats, Budget{MaxTokens: 1800, Priority: PrioritySmallest, Estimator: estimator})
+	for _, path := range []string{"README.md", "z_small.txt", "docs/guide.md", "src/core/engine.go"} {
+		if fileInfo := findFile(result, path); fileInfo.Omitted || fileInfo.Truncated {
+			t.Errorf("%s should be kept in full with smallest priority", path)
+		}
+	}
+	if large := findFile(result, "a_large.go"); !large.Omitted && !large.Truncated {
+		t.Error("a_large.go should be cut with smallest priority")
+	}
+
+	// Glob priority keeps src/ ahead of alphabetically earlier files
+	result, _ = ApplyTokenBudget(filesData, stats, Budget{MaxTokens: 1200, Priority: PriorityGlobs, PriorityGlobs: []string{"src/core/*"}, Estimator: estimator})
+	if engine := findFile(result, "src/core/engine.go"); engine.Omitted || engine.Truncated {
+		t.Error("src/core/engine.go should be kept in full with glob priority")
+	}
+}
+
+func TestApplyTokenBudget_OmittedInTree(t *testing.T) {
+	filesData, stats, estimator := budgetTestData()
+
+	result, resultStats := ApplyTokenBudget(filesData, stats, Budget{MaxTokens: 600, Priority: PrioritySmallest, Estimator: estimator})
+
+	var buf bytes.Buffer
+	if err := WriteDigestTo(&buf, result, resultStats); err != nil {
+		t.Fatalf("WriteDigestTo failed: %v", err)
+	}
+	digest := buf.String()
+
+	if !strings.Contains(digest, "a_large.go (Omitted)") {
+		t.Errorf("Omitted file should be marked in the tree:\n%s", digest)
+	}
+	if strings.Contains(digest, "FILE: a_large.go") {
+		t.Error("Omitted file content should not be written")
+	}
+	if !strings.Contains(digest, "Token Budget:** 600") {
+		t.Error("Summary should report the token budget")
+	}
+}
+
+func TestTruncateToTokens(t *testing.T) {
+	estimator := tokenizer.CharsPerToken(1)
+	fileInfo := types.FileInfo{Content: strings.Repeat("0123456789\n", 100)}
+
+	truncateToTokens(&fileInfo, 300, estimator)
+
+	if !fileInfo.Truncated {
+		t.Error("Expected file to be marked as truncated")
+	}
+	if fileInfo.Tokens > 300 {
+		t.Errorf("Truncated content uses %d tokens, expected at most 300", fileInfo.Tokens)
+	}
+	if !strings.HasPrefix(fileInfo.Content, "0123456789\n0123456789\n") {
+		t.Error("Truncated content should keep the beginning of the file")
+	}
+	if !strings.Contains(fileInfo.Content, "of 100 lines") {
+		t.Errorf("Expected truncation notice, got %q", fileInfo.Content[len(fileInfo.Content)-60:])
+	}
+}
+
+func TestTruncateToTokens_Notice(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected string
+		desc     string
+	}{
+		{"one\ntwo\nthree\n", "one\n[... truncated: showing 1 of 3 lines ...]", "Trailing newline"},
+		{"one\ntwo\nthree", "one\n[... truncated: showing 1 of 3 lines ...]", "No trailing newline"},
+		{"one two three four\n", "[... truncated: showing 0 of 1 lines ...]", "Nothing fits"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// Room for the notice and one short line
+			fileInfo := types.FileInfo{Content: tc.content}
+			truncateToTokens(&fileInfo, 46, tokenizer.CharsPerToken(1))
+			if fileInfo.Content != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, fileInfo.Content)
+			}
+		})
+	}
+}
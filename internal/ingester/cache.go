@@ -0,0 +1,347 @@
+package ingester
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/progress"
+)
+
+const (
+	cacheMirrorDir  = "repo.git" // Bare mirror inside a cache entry
+	cacheLockFile   = "lock"     // Held while an entry is fetched, cloned from or removed
+	cacheRemovalTag = ".removing-"
+
+	staleLockAge = 10 * time.Minute       // Locks not refreshed for this long are left over from a crash
+	lockRefresh  = staleLockAge / 4       // How often a held lock is touched
+	lockPoll     = 100 * time.Millisecond // How often a waiting run retries the lock
+)
+
+// CacheEntry describes a cached repository mirror
+type CacheEntry struct {
+	URL      string    // Repository URL the mirror was cloned from
+	Path     string    // Directory of the cache entry
+	Size     int64     // Total size of the entry in bytes
+	LastUsed time.Time // When a digest last used the mirror
+}
+
+// DefaultCacheDir returns the clone cache directory below the user's cache
+// directory, such as ~/.cache/gingest/repos on Linux
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "gingest", "repos"), nil
+}
+
+// cacheKey returns the cache entry name for gitURL: a readable form of the
+// URL followed by a hash of the exact URL, so similar URLs don't collide
+func cacheKey(gitURL string) string {
+	name := gitURL
+	if index := strings.Index(name, "://"); index >= 0 {
+		name = name[index+3:]
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, "git@"), "/"), ".git")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > 64 {
+		name = name[len(name)-64:]
+	}
+
+	sum := sha256.Sum256([]byte(gitURL))
+	return name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// syncMirror brings the cached mirror of gitURL up to date, cloning it on
+// first use and fetching incrementally afterwards, and returns a file:// URL
+// for it. The entry stays locked until unlock is called, so concurrent runs
+// don't fetch into or remove a mirror that is being cloned from.
+func syncMirror(ctx context.Context, cacheDir, gitURL string, progressFunc progress.Func) (string, func(), error) {
+	entryDir := filepath.Join(cacheDir, cacheKey(gitURL))
+	unlock, err := lockCacheEntry(ctx, entryDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mirrorDir := filepath.Join(entryDir, cacheMirrorDir)
+	if _, statErr := os.Stat(mirrorDir); statErr == nil {
+		err = runGit(ctx, progressFunc, append(append([]string{"-C", mirrorDir, "fetch"}, progressFlags(progressFunc)...), "--prune", "origin")...)
+	} else {
+		err = cloneMirror(ctx, mirrorDir, gitURL, progressFunc)
+	}
+	if err != nil {
+		unlock()
+		return "", nil, err
+	}
+
+	now := time.Now()
+	os.Chtimes(entryDir, now, now)
+	return fileURL(mirrorDir), unlock, nil
+}
+
+// cloneMirror clones gitURL as a bare mirror into mirrorDir. The clone goes
+// to a scratch directory first, so an interrupted clone never leaves a
+// broken mirror behind.
+func cloneMirror(ctx context.Context, mirrorDir, gitURL string, progressFunc progress.Func) error {
+	scratch := mirrorDir + ".tmp"
+	if err := os.RemoveAll(scratch); err != nil {
+		return fmt.Errorf("failed to remove incomplete mirror: %w", err)
+	}
+
+	args := append([]string{"clone", "--mirror"}, progressFlags(progressFunc)...)
+	err := runGit(ctx, progressFunc, append(args, gitURL, scratch)...)
+	if err == nil {
+		// Let clones from the mirror fetch single commits and filter blobs
+		// like a hosted server would
+		for _, setting := range [][]string{{"uploadpack.allowFilter", "true"}, {"uploadpack.allowAnySHA1InWant", "true"}} {
+			if err = runGit(ctx, nil, "-C", scratch, "config", setting[0], setting[1]); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = os.Rename(scratch, mirrorDir)
+	}
+	if err != nil {
+		os.RemoveAll(scratch)
+		return err
+	}
+	return nil
+}
+
+// fileURL returns a file:// URL for the local path dir. git ignores --depth
+// and --filter for clones from plain paths.
+func fileURL(dir string) string {
+	url := filepath.ToSlash(dir)
+	if !strings.HasPrefix(url, "/") {
+		url = "/" + url // Windows drive letters
+	}
+	return "file://" + url
+}
+
+// lockCacheEntry creates entryDir if needed and waits until its lock file
+// can be created, or ctx is cancelled. The returned function releases the
+// lock; while it is held, the lock file is touched so it doesn't look stale.
+func lockCacheEntry(ctx context.Context, entryDir string) (func(), error) {
+	for {
+		if err := os.MkdirAll(entryDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		locked, err := tryLockCacheEntry(entryDir)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+
+	lockPath := filepath.Join(entryDir, cacheLockFile)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(lockPath, now, now)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		os.Remove(lockPath)
+	}, nil
+}
+
+// tryLockCacheEntry creates the lock file of entryDir and reports whether it
+// did. A lock that hasn't been touched for staleLockAge is taken over.
+func tryLockCacheEntry(entryDir string) (bool, error) {
+	lockPath := filepath.Join(entryDir, cacheLockFile)
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return false, fmt.Errorf("failed to write cache lock: %w", err)
+			}
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, fmt.Errorf("failed to create cache lock: %w", err)
+		}
+
+		info, statErr := os.Stat(lockPath)
+		if statErr != nil || time.Since(info.ModTime()) < staleLockAge {
+			// Held, or released in the meantime; the caller retries
+			return false, nil
+		}
+		if !removeStaleLock(lockPath, info) {
+			// Another run took the stale lock over first
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// lockTakeovers numbers the names stale locks are moved to, so takeovers in
+// one process don't collide
+var lockTakeovers int64
+
+// removeStaleLock removes the lock at lockPath that was found stale as info
+// and reports whether it did. Removing by path could delete the fresh lock of
+// a run that took the stale one over in the meantime, so the lock is first
+// moved to a name of its own: only one run can move it, and the moved file
+// must still be the stale lock, with the same identity and modification time.
+func removeStaleLock(lockPath string, info fs.FileInfo) bool {
+	moved := fmt.Sprintf("%s.stale-%d-%d", lockPath, os.Getpid(), atomic.AddInt64(&lockTakeovers, 1))
+	if err := os.Rename(lockPath, moved); err != nil {
+		return false
+	}
+	defer os.Remove(moved)
+
+	movedInfo, err := os.Stat(moved)
+	if err != nil || !os.SameFile(info, movedInfo) || !movedInfo.ModTime().Equal(info.ModTime()) {
+		// A fresh lock was moved; put it back unless a new one exists by now
+		os.Link(moved, lockPath)
+		return false
+	}
+	return true
+}
+
+// ListCache returns the mirrors in cacheDir, most recently used first. A
+// missing cacheDir holds no mirrors.
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	dirEntries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var entries []CacheEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || strings.Contains(dirEntry.Name(), cacheRemovalTag) {
+			continue
+		}
+		entryDir := filepath.Join(cacheDir, dirEntry.Name())
+		mirrorDir := filepath.Join(entryDir, cacheMirrorDir)
+		info, err := os.Stat(entryDir)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(mirrorDir); err != nil {
+			continue // Not cloned yet, or not a cache entry
+		}
+
+		entry := CacheEntry{Path: entryDir, LastUsed: info.ModTime()}
+		if output, err := exec.Command("git", "config", "--file", filepath.Join(mirrorDir, "config"), "--get", "remote.origin.url").Output(); err == nil {
+			entry.URL = strings.TrimSpace(string(output))
+		}
+		entry.Size = dirSize(entryDir)
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// dirSize returns the total size of the files below dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// PruneCache removes the mirrors in cacheDir that haven't been used for
+// maxAge and returns them. Mirrors in use by a running digest are kept.
+func PruneCache(cacheDir string, maxAge time.Duration) ([]CacheEntry, error) {
+	cutoff := time.Now().Add(-maxAge)
+	return removeCacheEntries(cacheDir, func(entry CacheEntry) bool {
+		return entry.LastUsed.Before(cutoff)
+	})
+}
+
+// ClearCache removes every mirror in cacheDir and returns them. Mirrors in
+// use by a running digest are kept.
+func ClearCache(cacheDir string) ([]CacheEntry, error) {
+	return removeCacheEntries(cacheDir, func(CacheEntry) bool {
+		return true
+	})
+}
+
+// removeCacheEntries removes the mirrors selected by remove that aren't locked
+func removeCacheEntries(cacheDir string, remove func(CacheEntry) bool) ([]CacheEntry, error) {
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []CacheEntry
+	for _, entry := range entries {
+		if !remove(entry) {
+			continue
+		}
+		locked, err := tryLockCacheEntry(entry.Path)
+		if err != nil {
+			return removed, err
+		}
+		if !locked {
+			continue
+		}
+
+		// Move the entry aside while holding its lock, so a run starting now
+		// clones into a fresh entry instead of finding a half-removed mirror
+		doomed := entry.Path + cacheRemovalTag + strconv.Itoa(os.Getpid())
+		if err := os.Rename(entry.Path, doomed); err != nil {
+			os.Remove(filepath.Join(entry.Path, cacheLockFile))
+			return removed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		if err := os.RemoveAll(doomed); err != nil {
+			return removed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
@@ -0,0 +1,322 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pushCommit commits content as version.txt to the bare repository at url
+func pushCommit(t *testing.T, url, content string) {
+	t.Helper()
+	work := filepath.Join(t.TempDir(), "work")
+	commands := [][]string{
+		{"clone", "--quiet", url, work},
+		{"-C", work, "add", "version.txt"},
+		{"-C", work, "commit", "--quiet", "-m", content},
+		{"-C", work, "push", "--quiet", "origin", "HEAD"},
+	}
+	for i, args := range commands {
+		if i == 1 {
+			if err := os.WriteFile(filepath.Join(work, "version.txt"), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write version.txt: %v", err)
+			}
+		}
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+}
+
+func TestProcessRemoteRepo_Cache(t *testing.T) {
+	repo := createTestRepo(t)
+	cacheDir := t.TempDir()
+	config := Config{CacheDir: cacheDir, ExcludePatterns: []string{".git"}}
+
+	digest := func(config Config) string {
+		t.Helper()
+		_, filesData, _, err := ProcessRemoteRepoContext(context.Background(), repo.url, "", config)
+		if err != nil {
+			t.Fatalf("ProcessRemoteRepoContext failed: %v", err)
+		}
+		if len(filesData) != 1 {
+			t.Fatalf("Expected version.txt only, got %+v", filesData)
+		}
+		return filesData[0].Content
+	}
+
+	if content := digest(config); content != "second\n" {
+		t.Errorf("Expected second\\n, got %q", content)
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		t.Fatalf("ListCache failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].URL != repo.url || entries[0].Size == 0 {
+		t.Fatalf("Expected one mirror of %s, got %+v", repo.url, entries)
+	}
+
+	// Reuse fetches new commits into the mirror
+	pushCommit(t, repo.url, "third\n")
+	if content := digest(config); content != "third\n" {
+		t.Errorf("Expected the new commit after fetching, got %q", content)
+	}
+
+	// Refs resolve against the mirror, including abbreviated SHAs and sparse checkouts
+	for _, ref := range []string{"v1.0", repo.first[:8]} {
+		refConfig := config
+		refConfig.Ref = ref
+		if content := digest(refConfig); content != "first\n" {
+			t.Errorf("Expected first\\n for %s, got %q", ref, content)
+		}
+	}
+
+	entries, err = ListCache(cacheDir)
+	if err != nil {
+		t.Fatalf("ListCache failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected the mirror to be reused, got %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(entries[0].Path, cacheLockFile)); err == nil {
+		t.Error("Expected the lock to be released")
+	}
+}
+
+func TestProcessRemoteRepo_CacheConcurrent(t *testing.T) {
+	repo := createTestRepo(t)
+	config := Config{CacheDir: t.TempDir(), ExcludePatterns: []string{".git"}}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, _, errs[i] = ProcessRemoteRepoContext(context.Background(), repo.url, "", config)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Run %d failed: %v", i, err)
+		}
+	}
+	if entries, err := ListCache(config.CacheDir); err != nil || len(entries) != 1 {
+		t.Errorf("Expected one mirror, got %+v (%v)", entries, err)
+	}
+}
+
+func TestLockCacheEntry(t *testing.T) {
+	entryDir := filepath.Join(t.TempDir(), "entry")
+	unlock, err := lockCacheEntry(context.Background(), entryDir)
+	if err != nil {
+		t.Fatalf("lockCacheEntry failed: %v", err)
+	}
+
+	if locked, err := tryLockCacheEntry(entryDir); err != nil || locked {
+		t.Errorf("Expected the held lock to be busy, got %v (%v)", locked, err)
+	}
+
+	// Waiting gives up when the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if _, err := lockCacheEntry(ctx, entryDir); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	unlock()
+	if locked, err := tryLockCacheEntry(entryDir); err != nil || !locked {
+		t.Fatalf("Expected the released lock to be free, got %v (%v)", locked, err)
+	}
+
+	// A lock left over from a crash is taken over
+	stale := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(filepath.Join(entryDir, cacheLockFile), stale, stale); err != nil {
+		t.Fatalf("Failed to age the lock: %v", err)
+	}
+	if locked, err := tryLockCacheEntry(entryDir); err != nil || !locked {
+		t.Errorf("Expected the stale lock to be taken over, got %v (%v)", locked, err)
+	}
+}
+
+// lockRaceDirEnv names the directory of stale locks that the test binary,
+// run as a helper process by TestTryLockCacheEntry_StaleRace, takes over
+const lockRaceDirEnv = "GINGEST_LOCK_RACE_DIR"
+
+func TestTryLockCacheEntry_StaleRace(t *testing.T) {
+	if dir := os.Getenv(lockRaceDirEnv); dir != "" {
+		// Helper process: wait for the start signal, then take over every
+		// entry it can and print the ones it got
+		for {
+			if _, err := os.Stat(filepath.Join(dir, "start")); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < 1000; i++ {
+			name := fmt.Sprintf("entry-%04d", i)
+			if locked, err := tryLockCacheEntry(filepath.Join(dir, name)); err == nil && locked {
+				fmt.Println(name)
+			}
+		}
+		return
+	}
+
+	dir := t.TempDir()
+	stale := time.Now().Add(-2 * staleLockAge)
+	for i := 0; i < 1000; i++ {
+		lockPath := filepath.Join(dir, fmt.Sprintf("entry-%04d", i), cacheLockFile)
+		if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+			t.Fatalf("Failed to create the entry: %v", err)
+		}
+		if err := os.WriteFile(lockPath, []byte("1\n"), 0644); err != nil {
+			t.Fatalf("Failed to create the lock: %v", err)
+		}
+		if err := os.Chtimes(lockPath, stale, stale); err != nil {
+			t.Fatalf("Failed to age the lock: %v", err)
+		}
+	}
+
+	// Two processes go through the same stale locks at the same time
+	outputs := make([]bytes.Buffer, 2)
+	cmds := make([]*exec.Cmd, len(outputs))
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=^TestTryLockCacheEntry_StaleRace$")
+		cmds[i].Env = append(os.Environ(), lockRaceDirEnv+"="+dir)
+		cmds[i].Stdout = &outputs[i]
+		if err := cmds[i].Start(); err != nil {
+			t.Fatalf("Failed to start helper process: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "start"), nil, 0644); err != nil {
+		t.Fatalf("Failed to start the race: %v", err)
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("Helper process failed: %v\n%s", err, outputs[i].String())
+		}
+	}
+
+	holders := make(map[string]int)
+	for _, output := range outputs {
+		for _, line := range strings.Split(output.String(), "\n") {
+			if strings.HasPrefix(line, "entry-") {
+				holders[line]++
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("entry-%04d", i)
+		if holders[name] != 1 {
+			t.Errorf("Expected one process to take over %s, got %d", name, holders[name])
+		}
+	}
+}
+
+func TestRemoveStaleLock(t *testing.T) {
+	entryDir := t.TempDir()
+	lockPath := filepath.Join(entryDir, cacheLockFile)
+	stale := time.Now().Add(-2 * staleLockAge)
+	if err := os.WriteFile(lockPath, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create the lock: %v", err)
+	}
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatalf("Failed to age the lock: %v", err)
+	}
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatalf("Failed to stat the lock: %v", err)
+	}
+
+	// Another run takes the stale lock over between this run's check and its removal
+	if locked, err := tryLockCacheEntry(entryDir); err != nil || !locked {
+		t.Fatalf("Expected the stale lock to be taken over, got %v (%v)", locked, err)
+	}
+	if removeStaleLock(lockPath, info) {
+		t.Error("Expected the fresh lock not to be removed as stale")
+	}
+	fresh, err := os.Stat(lockPath)
+	if err != nil || time.Since(fresh.ModTime()) > staleLockAge {
+		t.Errorf("Expected the fresh lock to stay in place, got %v", err)
+	}
+	if matches, _ := filepath.Glob(lockPath + ".stale-*"); len(matches) != 0 {
+		t.Errorf("Expected no moved locks to be left behind, got %v", matches)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"old", "new", "busy"} {
+		if err := os.MkdirAll(filepath.Join(cacheDir, name, cacheMirrorDir), 0755); err != nil {
+			t.Fatalf("Failed to create cache entry: %v", err)
+		}
+	}
+	if _, err := lockCacheEntry(context.Background(), filepath.Join(cacheDir, "busy")); err != nil {
+		t.Fatalf("lockCacheEntry failed: %v", err)
+	}
+	for _, name := range []string{"old", "busy"} {
+		if err := os.Chtimes(filepath.Join(cacheDir, name), old, old); err != nil {
+			t.Fatalf("Failed to age cache entry: %v", err)
+		}
+	}
+
+	removed, err := PruneCache(cacheDir, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("PruneCache failed: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0].Path) != "old" {
+		t.Errorf("Expected only the old entry to be pruned, got %+v", removed)
+	}
+
+	removed, err = ClearCache(cacheDir)
+	if err != nil {
+		t.Fatalf("ClearCache failed: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0].Path) != "new" {
+		t.Errorf("Expected the unlocked entry to be cleared, got %+v", removed)
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		t.Fatalf("ListCache failed: %v", err)
+	}
+	if len(entries) != 1 || filepath.Base(entries[0].Path) != "busy" {
+		t.Errorf("Expected the locked entry to remain, got %+v", entries)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	testCases := []struct {
+		url    string
+		prefix string
+		desc   string
+	}{
+		{"https://github.com/user/repo.git", "github.com_user_repo-", "HTTPS URL"},
+		{"git@github.com:user/repo.git", "github.com_user_repo-", "SSH URL"},
+		{"file:///tmp/repo.git", "_tmp_repo-", "File URL"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			key := cacheKey(tc.url)
+			if !strings.HasPrefix(key, tc.prefix) {
+				t.Errorf("Expected key starting with %q, got %q", tc.prefix, key)
+			}
+		})
+	}
+
+	if cacheKey("https://github.com/user/repo.git") == cacheKey("git@github.com:user/repo.git") {
+		t.Error("Expected different URLs to get different keys")
+	}
+}
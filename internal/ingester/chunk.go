@@ -0,0 +1,258 @@
+package ingester
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// ChunkLimits limits the size of each chunk written by WriteChunkedDigest.
+// When both limits are set, every chunk respects both.
+type ChunkLimits struct {
+	MaxTokens int                 // Maximum tokens per chunk (0 = no limit)
+	MaxBytes  int                 // Maximum bytes per chunk (0 = no limit)
+	Estimator tokenizer.Estimator // Token estimator (nil = tokenizer.Default)
+	Progress  progress.Func       // Receives the bytes written across all chunks (optional)
+}
+
+// chunkSize is the size of a piece of a chunk in both units
+type chunkSize struct {
+	bytes  int
+	tokens int
+}
+
+func (s chunkSize) add(other chunkSize) chunkSize {
+	return chunkSize{bytes: s.bytes + other.bytes, tokens: s.tokens + other.tokens}
+}
+
+// measure returns the size of text, only counting tokens when a token limit is set
+func (l ChunkLimits) measure(text string) chunkSize {
+	size := chunkSize{bytes: len(text)}
+	if l.MaxTokens > 0 {
+		size.tokens = tokenizer.Or(l.Estimator).CountTokens(text)
+	}
+	return size
+}
+
+// fits reports whether size is within every configured limit
+func (l ChunkLimits) fits(size chunkSize) bool {
+	if l.MaxTokens > 0 && size.tokens > l.MaxTokens {
+		return false
+	}
+	if l.MaxBytes > 0 && size.bytes > l.MaxBytes {
+		return false
+	}
+	return true
+}
+
+// chunkBlock is a file, or a part of a file too large for a single chunk
+type chunkBlock struct {
+	fileInfo    types.FileInfo
+	part, parts int
+	lang        string // Language of the whole file, which a part's content may not tell
+}
+
+// header returns the FILE banner for the block, numbering parts of split files
+func (b chunkBlock) header() string {
+	if b.parts <= 1 {
+		return fileHeader(b.fileInfo.RelativePath, b.fileInfo.LastCommit)
+	}
+	return fileHeader(fmt.Sprintf("%s (part %d of %d)", b.fileInfo.RelativePath, b.part, b.parts), b.fileInfo.LastCommit)
+}
+
+// text returns the block as written to a chunk
+func (b chunkBlock) text() string {
+	open, closing := contentFence(b.fileInfo, b.lang)
+	return b.header() + open + b.fileInfo.Content + closing + fileFooter
+}
+
+// ChunkFileName returns the path of the 1-based chunk index for outputFilePath,
+// for example digest.md becomes digest-001.md
+func ChunkFileName(outputFilePath string, index int) string {
+	ext := filepath.Ext(outputFilePath)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(outputFilePath, ext), index, ext)
+}
+
+// chunkHeader returns the header repeated at the top of every chunk. The first
+// chunk also carries the full summary statistics and the history.
+func chunkHeader(index, total int, stats types.Stats) string {
+	var header strings.Builder
+	if index == 1 {
+		header.WriteString(utils.GenerateSummaryString(stats))
+		header.WriteString(utils.GenerateHistoryString(stats.History))
+	} else {
+		header.WriteString("# Codebase Digest\n\n")
+		header.WriteString(fmt.Sprintf("**Source:** %s\n\n", stats.Source))
+	}
+	header.WriteString(fmt.Sprintf("**Chunk:** %d of %d\n\n---\n\n", index, total))
+	return header.String()
+}
+
+// WriteChunkedDigest writes the digest as numbered Markdown files next to
+// outputFilePath (digest-001.md, digest-002.md, ...) and returns their paths.
+// Files are never split across chunks unless a single file exceeds the limit
+// on its own. Every chunk repeats a short header and the full directory tree.
+func WriteChunkedDigest(outputFilePath string, filesData []types.FileInfo, stats types.Stats, limits ChunkLimits) ([]string, error) {
+	return WriteChunkedDigestContext(context.Background(), outputFilePath, filesData, stats, limits)
+}
+
+// WriteChunkedDigestContext is WriteChunkedDigest with cancellation. If
+// writing fails or ctx is cancelled, every chunk written so far is removed.
+func WriteChunkedDigestContext(ctx context.Context, outputFilePath string, filesData []types.FileInfo, stats types.Stats, limits ChunkLimits) ([]string, error) {
+	if limits.MaxTokens <= 0 && limits.MaxBytes <= 0 {
+		return nil, fmt.Errorf("chunk limits must set a token or byte limit")
+	}
+
+	chunks, err := planChunks(filesData, stats, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	tree := treeSection(filesData, stats)
+	counter := progress.NewCounter(limits.Progress)
+	for i, blocks := range chunks {
+		path := ChunkFileName(outputFilePath, i+1)
+		if err := writeChunkFile(ctx, path, counter, chunkHeader(i+1, len(chunks), stats), tree, blocks); err != nil {
+			for _, written := range paths {
+				os.Remove(written)
+			}
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// planChunks packs file blocks into chunks in digest order
+func planChunks(filesData []types.FileInfo, stats types.Stats, limits ChunkLimits) ([][]chunkBlock, error) {
+	tree := limits.measure(treeSection(filesData, stats))
+
+	// Reserve room for the widest possible chunk numbers in the header
+	overhead := func(index int) chunkSize {
+		return tree.add(limits.measure(chunkHeader(index, 99999, stats)))
+	}
+	// The first chunk carries the full summary, so it has the largest overhead
+	largest := overhead(1)
+	if !limits.fits(largest.add(limits.measure(fileHeader("", nil)))) {
+		return nil, fmt.Errorf("chunk limit is too small for the digest header and directory tree")
+	}
+
+	var chunks [][]chunkBlock
+	var current []chunkBlock
+	used := largest
+
+	for _, fileInfo := range orderFiles(filesData) {
+		lang := fileLanguage(fileInfo)
+		blocks := []chunkBlock{{fileInfo: fileInfo, part: 1, parts: 1, lang: lang}}
+
+		// A file that can't fit even in an empty chunk is split into parts
+		if !limits.fits(largest.add(limits.measure(blocks[0].text()))) {
+			blocks = splitBlock(fileInfo, lang, limits, largest)
+		}
+
+		for _, block := range blocks {
+			size := limits.measure(block.text())
+			if len(current) > 0 && !limits.fits(used.add(size)) {
+				chunks = append(chunks, current)
+				current = nil
+				used = overhead(len(chunks) + 1)
+			}
+			current = append(current, block)
+			used = used.add(size)
+		}
+	}
+
+	if len(current) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks, nil
+}
+
+// splitBlock splits a file's content at line boundaries into parts that each
+// fit in an otherwise empty chunk. A single line longer than the limit gets a
+// part of its own. Each part is fenced as a code block of its own.
+func splitBlock(fileInfo types.FileInfo, lang string, limits ChunkLimits, overhead chunkSize) []chunkBlock {
+	// Reserve room for the part numbering in the header and for fences as
+	// long as the whole file's, which no part's fence is longer than
+	open, closing := contentFence(fileInfo, lang)
+	wrapper := limits.measure(fileHeader(fileInfo.RelativePath+" (part 99999 of 99999)", fileInfo.LastCommit) + open + "\n" + closing + fileFooter)
+	available := overhead.add(wrapper)
+
+	var parts []string
+	var part strings.Builder
+	var used chunkSize
+
+	for _, line := range strings.SplitAfter(fileInfo.Content, "\n") {
+		size := limits.measure(line)
+		if part.Len() > 0 && !limits.fits(available.add(used).add(size)) {
+			parts = append(parts, part.String())
+			part.Reset()
+			used = chunkSize{}
+		}
+		part.WriteString(line)
+		used = used.add(size)
+	}
+	if part.Len() > 0 {
+		parts = append(parts, part.String())
+	}
+
+	blocks := make([]chunkBlock, len(parts))
+	for i, content := range parts {
+		partInfo := fileInfo
+		partInfo.Content = content
+		blocks[i] = chunkBlock{fileInfo: partInfo, part: i + 1, parts: len(parts), lang: lang}
+	}
+	return blocks
+}
+
+// writeChunkFile writes a single chunk to path, removing it on failure
+func writeChunkFile(ctx context.Context, path string, counter *progress.Counter, header, tree string, blocks []chunkBlock) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk file: %w", err)
+	}
+
+	buffered := bufio.NewWriter(contextWriter{ctx: ctx, w: counter.Writer(file)})
+	err = writeChunk(buffered, header, tree, blocks)
+	if err == nil {
+		if err = buffered.Flush(); err != nil {
+			err = fmt.Errorf("failed to write chunk %s: %w", path, err)
+		}
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to close chunk file: %w", err)
+	}
+	return nil
+}
+
+// writeChunk writes the header, tree and file blocks of a chunk to w
+func writeChunk(w io.Writer, header, tree string, blocks []chunkBlock) error {
+	if _, err := io.WriteString(w, header+tree); err != nil {
+		return fmt.Errorf("failed to write chunk header: %w", err)
+	}
+	for _, block := range blocks {
+		if _, err := io.WriteString(w, block.text()); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", block.fileInfo.RelativePath, err)
+		}
+	}
+	return nil
+}
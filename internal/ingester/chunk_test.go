@@ -0,0 +1,148 @@
+package ingester
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+func chunkTestData() ([]types.FileInfo, types.Stats) {
+	var filesData []types.FileInfo
+	stats := types.Stats{Source: "project"}
+
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("pkg/file_%02d.go", i)
+		filesData = append(filesData, types.FileInfo{
+			RelativePath: path,
+			Content:      strings.Repeat(fmt.Sprintf("// line of file %d\n", i), 20),
+		})
+		stats.AllPaths = append(stats.AllPaths, path)
+	}
+
+	// One file larger than any single chunk
+	filesData = append(filesData, types.FileInfo{
+		RelativePath: "huge.txt",
+		Content:      strings.Repeat("a long line of text in a huge file\n", 300),
+	})
+	stats.AllPaths = append(stats.AllPaths, "huge.txt")
+	stats.NumFilesProcessed = len(filesData)
+
+	return filesData, stats
+}
+
+func TestChunkFileName(t *testing.T) {
+	testCases := []struct {
+		path     string
+		index    int
+		expected string
+	}{
+		{"digest.md", 1, "digest-001.md"},
+		{"out/repo.txt", 12, "out/repo-012.txt"},
+		{"digest", 3, "digest-003"},
+	}
+
+	for _, tc := range testCases {
+		if got := ChunkFileName(tc.path, tc.index); got != tc.expected {
+			t.Errorf("ChunkFileName(%q, %d) = %q, expected %q", tc.path, tc.index, got, tc.expected)
+		}
+	}
+}
+
+func TestWriteChunkedDigest_Bytes(t *testing.T) {
+	filesData, stats := chunkTestData()
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+	limit := 4096
+
+	paths, err := WriteChunkedDigest(outputFile, filesData, stats, ChunkLimits{MaxBytes: limit})
+	if err != nil {
+		t.Fatalf("WriteChunkedDigest failed: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("Expected several chunks, got %d", len(paths))
+	}
+
+	fileCounts := make(map[string]int)
+	for i, path := range paths {
+		if path != ChunkFileName(outputFile, i+1) {
+			t.Errorf("Unexpected chunk path %s", path)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read chunk: %v", err)
+		}
+		chunk := string(content)
+
+		if len(chunk) > limit {
+			t.Errorf("Chunk %d is %d bytes, limit is %d", i+1, len(chunk), limit)
+		}
+		if !strings.Contains(chunk, fmt.Sprintf("**Chunk:** %d of %d", i+1, len(paths))) {
+			t.Errorf("Chunk %d is missing its chunk header", i+1)
+		}
+		if !strings.Contains(chunk, "## Directory Structure") || !strings.Contains(chunk, "file_09.go") {
+			t.Errorf("Chunk %d is missing the directory tree", i+1)
+		}
+
+		fences := 0
+		for _, line := range strings.Split(chunk, "\n") {
+			if strings.HasPrefix(line, "FILE: ") {
+				fileCounts[strings.TrimPrefix(line, "FILE: ")]++
+			}
+			if strings.HasPrefix(line, "```") {
+				fences++
+			}
+		}
+		// Every code block, including each part of a split file, is closed
+		if fences%2 != 0 {
+			t.Errorf("Chunk %d has an unclosed code block", i+1)
+		}
+	}
+
+	// Regular files appear exactly once and are never split
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("pkg/file_%02d.go", i)
+		if fileCounts[path] != 1 {
+			t.Errorf("Expected %s exactly once, found %d times", path, fileCounts[path])
+		}
+	}
+
+	// The huge file is split into numbered parts
+	parts := 0
+	for header := range fileCounts {
+		if strings.HasPrefix(header, "huge.txt (part ") {
+			parts++
+		}
+	}
+	if parts < 2 {
+		t.Errorf("Expected huge.txt to be split into parts, got %d", parts)
+	}
+}
+
+func TestWriteChunkedDigest_Tokens(t *testing.T) {
+	filesData, stats := chunkTestData()
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+
+	paths, err := WriteChunkedDigest(outputFile, filesData[:10], stats, ChunkLimits{MaxTokens: 100000})
+	if err != nil {
+		t.Fatalf("WriteChunkedDigest failed: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Errorf("Expected a single chunk under a large limit, got %d", len(paths))
+	}
+}
+
+func TestWriteChunkedDigest_LimitTooSmall(t *testing.T) {
+	filesData, stats := chunkTestData()
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+
+	if _, err := WriteChunkedDigest(outputFile, filesData, stats, ChunkLimits{MaxBytes: 100}); err == nil {
+		t.Error("Expected error when the header and tree don't fit in a chunk")
+	}
+	if _, err := WriteChunkedDigest(outputFile, filesData, stats, ChunkLimits{}); err == nil {
+		t.Error("Expected error when no limit is set")
+	}
+}
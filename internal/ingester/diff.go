@@ -0,0 +1,511 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// DiffOptions selects the revisions a diff digest compares
+type DiffOptions struct {
+	Base    string // Revision the changes are made against, such as main
+	Head    string // Revision holding the changes (default: HEAD)
+	Related bool   // Also include unchanged files that reference a changed file
+}
+
+// head returns the head revision, defaulting to HEAD
+func (o DiffOptions) head() string {
+	if o.Head == "" {
+		return "HEAD"
+	}
+	return o.Head
+}
+
+// changedFile is a file that differs between the base and head of a diff
+type changedFile struct {
+	path   string // Path at head, or at base for deleted files
+	change *types.FileChange
+}
+
+// diffRecord is a file pair listed by git diff --raw
+type diffRecord struct {
+	skipped bool // Symbolic link or submodule, left out of the changes
+	patches int  // Sections of the file pair in git diff --patch
+}
+
+// DiffLocalDirectoryContext collects the files that changed between
+// options.Base and options.Head in the Git repository containing rootDir,
+// each with its patch and its content at the head revision. Neither revision
+// is checked out, so the working copy is left alone. Include and exclude
+// patterns, ignore files and config.Subdir select the files as they do for
+// a digest of the head revision.
+func DiffLocalDirectoryContext(ctx context.Context, rootDir string, options DiffOptions, config Config) ([]types.FileInfo, types.Stats, error) {
+	if options.Base == "" {
+		return nil, types.Stats{}, fmt.Errorf("a diff requires a base revision")
+	}
+
+	src, err := openRevision(ctx, rootDir, options.head())
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+	defer src.close()
+
+	baseCommit, err := gitOutput(ctx, rootDir, "rev-parse", "--verify", "--quiet", options.Base+"^{commit}")
+	if err != nil {
+		return nil, types.Stats{}, fmt.Errorf("revision %q not found in %s", options.Base, rootDir)
+	}
+
+	// Walk the head revision for the files the digest may include
+	progressReporter := newReporter(config.Progress)
+	stats, err := walkDirectory(ctx, src, config, progressReporter)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+	stats.Ref, stats.Commit = "", ""
+	stats.Diff = &types.DiffStats{
+		Base:       options.Base,
+		BaseCommit: baseCommit,
+		Head:       options.head(),
+		HeadCommit: src.commit,
+	}
+	included := make(map[string]bool, len(stats.AllPaths))
+	for _, relPath := range stats.AllPaths {
+		included[relPath] = true
+	}
+
+	changes, err := diffChanges(ctx, rootDir, baseCommit, src.commit)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	// Keep the changes inside the walked directory that the digest includes.
+	// Deleted files aren't in the head revision, so only patterns apply to them.
+	var prefix string
+	if stats.Subdir != "" {
+		prefix = stats.Subdir + "/"
+	}
+	var selected []changedFile
+	for _, changed := range changes {
+		if !strings.HasPrefix(changed.path, prefix) {
+			continue
+		}
+		changed.path = strings.TrimPrefix(changed.path, prefix)
+		changed.change.OldPath = strings.TrimPrefix(changed.change.OldPath, prefix)
+		if changed.change.Status == types.ChangeDeleted {
+			if !utils.ShouldIncludeFile(changed.path, config.IncludePatterns, config.ExcludePatterns) {
+				continue
+			}
+		} else if !included[changed.path] {
+			continue
+		}
+		selected = append(selected, changed)
+	}
+
+	var related []string
+	if options.Related {
+		related, err = relatedFiles(ctx, rootDir, src.commit, prefix, selected, included)
+		if err != nil {
+			return nil, types.Stats{}, err
+		}
+	}
+
+	files, _, err := src.files(stats.Subdir)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	// Read the head content of everything but deleted files
+	var readPaths []string
+	for _, changed := range selected {
+		if changed.change.Status != types.ChangeDeleted {
+			readPaths = append(readPaths, changed.path)
+		}
+	}
+	readPaths = append(readPaths, related...)
+	readData, err := readFiles(ctx, files, "", readPaths, config, progressReporter)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+	byPath := make(map[string]types.FileInfo, len(readData))
+	for _, fileInfo := range readData {
+		byPath[fileInfo.RelativePath] = fileInfo
+	}
+
+	var filesData []types.FileInfo
+	stats.AllPaths = nil
+	for _, changed := range selected {
+		fileInfo, ok := byPath[changed.path]
+		if !ok {
+			fileInfo = types.FileInfo{RelativePath: changed.path}
+		}
+		fileInfo.Change = changed.change
+		filesData = append(filesData, fileInfo)
+		addChangeStats(&stats, changed.change, config)
+	}
+	for _, relPath := range related {
+		fileInfo := byPath[relPath]
+		fileInfo.Related = true
+		filesData = append(filesData, fileInfo)
+		stats.Diff.RelatedFiles++
+	}
+	for _, fileInfo := range filesData {
+		stats.AllPaths = append(stats.AllPaths, fileInfo.RelativePath)
+		addFileStats(&stats, fileInfo)
+	}
+
+	return filesData, stats, nil
+}
+
+// DiffRemoteRepoContext fetches options.Base and options.Head of gitURL into
+// a temporary repository and collects their changes like
+// DiffLocalDirectoryContext. Only the two commits are fetched when the
+// server allows it. With config.CacheDir set, they come from an up-to-date
+// cached mirror.
+func DiffRemoteRepoContext(ctx context.Context, gitURL string, options DiffOptions, config Config) ([]types.FileInfo, types.Stats, error) {
+	if options.Base == "" {
+		return nil, types.Stats{}, fmt.Errorf("a diff requires a base revision")
+	}
+
+	fetchURL := gitURL
+	if config.CacheDir != "" {
+		mirrorURL, unlock, err := syncMirror(ctx, config.CacheDir, gitURL, config.Progress)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, types.Stats{}, ctx.Err()
+			}
+			return nil, types.Stats{}, fmt.Errorf("failed to update cached mirror: %w", err)
+		}
+		defer unlock()
+		fetchURL = mirrorURL
+	}
+
+	tempDir, err := os.MkdirTemp("", "gingest-diff-*")
+	if err != nil {
+		return nil, types.Stats{}, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := runGit(ctx, nil, "init", "--quiet", tempDir); err != nil {
+		return nil, types.Stats{}, err
+	}
+	if err := runGit(ctx, nil, "-C", tempDir, "remote", "add", "origin", fetchURL); err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	// The diff only needs the two trees, so neither commit needs history
+	fetch := append([]string{"-C", tempDir, "fetch"}, progressFlags(config.Progress)...)
+	fetched := options
+	for _, rev := range []*string{&fetched.Base, &fetched.Head} {
+		name := *rev
+		if name == "" {
+			name = "HEAD"
+		}
+		commit, err := fetchCommit(ctx, tempDir, fetchURL, name, 1, fetch, config.Progress)
+		if err != nil {
+			return nil, types.Stats{}, err
+		}
+		*rev = commit
+	}
+
+	filesData, stats, err := DiffLocalDirectoryContext(ctx, tempDir, fetched, config)
+	if err != nil {
+		return nil, types.Stats{}, fmt.Errorf("failed to diff fetched revisions: %w", err)
+	}
+	stats.Source = gitURL
+	stats.Diff.Base, stats.Diff.Head = options.Base, options.head()
+	return filesData, stats, nil
+}
+
+// diffChanges returns the files that differ between the commits base and
+// head, below rootDir and with paths relative to it, with renames detected.
+// Symbolic links and submodules are left out, as in a revision's tree.
+func diffChanges(ctx context.Context, rootDir, base, head string) ([]changedFile, error) {
+	raw, err := gitDiff(ctx, rootDir, "--raw", "-z", base, head)
+	if err != nil {
+		return nil, err
+	}
+	numstat, err := gitDiff(ctx, rootDir, "--numstat", "-z", base, head)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := gitDiff(ctx, rootDir, "--patch", base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, records, err := parseRawDiff(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseNumstat(numstat, changes, records); err != nil {
+		return nil, err
+	}
+	if err := splitPatch(patch, changes, records); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// gitDiff runs git diff in rootDir with rename detection, limited to rootDir
+// and with paths relative to it. External diff drivers and text conversion
+// are turned off, so the patches are plain unified diffs of the stored content.
+func gitDiff(ctx context.Context, rootDir string, args ...string) ([]byte, error) {
+	diffArgs := []string{"-C", rootDir, "diff", "--relative", "-M", "--no-color", "--no-ext-diff", "--no-textconv", "--src-prefix=a/", "--dst-prefix=b/"}
+	cmd := exec.CommandContext(ctx, "git", append(diffArgs, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+	return output, nil
+}
+
+// parseRawDiff parses the output of git diff --raw -z. It also returns every
+// record in order, including those skipped for symbolic links and
+// submodules, so the numstat records and patches can be matched up.
+func parseRawDiff(output []byte) ([]changedFile, []diffRecord, error) {
+	var changes []changedFile
+	var records []diffRecord
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		// :<old mode> SP <new mode> SP <old oid> SP <new oid> SP <status>, then
+		// the path, or the old and new paths for renames
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || i+1 >= len(fields) {
+			return nil, nil, fmt.Errorf("unexpected git diff output %q", fields[i])
+		}
+		status := meta[4]
+		changed := changedFile{path: fields[i+1], change: &types.FileChange{}}
+		i += 2
+
+		switch status[0] {
+		case 'A':
+			changed.change.Status = types.ChangeAdded
+		case 'D':
+			changed.change.Status = types.ChangeDeleted
+		case 'M', 'T':
+			changed.change.Status = types.ChangeModified
+		case 'R':
+			if i >= len(fields) {
+				return nil, nil, fmt.Errorf("unexpected git diff output %q", status)
+			}
+			changed.change.Status = types.ChangeRenamed
+			changed.change.OldPath, changed.path = changed.path, fields[i]
+			i++
+		default:
+			return nil, nil, fmt.Errorf("unexpected git diff status %q", status)
+		}
+
+		record := diffRecord{
+			skipped: !isRegularFileMode(meta[0]) || !isRegularFileMode(meta[1]),
+			patches: 1,
+		}
+		// A change between a file and a symbolic link or submodule is shown
+		// as a deletion and a creation
+		if meta[0] != "000000" && meta[1] != "000000" && meta[0][:2] != meta[1][:2] {
+			record.patches = 2
+		}
+		records = append(records, record)
+		if !record.skipped {
+			changes = append(changes, changed)
+		}
+	}
+	return changes, records, nil
+}
+
+// isRegularFileMode reports whether a mode from git diff --raw is a regular
+// file, or no file at all on the side where it was added or deleted
+func isRegularFileMode(mode string) bool {
+	return mode == "000000" || mode == "100644" || mode == "100755"
+}
+
+// parseNumstat adds the line counts from git diff --numstat -z to changes.
+// Binary files have "-" for both counts.
+func parseNumstat(output []byte, changes []changedFile, records []diffRecord) error {
+	fields := strings.Split(string(output), "\x00")
+	record, next := 0, 0
+	for i := 0; i < len(fields) && fields[i] != ""; record++ {
+		// <added> TAB <deleted> TAB <path>, or an empty path followed by the
+		// old and new paths for renames
+		counts := strings.SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			return fmt.Errorf("unexpected git diff output %q", fields[i])
+		}
+		i++
+		if counts[2] == "" {
+			i += 2
+		}
+
+		if record >= len(records) {
+			return errors.New("git diff --numstat and --raw disagree")
+		}
+		if records[record].skipped {
+			continue
+		}
+		if next >= len(changes) {
+			return errors.New("git diff --numstat and --raw disagree")
+		}
+		change := changes[next].change
+		next++
+
+		if counts[0] == "-" && counts[1] == "-" {
+			change.Binary = true
+			continue
+		}
+		change.Additions, _ = strconv.Atoi(counts[0])
+		change.Deletions, _ = strconv.Atoi(counts[1])
+	}
+	return nil
+}
+
+// splitPatch splits the output of git diff --patch into the patches of
+// changes. Each section starts with a "diff --git" line, in the order of
+// the git diff --raw records.
+func splitPatch(output []byte, changes []changedFile, records []diffRecord) error {
+	text := string(output)
+	if text != "" && !strings.HasPrefix(text, "diff --git ") {
+		return fmt.Errorf("unexpected git diff output %q", strings.SplitN(text, "\n", 2)[0])
+	}
+	var sections []string
+	for text != "" {
+		end := strings.Index(text, "\ndiff --git ") + 1
+		if end == 0 {
+			end = len(text)
+		}
+		sections = append(sections, text[:end])
+		text = text[end:]
+	}
+
+	next := 0
+	for _, record := range records {
+		if len(sections) < record.patches {
+			return errors.New("git diff --patch and --raw disagree")
+		}
+		if !record.skipped {
+			changes[next].change.Patch = sections[0]
+			next++
+		}
+		sections = sections[record.patches:]
+	}
+	if len(sections) > 0 {
+		return errors.New("git diff --patch and --raw disagree")
+	}
+	return nil
+}
+
+// addChangeStats accumulates the diff statistics for a changed file. Patches
+// count towards the digest's size and tokens like file content.
+func addChangeStats(stats *types.Stats, change *types.FileChange, config Config) {
+	diff := stats.Diff
+	diff.FilesChanged++
+	switch change.Status {
+	case types.ChangeAdded:
+		diff.FilesAdded++
+	case types.ChangeModified:
+		diff.FilesModified++
+	case types.ChangeDeleted:
+		diff.FilesDeleted++
+	case types.ChangeRenamed:
+		diff.FilesRenamed++
+	}
+	if change.Binary {
+		diff.BinaryChanges++
+	}
+	diff.LinesAdded += change.Additions
+	diff.LinesRemoved += change.Deletions
+
+	stats.TotalContentBytes += int64(len(change.Patch))
+	stats.TotalTokens += tokenizer.Or(config.TokenEstimator).CountTokens(change.Patch)
+}
+
+// relatedFiles returns the files at the head commit, relative to the walked
+// directory, that aren't changed themselves but mention a changed file by
+// one of its referenceKeys. Only files the digest includes are returned.
+func relatedFiles(ctx context.Context, rootDir, head, prefix string, changes []changedFile, included map[string]bool) ([]string, error) {
+	changed := make(map[string]bool)
+	seen := make(map[string]bool)
+	var args []string
+	for _, c := range changes {
+		changed[c.path] = true
+		for _, name := range []string{c.path, c.change.OldPath} {
+			if name == "" {
+				continue
+			}
+			for _, key := range referenceKeys(prefix + name) {
+				if !seen[key] {
+					seen[key] = true
+					args = append(args, "-e", key)
+				}
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	// git grep run below the top of the work tree searches that directory
+	// only, with paths relative to it
+	grepArgs := append([]string{"-C", rootDir, "grep", "-l", "-z", "-I", "-F"}, args...)
+	cmd := exec.CommandContext(ctx, "git", append(grepArgs, head)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil // No matches
+		}
+		return nil, fmt.Errorf("git grep failed: %w", err)
+	}
+
+	var related []string
+	for _, match := range bytes.Split(output, []byte{0}) {
+		// <commit>:<path>
+		name := strings.TrimPrefix(string(match), head+":")
+		if name == "" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if included[name] && !changed[name] {
+			related = append(related, name)
+		}
+	}
+	return related, nil
+}
+
+// referenceKeys returns the strings that suggest a file refers to relPath:
+// its file name, its name without extension as used by JavaScript and
+// Python imports, and for Go files the import path suffix of its package
+func referenceKeys(relPath string) []string {
+	stem := strings.TrimSuffix(path.Base(relPath), path.Ext(relPath))
+	keys := []string{path.Base(relPath), "./" + stem}
+
+	dir := path.Dir(relPath)
+	if dir == "." {
+		return keys
+	}
+	parent := path.Base(dir)
+	keys = append(keys, parent+"/"+stem, parent+"."+stem)
+
+	if path.Ext(relPath) == ".go" {
+		pkg := "/" + parent
+		if grandparent := path.Dir(dir); grandparent != "." {
+			pkg = path.Base(grandparent) + pkg
+		}
+		keys = append(keys, pkg+`"`)
+	}
+	return keys
+}
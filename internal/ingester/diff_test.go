@@ -0,0 +1,306 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// createDiffRepo builds a work tree whose HEAD modifies, adds, deletes and
+// renames files relative to the tag base, and returns its directory
+func createDiffRepo(t *testing.T) string {
+	t.Helper()
+	isolateGit(t)
+
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{
+		"README.md":      "# App\n",
+		"main.go":        "package main\n\nimport \"example.com/app/pkg/lib\"\n\nfunc main() { lib.Run() }\n",
+		"pkg/lib/lib.go": "package lib\n\nfunc Run() {}\n",
+		"docs/old.md":    "# Guide\n\nLine one\nLine two\nLine three\n",
+		"docs/index.md":  "See guide.md\n",
+		"notes.txt":      "remove me\n",
+		"image.bin":      "\x00\x01",
+		"deps.lock":      "v1\n",
+	})
+	testGit(t, dir, nil, "init", "--quiet", "--initial-branch=main")
+	testGit(t, dir, nil, "add", ".")
+	testGit(t, dir, nil, "commit", "--quiet", "-m", "base")
+	testGit(t, dir, nil, "tag", "base")
+
+	createWalkTestFiles(t, dir, map[string]string{
+		"pkg/lib/lib.go": "package lib\n\nfunc Run() { println(1) }\n",
+		"pkg/lib/new.go": "package lib\n",
+		"image.bin":      "\x00\x02",
+		"deps.lock":      "v2\n",
+	})
+	testGit(t, dir, nil, "mv", "docs/old.md", "docs/guide.md")
+	testGit(t, dir, nil, "rm", "--quiet", "notes.txt")
+	testGit(t, dir, nil, "add", ".")
+	testGit(t, dir, nil, "commit", "--quiet", "-m", "change")
+
+	// Uncommitted work that the diff must not see
+	createWalkTestFiles(t, dir, map[string]string{"README.md": "# Work in progress\n"})
+	return dir
+}
+
+// diffFiles indexes the files of a diff digest by path
+func diffFiles(t *testing.T, filesData []types.FileInfo) map[string]types.FileInfo {
+	t.Helper()
+	files := make(map[string]types.FileInfo)
+	for _, fileInfo := range filesData {
+		if fileInfo.Error != nil {
+			t.Errorf("Unexpected error for %s: %v", fileInfo.RelativePath, fileInfo.Error)
+		}
+		files[fileInfo.RelativePath] = fileInfo
+	}
+	return files
+}
+
+// checkDiffChanges checks the changes of the repository from createDiffRepo
+func checkDiffChanges(t *testing.T, files map[string]types.FileInfo, stats types.Stats) {
+	t.Helper()
+	expected := map[string]types.FileChange{
+		"pkg/lib/lib.go": {Status: types.ChangeModified, Additions: 1, Deletions: 1},
+		"pkg/lib/new.go": {Status: types.ChangeAdded, Additions: 1},
+		"docs/guide.md":  {Status: types.ChangeRenamed, OldPath: "docs/old.md"},
+		"notes.txt":      {Status: types.ChangeDeleted, Deletions: 1},
+		"image.bin":      {Status: types.ChangeModified, Binary: true},
+	}
+	for name, change := range expected {
+		fileInfo, ok := files[name]
+		if !ok || fileInfo.Change == nil {
+			t.Errorf("Expected %s to be changed, got %+v", name, fileInfo)
+			continue
+		}
+		actual := *fileInfo.Change
+		actual.Patch = ""
+		if actual != change {
+			t.Errorf("Expected %s to be %+v, got %+v", name, change, actual)
+		}
+		header, _, _ := strings.Cut(fileInfo.Change.Patch, "\n")
+		if header != "diff --git a/"+oldPath(name, change)+" b/"+name || strings.Count(fileInfo.Change.Patch, "diff --git ") != 1 {
+			t.Errorf("Expected the patch of %s alone, got %q", name, fileInfo.Change.Patch)
+		}
+	}
+	if _, ok := files["deps.lock"]; ok {
+		t.Error("Expected the excluded deps.lock to be left out")
+	}
+
+	if !strings.Contains(files["pkg/lib/lib.go"].Change.Patch, "+func Run() { println(1) }\n") {
+		t.Errorf("Expected the added line in the patch, got:\n%s", files["pkg/lib/lib.go"].Change.Patch)
+	}
+	if files["pkg/lib/lib.go"].Content != "package lib\n\nfunc Run() { println(1) }\n" {
+		t.Errorf("Expected the head content of lib.go, got %q", files["pkg/lib/lib.go"].Content)
+	}
+	if files["docs/guide.md"].Content != "# Guide\n\nLine one\nLine two\nLine three\n" {
+		t.Errorf("Expected the content of the renamed file, got %q", files["docs/guide.md"].Content)
+	}
+	if files["notes.txt"].Content != "" {
+		t.Errorf("Expected no content for a deleted file, got %q", files["notes.txt"].Content)
+	}
+	if !files["image.bin"].IsBinary {
+		t.Error("Expected image.bin to be read as binary")
+	}
+
+	diff := stats.Diff
+	if diff == nil {
+		t.Fatal("Expected diff statistics")
+	}
+	if diff.Base != "base" || len(diff.BaseCommit) != 40 || len(diff.HeadCommit) != 40 {
+		t.Errorf("Expected base and head commits, got %+v", diff)
+	}
+	counts := []int{diff.FilesChanged, diff.FilesAdded, diff.FilesModified, diff.FilesDeleted, diff.FilesRenamed, diff.BinaryChanges, diff.LinesAdded, diff.LinesRemoved}
+	expectedCounts := []int{5, 1, 2, 1, 1, 1, 2, 2}
+	for i := range counts {
+		if counts[i] != expectedCounts[i] {
+			t.Errorf("Expected counts %v, got %v", expectedCounts, counts)
+			break
+		}
+	}
+}
+
+// oldPath returns the path of a changed file at the base
+func oldPath(name string, change types.FileChange) string {
+	if change.OldPath != "" {
+		return change.OldPath
+	}
+	return name
+}
+
+func TestDiffLocalDirectory(t *testing.T) {
+	dir := createDiffRepo(t)
+	config := Config{ExcludePatterns: []string{"*.lock"}}
+
+	filesData, stats, err := DiffLocalDirectoryContext(context.Background(), dir, DiffOptions{Base: "base"}, config)
+	if err != nil {
+		t.Fatalf("DiffLocalDirectoryContext failed: %v", err)
+	}
+	files := diffFiles(t, filesData)
+	checkDiffChanges(t, files, stats)
+
+	if len(files) != 5 {
+		t.Errorf("Expected only the changed files, got %v", stats.AllPaths)
+	}
+	if stats.Diff.Head != "HEAD" || stats.Commit != "" {
+		t.Errorf("Expected head HEAD without a commit line, got %q and %q", stats.Diff.Head, stats.Commit)
+	}
+}
+
+func TestDiffLocalDirectory_TypeChange(t *testing.T) {
+	isolateGit(t)
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{"a.txt": "a\n", "link": "target\n", "z.txt": "z\n"})
+	testGit(t, dir, nil, "init", "--quiet")
+	testGit(t, dir, nil, "add", ".")
+	testGit(t, dir, nil, "commit", "--quiet", "-m", "base")
+
+	// The file turned symbolic link is shown as two patches, which must not
+	// shift the patches of the files after it
+	if err := os.Remove(filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	commitFiles(t, dir, nil, "change", map[string]string{"a.txt": "a2\n", "z.txt": "z2\n"})
+
+	filesData, _, err := DiffLocalDirectoryContext(context.Background(), dir, DiffOptions{Base: "HEAD~"}, Config{})
+	if err != nil {
+		t.Fatalf("DiffLocalDirectoryContext failed: %v", err)
+	}
+	files := diffFiles(t, filesData)
+	if len(files) != 2 {
+		t.Fatalf("Expected the symbolic link to be left out, got %v", files)
+	}
+	for name, line := range map[string]string{"a.txt": "+a2\n", "z.txt": "+z2\n"} {
+		patch := files[name].Change.Patch
+		if !strings.HasPrefix(patch, "diff --git a/"+name+" ") || !strings.Contains(patch, line) || strings.Count(patch, "diff --git ") != 1 {
+			t.Errorf("Expected the patch of %s alone, got %q", name, patch)
+		}
+	}
+}
+
+func TestDiffLocalDirectory_Related(t *testing.T) {
+	dir := createDiffRepo(t)
+	config := Config{ExcludePatterns: []string{"*.lock"}}
+
+	filesData, stats, err := DiffLocalDirectoryContext(context.Background(), dir, DiffOptions{Base: "base", Head: "main", Related: true}, config)
+	if err != nil {
+		t.Fatalf("DiffLocalDirectoryContext failed: %v", err)
+	}
+	files := diffFiles(t, filesData)
+
+	for _, name := range []string{"main.go", "docs/index.md"} {
+		if !files[name].Related || files[name].Change != nil || files[name].Content == "" {
+			t.Errorf("Expected %s to be included as related, got %+v", name, files[name])
+		}
+	}
+	if _, ok := files["README.md"]; ok {
+		t.Error("Expected the unrelated README.md to be left out")
+	}
+	if stats.Diff.RelatedFiles != 2 || len(files) != 7 {
+		t.Errorf("Expected 5 changed and 2 related files, got %v", stats.AllPaths)
+	}
+}
+
+func TestDiffLocalDirectory_Subdir(t *testing.T) {
+	dir := createDiffRepo(t)
+
+	filesData, stats, err := DiffLocalDirectoryContext(context.Background(), dir, DiffOptions{Base: "base"}, Config{Subdir: "pkg"})
+	if err != nil {
+		t.Fatalf("DiffLocalDirectoryContext failed: %v", err)
+	}
+	if strings.Join(stats.AllPaths, ",") != "lib/lib.go,lib/new.go" || len(filesData) != 2 {
+		t.Errorf("Expected the changes below pkg, got %v", stats.AllPaths)
+	}
+	if stats.Diff.FilesChanged != 2 {
+		t.Errorf("Expected 2 files changed, got %d", stats.Diff.FilesChanged)
+	}
+}
+
+func TestDiffLocalDirectory_Errors(t *testing.T) {
+	dir := createDiffRepo(t)
+
+	testCases := []struct {
+		options  DiffOptions
+		expected string
+		desc     string
+	}{
+		{DiffOptions{}, "requires a base revision", "Missing base"},
+		{DiffOptions{Base: "no-such-rev"}, `revision "no-such-rev" not found`, "Unknown base"},
+		{DiffOptions{Base: "base", Head: "no-such-rev"}, `revision "no-such-rev" not found`, "Unknown head"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, _, err := DiffLocalDirectoryContext(context.Background(), dir, tc.options, Config{})
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestDiffRemoteRepo(t *testing.T) {
+	dir := createDiffRepo(t)
+	url := fileURL(dir)
+
+	for _, cacheDir := range []string{"", t.TempDir()} {
+		config := Config{ExcludePatterns: []string{"*.lock"}, CacheDir: cacheDir}
+		filesData, stats, err := DiffRemoteRepoContext(context.Background(), url, DiffOptions{Base: "base", Head: "main"}, config)
+		if err != nil {
+			t.Fatalf("DiffRemoteRepoContext failed: %v", err)
+		}
+		checkDiffChanges(t, diffFiles(t, filesData), stats)
+		if stats.Source != url || stats.Diff.Head != "main" {
+			t.Errorf("Expected source %s at main, got %s at %s", url, stats.Source, stats.Diff.Head)
+		}
+	}
+}
+
+func TestWriteDigest_Diff(t *testing.T) {
+	dir := createDiffRepo(t)
+	filesData, stats, err := DiffLocalDirectoryContext(context.Background(), dir, DiffOptions{Base: "base"}, Config{ExcludePatterns: []string{"*.lock"}})
+	if err != nil {
+		t.Fatalf("DiffLocalDirectoryContext failed: %v", err)
+	}
+
+	var digest bytes.Buffer
+	if err := WriteDigestTo(&digest, filesData, stats); err != nil {
+		t.Fatalf("WriteDigestTo failed: %v", err)
+	}
+	output := digest.String()
+
+	expected := []string{
+		"**Files Changed:** 5 (1 added, 2 modified, 1 deleted, 1 renamed)",
+		"guide.md (renamed from docs/old.md, +0 -0",
+		"notes.txt (deleted, +0 -1)",
+		"DIFF: docs/guide.md (renamed from docs/old.md, +0 -0)\n",
+		"DIFF: image.bin (modified, binary)\n",
+		"DIFF: notes.txt (deleted, +0 -1)\n",
+		"FILE: pkg/lib/lib.go\n",
+	}
+	for _, text := range expected {
+		if !strings.Contains(output, text) {
+			t.Errorf("Expected %q in digest:\n%s", text, output)
+		}
+	}
+	if strings.Contains(output, "FILE: notes.txt") {
+		t.Error("Expected no file block for the deleted file")
+	}
+	if strings.Index(output, "DIFF: pkg/lib/lib.go") > strings.Index(output, "FILE: pkg/lib/lib.go") {
+		t.Error("Expected the patch before the content")
+	}
+
+	// The working copy is untouched
+	content, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil || string(content) != "# Work in progress\n" {
+		t.Errorf("Expected the working copy to keep its changes, got %q (%v)", content, err)
+	}
+}
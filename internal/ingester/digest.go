@@ -1,10 +1,15 @@
 package ingester
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/prashanth1k/gingest/internal/types"
 	"github.com/prashanth1k/gingest/internal/utils"
@@ -15,102 +20,297 @@ const (
 	FILE_SEPARATOR_END   = "================================================"
 )
 
+// Format identifies an output format for digests
+type Format string
+
+// Supported digest output formats
+const (
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+	FormatJSONL    Format = "jsonl"
+	FormatXML      Format = "xml"
+)
+
+// ParseFormat converts a format name into a Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "markdown", "md", "text":
+		return FormatMarkdown, nil
+	case "json":
+		return FormatJSON, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "xml":
+		return FormatXML, nil
+	}
+	return "", fmt.Errorf("unsupported format %q (expected markdown, json, jsonl or xml)", name)
+}
+
 // WriteDigest writes the collected file data to the output file with summary
 func WriteDigest(outputFilePath string, filesData []types.FileInfo, stats types.Stats) error {
-	// Partition files into README and other files
-	var readmeFiles []types.FileInfo
-	var otherFiles []types.FileInfo
+	return WriteDigestFileFormat(outputFilePath, FormatMarkdown, filesData, stats)
+}
+
+// WriteDigestFileFormat writes the collected file data to the output file in the given format
+func WriteDigestFileFormat(outputFilePath string, format Format, filesData []types.FileInfo, stats types.Stats) error {
+	return WriteDigestFileFormatContext(context.Background(), outputFilePath, format, filesData, stats)
+}
+
+// WriteDigestFileFormatContext writes the collected file data to the output
+// file in the given format. If writing fails or ctx is cancelled, the partial
+// file is removed.
+func WriteDigestFileFormatContext(ctx context.Context, outputFilePath string, format Format, filesData []types.FileInfo, stats types.Stats) error {
+	return WriteFile(outputFilePath, func(w io.Writer) error {
+		return WriteDigestFormatContext(ctx, w, format, filesData, stats)
+	})
+}
+
+// WriteFile creates outputFilePath and calls write with it. If write or
+// closing the file fails, the partial file is removed.
+func WriteFile(outputFilePath string, write func(w io.Writer) error) error {
+	// Create output file
+	file, err := os.Create(outputFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	if err := write(file); err != nil {
+		file.Close()
+		os.Remove(outputFilePath)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(outputFilePath)
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+
+	return nil
+}
 
+// WriteDigestFormatContext writes the collected file data to w in the given
+// format, failing with ctx.Err() once ctx is cancelled
+func WriteDigestFormatContext(ctx context.Context, w io.Writer, format Format, filesData []types.FileInfo, stats types.Stats) error {
+	return WriteDigestFormat(contextWriter{ctx: ctx, w: w}, format, filesData, stats)
+}
+
+// contextWriter fails writes once its context is cancelled, so a long digest
+// stops promptly without every writer checking the context itself
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// WriteDigestFormat writes the collected file data to w in the given format
+func WriteDigestFormat(w io.Writer, format Format, filesData []types.FileInfo, stats types.Stats) error {
+	switch format {
+	case FormatMarkdown, "":
+		return WriteDigestTo(w, filesData, stats)
+	case FormatJSON:
+		return WriteJSONDigest(w, filesData, stats)
+	case FormatJSONL:
+		return WriteJSONLDigest(w, filesData, stats)
+	case FormatXML:
+		return WriteXMLDigest(w, filesData, stats)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// orderFiles drops files with errors or omitted content and returns them by
+// Rank, or README files first and then all other files, each group sorted by
+// RelativePath. In diff digests, files related to the changes come after the
+// changed files.
+func orderFiles(filesData []types.FileInfo) []types.FileInfo {
+	var ordered []types.FileInfo
 	for _, fileInfo := range filesData {
-		// Skip files with errors
-		if fileInfo.Error != nil {
+		// Skip files with errors and files left out by a token budget
+		if fileInfo.Error != nil || fileInfo.Omitted {
 			continue
 		}
-
-		fileName := filepath.Base(fileInfo.RelativePath)
-		if utils.IsReadmeFile(fileName) {
-			readmeFiles = append(readmeFiles, fileInfo)
-		} else {
-			otherFiles = append(otherFiles, fileInfo)
-		}
+		ordered = append(ordered, fileInfo)
 	}
 
-	// Sort both groups by RelativePath
-	sort.Slice(readmeFiles, func(i, j int) bool {
-		return readmeFiles[i].RelativePath < readmeFiles[j].RelativePath
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Related != ordered[j].Related {
+			return ordered[j].Related
+		}
+		if ordered[i].Rank != ordered[j].Rank {
+			return ordered[i].Rank < ordered[j].Rank
+		}
+		return digestLess(ordered[i].RelativePath, ordered[j].RelativePath)
 	})
-	sort.Slice(otherFiles, func(i, j int) bool {
-		return otherFiles[i].RelativePath < otherFiles[j].RelativePath
+
+	return ordered
+}
+
+// orderPaths returns a copy of paths in digest order, by ranks from
+// rankFiles when they are set
+func orderPaths(paths []string, ranks map[string]int) []string {
+	ordered := append([]string(nil), paths...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ranks[ordered[i]] != ranks[ordered[j]] {
+			return ranks[ordered[i]] < ranks[ordered[j]]
+		}
+		return digestLess(ordered[i], ordered[j])
 	})
+	return ordered
+}
 
-	// Create output file
-	file, err := os.Create(outputFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+// digestLess orders README files before all other files, and paths
+// alphabetically within each group
+func digestLess(a, b string) bool {
+	readmeA := utils.IsReadmeFile(filepath.Base(a))
+	readmeB := utils.IsReadmeFile(filepath.Base(b))
+	if readmeA != readmeB {
+		return readmeA
+	}
+	return a < b
+}
+
+// treeString renders the directory tree for the digest, or "" if there are no paths
+func treeString(filesData []types.FileInfo, stats types.Stats) string {
+	if len(stats.AllPaths) == 0 {
+		return ""
 	}
-	defer file.Close()
+
+	rootName := filepath.Base(stats.Source)
+	if stats.Subdir != "" {
+		rootName = path.Base(stats.Subdir)
+	}
+	if rootName == "." || rootName == "" {
+		rootName = "project"
+	}
+	return utils.GenerateTreeString(stats.AllPaths, rootName, filesData)
+}
+
+// treeSection renders the Markdown directory structure section, or "" if there are no paths
+func treeSection(filesData []types.FileInfo, stats types.Stats) string {
+	tree := treeString(filesData, stats)
+	if tree == "" {
+		return ""
+	}
+	fence := utils.CodeFence(tree)
+	return "## Directory Structure\n\n" + fence + "\n" + tree + fence + "\n\n---\n\n"
+}
+
+// WriteDigestTo writes the collected file data with summary to w
+func WriteDigestTo(w io.Writer, filesData []types.FileInfo, stats types.Stats) error {
+	// Buffer writes so unbuffered destinations such as stdout or pipes are not hit per line
+	file := bufio.NewWriter(w)
 
 	// Write summary at the beginning
 	summary := utils.GenerateSummaryString(stats)
-	_, err = file.WriteString(summary)
+	_, err := file.WriteString(summary)
 	if err != nil {
 		return fmt.Errorf("failed to write summary: %w", err)
 	}
 
-	// Write directory tree if we have paths
-	if len(stats.AllPaths) > 0 {
-		rootName := filepath.Base(stats.Source)
-		if rootName == "." || rootName == "" {
-			rootName = "project"
-		}
-		tree := utils.GenerateTreeString(stats.AllPaths, rootName, filesData)
-		_, err = file.WriteString("## Directory Structure\n\n```\n")
-		if err != nil {
-			return fmt.Errorf("failed to write tree header: %w", err)
-		}
-		_, err = file.WriteString(tree)
-		if err != nil {
-			return fmt.Errorf("failed to write tree: %w", err)
-		}
-		_, err = file.WriteString("```\n\n---\n\n")
-		if err != nil {
-			return fmt.Errorf("failed to write tree footer: %w", err)
+	// Write recent history and the directory tree if there are any
+	_, err = file.WriteString(utils.GenerateHistoryString(stats.History) + treeSection(filesData, stats))
+	if err != nil {
+		return fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	// Write each file's content, README files first
+	for _, fileInfo := range orderFiles(filesData) {
+		if err := writeFileBlock(file, fileInfo); err != nil {
+			return err
 		}
 	}
 
-	// Write README files first, then other files
-	allFiles := append(readmeFiles, otherFiles...)
+	if err := file.Flush(); err != nil {
+		return fmt.Errorf("failed to flush digest: %w", err)
+	}
 
-	// Write each file's content
-	for _, fileInfo := range allFiles {
-		// Write file separator and header
-		_, err := fmt.Fprintf(file, "%s\n", FILE_SEPARATOR_START)
-		if err != nil {
-			return fmt.Errorf("failed to write separator: %w", err)
-		}
+	return nil
+}
 
-		_, err = fmt.Fprintf(file, "FILE: %s\n", fileInfo.RelativePath)
-		if err != nil {
-			return fmt.Errorf("failed to write file header: %w", err)
-		}
+// fileFooter is written after each file's content
+const fileFooter = "\n\n"
 
-		_, err = fmt.Fprintf(file, "%s\n", FILE_SEPARATOR_END)
-		if err != nil {
-			return fmt.Errorf("failed to write separator: %w", err)
-		}
+// fence returns the lines around content in a fenced code block: an opening
+// fence tagged with lang and a closing fence longer than any backtick run in
+// content, so the content can't end the block early
+func fence(content, lang string) (string, string) {
+	ticks := utils.CodeFence(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		return ticks + lang + "\n", "\n" + ticks
+	}
+	return ticks + lang + "\n", ticks
+}
 
-		// Write file content
-		_, err = fmt.Fprintf(file, "%s", fileInfo.Content)
-		if err != nil {
-			return fmt.Errorf("failed to write file content: %w", err)
-		}
+// fileLanguage returns the code block language of a file, as detected when
+// it was read or else from its path and content
+func fileLanguage(fileInfo types.FileInfo) string {
+	if fileInfo.Language != "" {
+		return fileInfo.Language
+	}
+	return utils.DetectLanguage(fileInfo.RelativePath, fileInfo.Content)
+}
+
+// contentFence returns the fence lines around a file's content, tagged with
+// lang. Skipped files have a notice instead of their content and aren't fenced.
+func contentFence(fileInfo types.FileInfo, lang string) (string, string) {
+	if fileInfo.SkipReason != "" {
+		return "", ""
+	}
+	return fence(fileInfo.Content, lang)
+}
+
+// fileHeader returns the separator banner written before a file's content,
+// naming the last commit that changed the file when history is included
+func fileHeader(relPath string, lastCommit *types.Commit) string {
+	if lastCommit != nil {
+		return fmt.Sprintf("%s\nFILE: %s\nLAST MODIFIED: %s\n%s\n", FILE_SEPARATOR_START, relPath, utils.FormatLastCommit(lastCommit), FILE_SEPARATOR_END)
+	}
+	return fmt.Sprintf("%s\nFILE: %s\n%s\n", FILE_SEPARATOR_START, relPath, FILE_SEPARATOR_END)
+}
 
-		// Write two newlines after content
-		_, err = fmt.Fprintf(file, "\n\n")
+// diffHeader returns the separator banner written before a changed file's patch
+func diffHeader(fileInfo types.FileInfo) string {
+	return fmt.Sprintf("%s\nDIFF: %s (%s)\n%s\n", FILE_SEPARATOR_START, fileInfo.RelativePath, utils.FormatChange(fileInfo.Change), FILE_SEPARATOR_END)
+}
+
+// writeFileBlock writes a single file's separator, header and content, as a
+// code block tagged with the file's language. In diff digests, a changed
+// file's patch comes first, and deleted files have only their patch.
+func writeFileBlock(w io.Writer, fileInfo types.FileInfo) error {
+	if fileInfo.Change != nil {
+		open, closing := fence(fileInfo.Change.Patch, "diff")
+		_, err := io.WriteString(w, diffHeader(fileInfo)+open+fileInfo.Change.Patch+closing+fileFooter)
 		if err != nil {
-			return fmt.Errorf("failed to write newlines: %w", err)
+			return fmt.Errorf("failed to write patch: %w", err)
+		}
+		if fileInfo.Change.Status == types.ChangeDeleted {
+			return nil
 		}
 	}
 
+	// Write file separator and header
+	_, err := io.WriteString(w, fileHeader(fileInfo.RelativePath, fileInfo.LastCommit))
+	if err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
+	}
+
+	// Write file content
+	open, closing := contentFence(fileInfo, fileLanguage(fileInfo))
+	_, err = fmt.Fprintf(w, "%s%s%s", open, fileInfo.Content, closing)
+	if err != nil {
+		return fmt.Errorf("failed to write file content: %w", err)
+	}
+
+	// Write two newlines after content
+	_, err = io.WriteString(w, fileFooter)
+	if err != nil {
+		return fmt.Errorf("failed to write newlines: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,253 @@
+package ingester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+func sampleDigestData() ([]types.FileInfo, types.Stats) {
+	filesData := []types.FileInfo{
+		{RelativePath: "src/main.go", Content: "package main\n", Size: 13},
+		{RelativePath: "README.md", Content: "# Title\n================\n", Size: 25},
+		{RelativePath: "logo.bin", Content: "[Binary File]", Size: 4, IsBinary: true, SkipReason: types.SkipReasonBinary},
+		{RelativePath: "broken.txt", Error: errors.New("permission denied")},
+	}
+	stats := types.Stats{
+		NumFilesProcessed: 4,
+		NumDirsProcessed:  1,
+		NumBinaryFiles:    1,
+		Source:            "/tmp/project",
+		AllPaths:          []string{"README.md", "broken.txt", "logo.bin", "src/main.go"},
+	}
+	return filesData, stats
+}
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected Format
+		wantErr  bool
+	}{
+		{"", FormatMarkdown, false},
+		{"markdown", FormatMarkdown, false},
+		{"MD", FormatMarkdown, false},
+		{"json", FormatJSON, false},
+		{"jsonl", FormatJSONL, false},
+		{"ndjson", FormatJSONL, false},
+		{"yaml", "", true},
+	}
+
+	for _, tc := range testCases {
+		format, err := ParseFormat(tc.name)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseFormat(%q) error = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if format != tc.expected {
+			t.Errorf("ParseFormat(%q) = %q, expected %q", tc.name, format, tc.expected)
+		}
+	}
+}
+
+func TestWriteDigestTo(t *testing.T) {
+	filesData, stats := sampleDigestData()
+
+	var buf bytes.Buffer
+	if err := WriteDigestTo(&buf, filesData, stats); err != nil {
+		t.Fatalf("WriteDigestTo failed: %v", err)
+	}
+
+	digest := buf.String()
+	readmeIndex := strings.Index(digest, "FILE: README.md")
+	mainIndex := strings.Index(digest, "FILE: src/main.go")
+	if readmeIndex == -1 || mainIndex == -1 || readmeIndex > mainIndex {
+		t.Error("README.md should be written before other files")
+	}
+	if strings.Contains(digest, "FILE: broken.txt") {
+		t.Error("Files with errors should not be written")
+	}
+	if !strings.Contains(digest, "logo.bin (Binary)") {
+		t.Error("Binary files should be marked in the tree")
+	}
+}
+
+func TestWriteDigestTo_Fences(t *testing.T) {
+	filesData := []types.FileInfo{
+		{RelativePath: "main.go", Content: "package main\n"},
+		{RelativePath: "docs/guide.md", Content: "# Guide\n\n```go\nfunc main() {}\n```\n\n````\nnested\n````\n"},
+		{RelativePath: "bin/tool", Content: "#!/usr/bin/env python3\nprint(1)"},
+		{RelativePath: "logo.bin", Content: "[Binary File]", IsBinary: true, SkipReason: types.SkipReasonBinary},
+	}
+	stats := types.Stats{Source: "project", AllPaths: []string{"bin/tool", "docs/guide.md", "logo.bin", "main.go"}}
+
+	var buf bytes.Buffer
+	if err := WriteDigestTo(&buf, filesData, stats); err != nil {
+		t.Fatalf("WriteDigestTo failed: %v", err)
+	}
+	digest := buf.String()
+
+	expected := []string{
+		"FILE: main.go\n================================================\n```go\npackage main\n```\n\n",
+		"FILE: docs/guide.md\n================================================\n`````markdown\n# Guide\n",
+		"nested\n````\n`````\n\n",
+		"FILE: bin/tool\n================================================\n```python\n#!/usr/bin/env python3\nprint(1)\n```\n\n",
+		"FILE: logo.bin\n================================================\n[Binary File]\n\n",
+	}
+	for _, text := range expected {
+		if !strings.Contains(digest, text) {
+			t.Errorf("Expected %q in digest:\n%s", text, digest)
+		}
+	}
+
+	// Each code block closes at the fence that opened it, so the content comes back intact
+	contents := make(map[string]string)
+	lines := strings.SplitAfter(digest, "\n")
+	for i := 0; i < len(lines); i++ {
+		relPath, ok := strings.CutPrefix(lines[i], "FILE: ")
+		if !ok || i+2 >= len(lines) || !strings.HasPrefix(lines[i+2], "`") {
+			continue
+		}
+		fence := strings.TrimRight(lines[i+2], "abcdefghijklmnopqrstuvwxyz\n")
+		var content strings.Builder
+		for i += 3; i < len(lines) && strings.TrimSuffix(lines[i], "\n") != fence; i++ {
+			content.WriteString(lines[i])
+		}
+		contents[strings.TrimSuffix(relPath, "\n")] = content.String()
+	}
+	for _, fileInfo := range filesData[:2] {
+		if contents[fileInfo.RelativePath] != fileInfo.Content {
+			t.Errorf("Expected %s to round-trip, got %q", fileInfo.RelativePath, contents[fileInfo.RelativePath])
+		}
+	}
+}
+
+func TestWriteJSONDigest(t *testing.T) {
+	filesData, stats := sampleDigestData()
+
+	var buf bytes.Buffer
+	if err := WriteJSONDigest(&buf, filesData, stats); err != nil {
+		t.Fatalf("WriteJSONDigest failed: %v", err)
+	}
+
+	var digest jsonDigest
+	if err := json.Unmarshal(buf.Bytes(), &digest); err != nil {
+		t.Fatalf("Digest is not valid JSON: %v", err)
+	}
+
+	if digest.Stats.NumFilesProcessed != 4 || digest.Stats.Source != "/tmp/project" {
+		t.Errorf("Unexpected stats: %+v", digest.Stats)
+	}
+	if !strings.Contains(digest.Tree, "src/") {
+		t.Errorf("Tree missing directories: %q", digest.Tree)
+	}
+	if len(digest.Files) != 3 {
+		t.Fatalf("Expected 3 files, got %d", len(digest.Files))
+	}
+
+	// Content containing separator-like lines must round-trip untouched
+	if digest.Files[0].Path != "README.md" || digest.Files[0].Content != filesData[1].Content {
+		t.Errorf("Unexpected first file: %+v", digest.Files[0])
+	}
+
+	binary := digest.Files[1]
+	if binary.Path != "logo.bin" || !binary.Binary || binary.SkipReason != types.SkipReasonBinary || binary.Content != "" {
+		t.Errorf("Unexpected binary file record: %+v", binary)
+	}
+}
+
+func TestWriteJSONLDigest(t *testing.T) {
+	filesData, stats := sampleDigestData()
+
+	var buf bytes.Buffer
+	if err := WriteJSONLDigest(&buf, filesData, stats); err != nil {
+		t.Fatalf("WriteJSONLDigest failed: %v", err)
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record jsonFile
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line is not valid JSON: %v", err)
+		}
+		paths = append(paths, record.Path)
+	}
+
+	expected := []string{"README.md", "logo.bin", "src/main.go"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected records %v, got %v", expected, paths)
+	}
+}
+
+func TestWriteXMLDigest(t *testing.T) {
+	filesData, stats := sampleDigestData()
+	filesData = append(filesData, types.FileInfo{
+		RelativePath: "src/a&b.xml",
+		Content:      "<root><![CDATA[x]]></root>\x00\n",
+	})
+	stats.AllPaths = append(stats.AllPaths, "src/a&b.xml")
+
+	var buf bytes.Buffer
+	if err := WriteXMLDigest(&buf, filesData, stats); err != nil {
+		t.Fatalf("WriteXMLDigest failed: %v", err)
+	}
+
+	var digest struct {
+		Summary   string `xml:"summary"`
+		Tree      string `xml:"directory_structure"`
+		Documents []struct {
+			Index   int    `xml:"index,attr"`
+			Source  string `xml:"source"`
+			Content string `xml:"document_content"`
+		} `xml:"documents>document"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &digest); err != nil {
+		t.Fatalf("Digest is not well-formed XML: %v\n%s", err, buf.String())
+	}
+
+	if !strings.Contains(digest.Summary, "# Codebase Digest Summary") {
+		t.Error("Summary not found in XML digest")
+	}
+	if !strings.Contains(digest.Tree, "a&b.xml") {
+		t.Error("Tree not found in XML digest")
+	}
+	if len(digest.Documents) != 4 {
+		t.Fatalf("Expected 4 documents, got %d", len(digest.Documents))
+	}
+	if digest.Documents[0].Source != "README.md" || digest.Documents[0].Index != 1 {
+		t.Errorf("README.md should be the first document, got %+v", digest.Documents[0])
+	}
+
+	escaped := digest.Documents[2]
+	if escaped.Source != "src/a&b.xml" {
+		t.Errorf("Unexpected source %q", escaped.Source)
+	}
+	if escaped.Content != "<root><![CDATA[x]]></root>\uFFFD\n" {
+		t.Errorf("Content did not round-trip: %q", escaped.Content)
+	}
+}
+
+func TestWriteDigestFileFormatContext_Cancelled(t *testing.T) {
+	filesData, stats := sampleDigestData()
+	outputFile := filepath.Join(t.TempDir(), "digest.md")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := WriteDigestFileFormatContext(ctx, outputFile, FormatMarkdown, filesData, stats)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("Partial output file should be removed after cancellation")
+	}
+}
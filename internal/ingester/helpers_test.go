@@ -0,0 +1,68 @@
+package ingester
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateGit skips the test without git and isolates git from the user's
+// configuration, with a fixed identity for commits
+func isolateGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "Test")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+}
+
+// testGit runs git in dir with env added to the environment and returns its
+// trimmed output, failing the test if it fails
+func testGit(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commitFiles writes files below dir and commits all changes with message,
+// with env added to the environment of the commit, such as GIT_AUTHOR_DATE
+func commitFiles(t *testing.T, dir string, env []string, message string, files map[string]string) {
+	t.Helper()
+	createWalkTestFiles(t, dir, files)
+	testGit(t, dir, nil, "add", ".")
+	testGit(t, dir, env, "commit", "--quiet", "-m", message)
+}
+
+// createBareRepo commits files to a new bare repository served over file://,
+// with the given upload-pack settings, and returns its URL
+func createBareRepo(t *testing.T, files map[string]string, serverConfig ...string) string {
+	t.Helper()
+	isolateGit(t)
+
+	work := t.TempDir()
+	testGit(t, work, nil, "init", "--quiet", "--initial-branch=main")
+	commitFiles(t, work, nil, "initial", files)
+	testGit(t, work, nil, "tag", "v1.0")
+
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	testGit(t, work, nil, "clone", "--quiet", "--bare", ".", bare)
+	for i := 0; i+1 < len(serverConfig); i += 2 {
+		testGit(t, bare, nil, "config", serverConfig[i], serverConfig[i+1])
+	}
+	return "file://" + filepath.ToSlash(bare)
+}
@@ -0,0 +1,192 @@
+package ingester
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// historyScanLimit is the most commits scanned for the last commit of each
+// file and the commit counts, so files untouched for a long time don't make
+// large repositories scan their whole history
+const historyScanLimit = 10000
+
+// fileHistory is what the commit log says about the digested files, by path
+type fileHistory struct {
+	recent       []types.Commit           // Last commits that changed any of the files, newest first
+	lastCommits  map[string]*types.Commit // Last commit that changed each file
+	commitCounts map[string]int           // Number of commits that changed each file, when counted
+}
+
+// lastCommit returns the last commit that changed relPath, or nil if it was
+// never committed or no history was read
+func (h *fileHistory) lastCommit(relPath string) *types.Commit {
+	if h == nil {
+		return nil
+	}
+	return h.lastCommits[relPath]
+}
+
+// commitCount returns the number of commits that changed relPath, or 0 if
+// it was never committed or no history was read
+func (h *fileHistory) commitCount(relPath string) int {
+	if h == nil {
+		return 0
+	}
+	return h.commitCounts[relPath]
+}
+
+// needsHistory reports whether config needs the commit log of the source
+func (c Config) needsHistory() bool {
+	return c.History > 0 || c.Order.usesHistory()
+}
+
+// addHistory reads the commit log for the files in stats.AllPaths when
+// config needs it, and sets stats.History to the last config.History
+// commits that changed them. It returns nil when no history is needed or
+// nothing was committed yet.
+func addHistory(ctx context.Context, src *source, stats *types.Stats, config Config) (*fileHistory, error) {
+	if !config.needsHistory() {
+		return nil, nil
+	}
+
+	rev := src.commit
+	if src.onDisk {
+		if _, err := gitOutput(ctx, src.rootDir, "rev-parse", "--git-dir"); err != nil {
+			if config.History > 0 {
+				return nil, fmt.Errorf("history requires a Git repository, and %s is not one", src.rootDir)
+			}
+			return nil, fmt.Errorf("ordering by %s requires a Git repository, and %s is not one", config.Order, src.rootDir)
+		}
+		if _, err := gitOutput(ctx, src.rootDir, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+			return nil, nil // No commits yet
+		}
+		rev = "HEAD"
+	}
+
+	history, err := readHistory(ctx, src.rootDir, rev, stats.Subdir, stats.AllPaths, config.History, config.Order == OrderChurn)
+	if err != nil {
+		return nil, err
+	}
+	stats.History = history.recent
+	return history, nil
+}
+
+// readHistory runs git log for rev in rootDir, limited to subdir, and
+// returns the first n commits that changed any of paths, with the paths they
+// changed, along with the last commit that changed each path. Paths are
+// relative to subdir. Reading stops once both are complete, unless
+// countCommits asks for the number of commits that changed each path, which
+// needs all of the history up to historyScanLimit.
+func readHistory(ctx context.Context, rootDir, rev, subdir string, paths []string, n int, countCommits bool) (*fileHistory, error) {
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pathspec, prefix := ".", ""
+	if subdir != "" {
+		pathspec, prefix = ":(literal)"+subdir, subdir+"/"
+	}
+
+	// Renames aren't detected, since that would fetch blobs in partial clones
+	cmd := exec.CommandContext(logCtx, "git", "-C", rootDir, "log", "--format=%x1e%H%x1f%an%x1f%aI%x1f%s",
+		"--name-only", "-z", "--relative", "--no-renames", rev, "--", pathspec)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git log: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git log: %w", err)
+	}
+
+	digested := make(map[string]bool, len(paths))
+	for _, relPath := range paths {
+		digested[relPath] = true
+	}
+
+	history := &fileHistory{lastCommits: make(map[string]*types.Commit)}
+	if countCommits {
+		history.commitCounts = make(map[string]int)
+	}
+	var current *types.Commit
+	finish := func() {
+		if current == nil {
+			return
+		}
+		for _, relPath := range current.Files {
+			if history.lastCommits[relPath] == nil {
+				commit := *current
+				commit.Files = nil
+				history.lastCommits[relPath] = &commit
+			}
+			if countCommits {
+				history.commitCounts[relPath]++
+			}
+		}
+		if len(current.Files) > 0 && len(history.recent) < n {
+			history.recent = append(history.recent, *current)
+		}
+		current = nil
+	}
+
+	// Each commit is a \x1e-prefixed header followed by the files it
+	// changed, all NUL-terminated
+	reader := bufio.NewReader(stdout)
+	scanned := 0
+	stopped := false
+	var readErr error
+	for {
+		field, err := reader.ReadString(0)
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+		field = strings.TrimSuffix(field, "\x00")
+
+		if strings.HasPrefix(field, "\x1e") {
+			finish()
+			complete := !countCommits && len(history.recent) >= n && len(history.lastCommits) == len(digested)
+			if complete || scanned == historyScanLimit {
+				stopped = true
+				break
+			}
+			scanned++
+
+			parts := strings.SplitN(field[1:], "\x1f", 4)
+			if len(parts) != 4 {
+				readErr = fmt.Errorf("unexpected git log output %q", field)
+				break
+			}
+			date, _ := time.Parse(time.RFC3339, parts[2])
+			current = &types.Commit{SHA: parts[0], Author: parts[1], Date: date, Subject: parts[3]}
+			continue
+		}
+
+		relPath := strings.TrimPrefix(strings.TrimPrefix(field, "\n"), prefix)
+		if current != nil && digested[relPath] {
+			current.Files = append(current.Files, relPath)
+		}
+	}
+	finish()
+
+	// git is killed when reading stops early, so its exit status only
+	// matters when all of its output was read
+	cancel()
+	waitErr := cmd.Wait()
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case readErr != nil:
+		return nil, fmt.Errorf("failed to read git log: %w", readErr)
+	case !stopped && waitErr != nil:
+		return nil, fmt.Errorf("git log failed: %w", waitErr)
+	}
+	return history, nil
+}
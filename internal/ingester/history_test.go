@@ -0,0 +1,219 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// createHistoryRepo builds a work tree with three commits by two authors and
+// an uncommitted file, and returns its directory
+func createHistoryRepo(t *testing.T) string {
+	t.Helper()
+	isolateGit(t)
+
+	dir := t.TempDir()
+	commit := func(author, date, subject string, files map[string]string) {
+		t.Helper()
+		commitFiles(t, dir, []string{"GIT_AUTHOR_NAME=" + author, "GIT_AUTHOR_DATE=" + date}, subject, files)
+	}
+
+	testGit(t, dir, nil, "init", "--quiet", "--initial-branch=main")
+	commit("Alice", "2024-01-01T10:00:00Z", "Initial commit", map[string]string{
+		"README.md": "# App\n",
+		"src/a.go":  "package src\n",
+		"src/b.go":  "package src\n",
+		"notes.txt": "v1\n",
+	})
+	commit("Bob", "2024-02-01T10:00:00Z", "Update a", map[string]string{"src/a.go": "package src\n\nfunc A() {}\n"})
+	commit("Alice", "2024-03-01T10:00:00Z", "Update docs", map[string]string{"README.md": "# App\n\nDocs\n", "notes.txt": "v2\n"})
+
+	createWalkTestFiles(t, dir, map[string]string{"src/new.go": "package src\n"})
+	return dir
+}
+
+// historySubjects returns the subjects and files of history as strings
+func historySubjects(history []types.Commit) []string {
+	var subjects []string
+	for _, commit := range history {
+		subjects = append(subjects, commit.Subject+": "+strings.Join(commit.Files, ","))
+	}
+	return subjects
+}
+
+// lastCommitSubjects returns the subject of each file's last commit by path
+func lastCommitSubjects(filesData []types.FileInfo) map[string]string {
+	subjects := make(map[string]string)
+	for _, fileInfo := range filesData {
+		if fileInfo.LastCommit != nil {
+			subjects[fileInfo.RelativePath] = fileInfo.LastCommit.Subject
+		}
+	}
+	return subjects
+}
+
+func TestProcessLocalDirectory_History(t *testing.T) {
+	dir := createHistoryRepo(t)
+
+	testCases := []struct {
+		config      Config
+		history     []string
+		lastCommits map[string]string
+		desc        string
+	}{
+		{
+			Config{History: 2, ExcludePatterns: []string{"*.txt"}},
+			[]string{"Update docs: README.md", "Update a: src/a.go"},
+			map[string]string{"README.md": "Update docs", "src/a.go": "Update a", "src/b.go": "Initial commit"},
+			"Working tree",
+		},
+		{
+			Config{History: 10, Subdir: "src"},
+			[]string{"Update a: a.go", "Initial commit: a.go,b.go"},
+			map[string]string{"a.go": "Update a", "b.go": "Initial commit"},
+			"Subdirectory",
+		},
+		{
+			Config{History: 10, Rev: "HEAD~1"},
+			[]string{"Update a: src/a.go", "Initial commit: README.md,notes.txt,src/a.go,src/b.go"},
+			map[string]string{"README.md": "Initial commit", "notes.txt": "Initial commit", "src/a.go": "Update a", "src/b.go": "Initial commit"},
+			"Revision",
+		},
+		{
+			Config{},
+			nil,
+			map[string]string{},
+			"Disabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, tc.config)
+			if err != nil {
+				t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+			}
+
+			if history := historySubjects(stats.History); strings.Join(history, "|") != strings.Join(tc.history, "|") {
+				t.Errorf("Expected history %q, got %q", tc.history, history)
+			}
+			lastCommits := lastCommitSubjects(filesData)
+			if len(lastCommits) != len(tc.lastCommits) {
+				t.Errorf("Expected last commits %v, got %v", tc.lastCommits, lastCommits)
+			}
+			for relPath, subject := range tc.lastCommits {
+				if lastCommits[relPath] != subject {
+					t.Errorf("Expected last commit %q for %s, got %q", subject, relPath, lastCommits[relPath])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessLocalDirectory_HistoryCommit(t *testing.T) {
+	dir := createHistoryRepo(t)
+
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{History: 1})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+
+	commit := stats.History[0]
+	if len(commit.SHA) != 40 || commit.Author != "Alice" || commit.Date.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("Expected Alice's commit of 2024-03-01, got %+v", commit)
+	}
+	for _, fileInfo := range filesData {
+		switch fileInfo.RelativePath {
+		case "src/a.go":
+			if fileInfo.LastCommit == nil || fileInfo.LastCommit.Author != "Bob" || fileInfo.LastCommit.Files != nil {
+				t.Errorf("Expected Bob's commit without files for src/a.go, got %+v", fileInfo.LastCommit)
+			}
+		case "src/new.go":
+			if fileInfo.LastCommit != nil {
+				t.Errorf("Expected no last commit for the uncommitted src/new.go, got %+v", fileInfo.LastCommit)
+			}
+		}
+	}
+}
+
+func TestProcessLocalDirectory_HistoryErrors(t *testing.T) {
+	isolateGit(t)
+
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	if _, _, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{History: 5}); err == nil || !strings.Contains(err.Error(), "requires a Git repository") {
+		t.Errorf("Expected history to require a Git repository, got %v", err)
+	}
+
+	// A repository without commits has no history yet
+	testGit(t, dir, nil, "init", "--quiet")
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{History: 5})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+	if len(stats.History) != 0 || len(lastCommitSubjects(filesData)) != 0 {
+		t.Errorf("Expected no history, got %+v", stats.History)
+	}
+}
+
+func TestProcessRemoteRepo_History(t *testing.T) {
+	dir := createHistoryRepo(t)
+	url := fileURL(dir)
+
+	for _, ref := range []string{"", "main"} {
+		tempDir, filesData, stats, err := ProcessRemoteRepoContext(context.Background(), url, "", Config{History: 1, Ref: ref, Subdir: "src"})
+		if err != nil {
+			t.Fatalf("ProcessRemoteRepoContext failed: %v", err)
+		}
+		os.RemoveAll(tempDir)
+
+		if history := historySubjects(stats.History); len(history) != 1 || history[0] != "Update a: a.go" {
+			t.Errorf("Expected the last commit below src with ref %q, got %q", ref, history)
+		}
+		// The initial commit is only known with more than the checked out commit
+		if lastCommits := lastCommitSubjects(filesData); lastCommits["b.go"] != "Initial commit" {
+			t.Errorf("Expected the initial commit for b.go with ref %q, got %v", ref, lastCommits)
+		}
+	}
+}
+
+func TestWriteDigest_History(t *testing.T) {
+	dir := createHistoryRepo(t)
+	config := Config{History: 2, ExcludePatterns: []string{"*.txt"}}
+
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, config)
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+	var digest bytes.Buffer
+	if err := WriteDigestTo(&digest, filesData, stats); err != nil {
+		t.Fatalf("WriteDigestTo failed: %v", err)
+	}
+
+	var streamed bytes.Buffer
+	if _, err := StreamLocalDirectoryContext(context.Background(), &streamed, FormatMarkdown, dir, config); err != nil {
+		t.Fatalf("StreamLocalDirectoryContext failed: %v", err)
+	}
+
+	for _, output := range []string{digest.String(), streamed.String()} {
+		expected := []string{
+			"## History\n\n- **",
+			" 2024-03-01 Alice: Update docs\n  Files: README.md\n",
+			" 2024-02-01 Bob: Update a\n  Files: src/a.go\n",
+			"FILE: src/a.go\nLAST MODIFIED: 2024-02-01 by Bob (",
+			"FILE: src/new.go\n===",
+		}
+		for _, text := range expected {
+			if !strings.Contains(output, text) {
+				t.Errorf("Expected %q in digest:\n%s", text, output)
+			}
+		}
+		if strings.Index(output, "## History") > strings.Index(output, "## Directory Structure") {
+			t.Error("Expected the history before the directory tree")
+		}
+	}
+}
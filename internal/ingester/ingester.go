@@ -1,19 +1,65 @@
 package ingester
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/fs"
-	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 
+	"github.com/prashanth1k/gingest/internal/ignore"
 	"github.com/prashanth1k/gingest/internal/notebookparser"
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/tokenizer"
 	"github.com/prashanth1k/gingest/internal/types"
 	"github.com/prashanth1k/gingest/internal/utils"
 )
 
 // Package ingester handles processing of local directories and remote repositories
 
+// DefaultWorkers is the number of files read concurrently when Config.Workers is 0
+var DefaultWorkers = runtime.NumCPU() * 2
+
+// Config controls which files are collected and how they are read
+type Config struct {
+	MaxFileSize       int64               // Maximum file size in bytes (0 = no limit)
+	IncludePatterns   []string            // Glob patterns for files to include (overrides excludes)
+	ExcludePatterns   []string            // Glob patterns for files and directories to exclude
+	TokenEstimator    tokenizer.Estimator // Token estimator (nil = tokenizer.Default)
+	NoGitignore       bool                // Disable .gitignore, .git/info/exclude and core.excludesFile
+	Workers           int                 // Maximum number of files read concurrently (0 = DefaultWorkers)
+	Progress          progress.Func       // Receives progress events while processing (optional)
+	Ref               string              // Branch, tag or commit SHA to check out for remote repositories (overrides the branch)
+	Subdir            string              // Only process this slash-separated directory below the root (optional)
+	CacheDir          string              // Keep mirrors of remote repositories here and fetch into them incrementally (optional)
+	Rev               string              // Read local sources at this Git revision instead of the working tree (optional)
+	TrackedOnly       bool                // Only process files in the Git index, leaving out untracked files
+	History           int                 // Include this many recent commits and the last commit of each file (0 = none)
+	Order             Order               // Order of the files in the digest (default: OrderPath)
+	OrderGlobs        []string            // Glob patterns for OrderCustom, first in the digest first
+	LineNumbers       bool                // Prefix each line of content with its line number in the file (per cell for notebooks)
+	StripComments     bool                // Remove comments from source files in supported languages
+	KeepLicense       bool                // Keep license and copyright headers when stripping comments
+	KeepDocComments   bool                // Keep doc comments when stripping comments
+	CompactWhitespace bool                // Remove trailing whitespace and blank lines (runs of blank lines collapse in prose)
+}
+
+// workers returns the number of concurrent readers to use for n files
+func (c Config) workers(n int) int {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if workers > n {
+		workers = n
+	}
+	return workers
+}
+
 // ProcessLocalDirectory traverses a directory and returns FileInfo for all files
 func ProcessLocalDirectory(rootDir string) ([]types.FileInfo, error) {
 	filesData, _, err := ProcessLocalDirectoryWithOptions(rootDir, 0) // 0 means no size limit
@@ -27,184 +73,439 @@ func ProcessLocalDirectoryWithOptions(rootDir string, maxFileSize int64) ([]type
 
 // ProcessLocalDirectoryWithPatterns traverses a directory with filtering patterns
 func ProcessLocalDirectoryWithPatterns(rootDir string, maxFileSize int64, includePatterns, excludePatterns []string) ([]types.FileInfo, types.Stats, error) {
-	var allPaths []string  // Collect all paths for tree generation
-	var filePaths []string // Collect file paths for concurrent processing
-	stats := types.Stats{
-		Source: rootDir,
+	return ProcessLocalDirectoryWithConfig(rootDir, Config{
+		MaxFileSize:     maxFileSize,
+		IncludePatterns: includePatterns,
+		ExcludePatterns: excludePatterns,
+	})
+}
+
+// ProcessLocalDirectoryWithConfig traverses a directory using the given config
+func ProcessLocalDirectoryWithConfig(rootDir string, config Config) ([]types.FileInfo, types.Stats, error) {
+	return ProcessLocalDirectoryContext(context.Background(), rootDir, config)
+}
+
+// ProcessLocalDirectoryContext traverses a directory using the given config.
+// Cancelling ctx stops the walk and the file reads and returns ctx.Err().
+func ProcessLocalDirectoryContext(ctx context.Context, rootDir string, config Config) ([]types.FileInfo, types.Stats, error) {
+	src, err := openSource(ctx, rootDir, config)
+	if err != nil {
+		return nil, types.Stats{}, err
 	}
+	defer src.close()
 
 	// First pass: collect all valid file paths
-	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	progressReporter := newReporter(config.Progress)
+	stats, err := walkDirectory(ctx, src, config, progressReporter)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	history, err := addHistory(ctx, src, &stats, config)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	files, absRoot, err := src.files(stats.Subdir)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+	ranks, err := addOrder(files, &stats, history, config)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	// Second pass: process files concurrently
+	filesData, err := readFiles(ctx, files, absRoot, stats.AllPaths, config, progressReporter)
+	if err != nil {
+		return nil, types.Stats{}, err
+	}
+
+	for i, fileInfo := range filesData {
+		if config.History > 0 {
+			filesData[i].LastCommit = history.lastCommit(fileInfo.RelativePath)
 		}
+		filesData[i].Rank = ranks[fileInfo.RelativePath]
+		addFileStats(&stats, fileInfo)
+	}
+
+	return filesData, stats, nil
+}
+
+// cleanSubdir validates config.Subdir and returns it as a clean
+// slash-separated path, or "" if no subdirectory is set
+func cleanSubdir(src *source, config Config) (string, error) {
+	if config.Subdir == "" {
+		return "", nil
+	}
+	subdir := path.Clean(filepath.ToSlash(config.Subdir))
+	if path.IsAbs(subdir) || filepath.IsAbs(config.Subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+		return "", fmt.Errorf("subdirectory %q must be inside the source", config.Subdir)
+	}
+	if subdir == "." {
+		return "", nil
+	}
+
+	info, err := fs.Stat(src.fsys, subdir)
+	if err != nil {
+		return "", fmt.Errorf("subdirectory %q not found in source: %w", config.Subdir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("subdirectory %q is not a directory", config.Subdir)
+	}
+	return subdir, nil
+}
 
-		// Calculate relative path from rootDir for pattern matching
-		relPath, err := filepath.Rel(rootDir, path)
+// walkDirectory collects the paths of all files to include in src into
+// stats.AllPaths, along with the directory count and the ignore files applied.
+// With config.Subdir set, only that directory is walked and paths are relative
+// to it, but ignore files are still matched from the root, so the repository's
+// own .gitignore keeps applying.
+func walkDirectory(ctx context.Context, src *source, config Config, progressReporter *reporter) (types.Stats, error) {
+	var allPaths []string // Collect all paths for tree generation
+	rootDir := src.rootDir
+	stats := types.Stats{
+		Source:   rootDir,
+		Stripped: config.reductions(),
+	}
+	if src.commit != "" {
+		stats.Ref = config.Rev
+		stats.Commit = src.commit
+	}
+
+	subdir, err := cleanSubdir(src, config)
+	if err != nil {
+		return types.Stats{}, err
+	}
+	stats.Subdir = subdir
+
+	// A revision only holds tracked files, so only the working tree needs the index
+	var tracked map[string]bool
+	if config.TrackedOnly {
+		stats.TrackedOnly = true
+		if src.onDisk {
+			if tracked, err = trackedFiles(ctx, rootDir); err != nil {
+				return types.Stats{}, err
+			}
+		}
+	}
+
+	// Load the Git excludes and the ignore files from the root down to the
+	// walked directory before walking
+	ignores, includes := ignore.New(), ignore.New()
+	if !config.NoGitignore {
+		if err := ignores.AddGitExcludes(ctx, rootDir); err != nil {
+			return types.Stats{}, err
+		}
+	}
+	if err := loadIgnoreFiles(ignores, includes, src, "", config); err != nil {
+		return types.Stats{}, err
+	}
+	var prefix string // Path of the walked directory relative to rootDir, with a trailing slash
+	if subdir != "" {
+		var parent string
+		for _, segment := range strings.Split(subdir, "/") {
+			parent = path.Join(parent, segment)
+			if err := loadIgnoreFiles(ignores, includes, src, parent, config); err != nil {
+				return types.Stats{}, err
+			}
+		}
+		prefix = subdir + "/"
+	}
+
+	walkRoot := "."
+	if subdir != "" {
+		walkRoot = subdir
+	}
+	err = fs.WalkDir(src.fsys, walkRoot, func(repoPath string, d fs.DirEntry, err error) error {
 		if err != nil {
-			relPath = path // fallback to original path
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		relPath = filepath.ToSlash(relPath)
 
 		// Skip the root directory itself
-		if relPath == "." {
+		if repoPath == walkRoot {
 			return nil
 		}
 
+		// Paths relative to the walked directory are used for pattern
+		// matching; ignore files match paths relative to the root
+		relPath := strings.TrimPrefix(repoPath, prefix)
+
 		// Count directories
 		if d.IsDir() {
 			stats.NumDirsProcessed++
 
 			// Check if directory should be excluded
-			if !utils.ShouldIncludeFile(relPath, includePatterns, excludePatterns) {
+			if !utils.ShouldIncludePath(relPath, true, config.IncludePatterns, config.ExcludePatterns) {
 				return filepath.SkipDir
 			}
-			return nil
+			if isIgnored(ignores, repoPath, true, config) {
+				return filepath.SkipDir
+			}
+			// Nested ignore files apply below their own directory
+			return loadIgnoreFiles(ignores, includes, src, repoPath, config)
 		}
 
 		// Check if file should be included based on patterns
-		if !utils.ShouldIncludeFile(relPath, includePatterns, excludePatterns) {
+		if !utils.ShouldIncludeFile(relPath, config.IncludePatterns, config.ExcludePatterns) {
 			return nil // Skip this file
 		}
-
-		// Add to paths for tree generation
-		allPaths = append(allPaths, relPath)
-
-		// Get absolute path for processing
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return err
+		if isIgnored(ignores, repoPath, false, config) {
+			return nil // Skip files the project ignores
+		}
+		if includes.Applies(repoPath) && !includes.MatchWithParents(repoPath, false) {
+			return nil // Skip files outside the project's include list
+		}
+		if tracked != nil && !tracked[repoPath] {
+			stats.NumUntrackedFiles++
+			return nil // Skip files Git doesn't track
 		}
 
-		// Add to file paths for concurrent processing
-		filePaths = append(filePaths, absPath)
+		// Add to paths for tree generation and concurrent processing
+		allPaths = append(allPaths, relPath)
+		progressReporter.discovered(relPath)
 
 		return nil
 	})
 
 	if err != nil {
-		return nil, types.Stats{}, err
+		return types.Stats{}, err
 	}
 
-	// Second pass: process files concurrently
-	filesData := make([]types.FileInfo, len(filePaths))
-	fileInfoChan := make(chan struct {
-		index int
-		info  types.FileInfo
-	}, len(filePaths))
+	// Store all paths in stats for tree generation
+	stats.AllPaths = allPaths
+	stats.IgnoreFiles = ignoreFileNames(rootDir, append(ignores.Files(), includes.Files()...))
+
+	return stats, nil
+}
+
+// loadIgnoreFiles adds the ignore files in the directory relDir of src ("" for
+// the root) to the matchers. Within a directory .gingestignore comes
+// after .gitignore, so it can re-include files Git ignores. A .gingestinclude
+// is only read when no include patterns were given, which take its place.
+func loadIgnoreFiles(ignores, includes *ignore.Matcher, src *source, relDir string, config Config) error {
+	add := func(matcher *ignore.Matcher, name string) error {
+		name = path.Join(relDir, name)
+		_, err := matcher.AddFileFS(src.fsys, name, filepath.Join(src.rootDir, filepath.FromSlash(name)), relDir)
+		return err
+	}
+
+	if !config.NoGitignore {
+		if err := add(ignores, ignore.GitignoreFile); err != nil {
+			return err
+		}
+	}
+	if err := add(ignores, ignore.GingestIgnoreFile); err != nil {
+		return err
+	}
+	if len(config.IncludePatterns) == 0 {
+		if err := add(includes, ignore.GingestIncludeFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignoreFileNames returns the ignore files for the summary, relative to the
+// root. Files of the work tree above the root start with "../".
+func ignoreFileNames(rootDir string, files []string) []string {
+	var names []string
+	for _, file := range files {
+		relPath, err := filepath.Rel(rootDir, file)
+		if file == ignore.GlobalExcludesFile || err != nil {
+			names = append(names, file)
+			continue
+		}
+		names = append(names, filepath.ToSlash(relPath))
+	}
+	return names
+}
+
+// isIgnored reports whether relPath is excluded by an ignore file. Like other
+// excludes, an explicit include pattern overrides it for files.
+func isIgnored(ignores *ignore.Matcher, relPath string, isDir bool, config Config) bool {
+	if !ignores.Match(relPath, isDir) {
+		return false
+	}
+	if !isDir && len(config.IncludePatterns) > 0 {
+		return !utils.ShouldIncludeFile(relPath, config.IncludePatterns, nil)
+	}
+	return true
+}
 
+// readFiles reads the files at allPaths in fsys with a bounded pool of
+// workers, so large trees don't exhaust file descriptors. It stops handing
+// out files once ctx is cancelled.
+func readFiles(ctx context.Context, fsys fs.FS, absRoot string, allPaths []string, config Config, progressReporter *reporter) ([]types.FileInfo, error) {
+	filesData := make([]types.FileInfo, len(allPaths))
+	progressReporter.start(len(allPaths))
+	indexes := make(chan int)
 	var wg sync.WaitGroup
-	var statsMutex sync.Mutex
 
-	// Process each file concurrently
-	for i, absPath := range filePaths {
+	for w := 0; w < config.workers(len(allPaths)); w++ {
 		wg.Add(1)
-		go func(index int, filePath string) {
+		go func() {
 			defer wg.Done()
-
-			// Calculate relative path
-			relPath, err := filepath.Rel(rootDir, filePath)
-			if err != nil {
-				relPath = filePath
-			}
-			relPath = filepath.ToSlash(relPath)
-
-			// Get file info to check size
-			fileInfo, err := os.Stat(filePath)
-			if err != nil {
-				fileInfoStruct := types.FileInfo{
-					RelativePath: relPath,
-					AbsolutePath: filePath,
-					Content:      "",
-					IsBinary:     false,
-					Error:        err,
-				}
-				fileInfoChan <- struct {
-					index int
-					info  types.FileInfo
-				}{index, fileInfoStruct}
-
-				statsMutex.Lock()
-				stats.NumFilesProcessed++
-				statsMutex.Unlock()
-				return
+			for index := range indexes {
+				filesData[index] = readFile(fsys, absRoot, allPaths[index], config)
+				progressReporter.read(filesData[index])
 			}
+		}()
+	}
 
-			var content string
-			var readErr error
-			var isBinary bool
-
-			// Check file size if maxFileSize is specified
-			if maxFileSize > 0 && fileInfo.Size() > maxFileSize {
-				sizeMB := float64(fileInfo.Size()) / (1024 * 1024)
-				content = fmt.Sprintf("[File content skipped: Exceeds max size (%.1f MB > %.1f MB)]",
-					sizeMB, float64(maxFileSize)/(1024*1024))
-
-				statsMutex.Lock()
-				stats.NumSkippedFiles++
-				statsMutex.Unlock()
-			} else {
-				// Check if file is a Jupyter notebook first
-				if utils.IsJupyterNotebook(filePath) {
-					content, readErr = notebookparser.ParseNotebook(filePath)
-					if readErr == nil {
-						statsMutex.Lock()
-						stats.TotalContentBytes += int64(len(content))
-						statsMutex.Unlock()
-						isBinary = false // Notebooks are treated as text
-					}
-				} else {
-					// Check if file is binary before reading full content
-					isBinary, err := utils.IsBinaryFile(filePath)
-					if err != nil {
-						readErr = err
-					} else if isBinary {
-						content = "[Binary File]"
-						statsMutex.Lock()
-						stats.NumBinaryFiles++
-						statsMutex.Unlock()
-					} else {
-						// Read file content for text files
-						content, readErr = utils.ReadFileContent(filePath)
-						statsMutex.Lock()
-						stats.TotalContentBytes += int64(len(content))
-						statsMutex.Unlock()
-					}
-				}
-			}
+feed:
+	for i := range allPaths {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return filesData, nil
+}
 
-			fileInfoStruct := types.FileInfo{
-				RelativePath: relPath,
-				AbsolutePath: filePath,
-				Content:      content,
-				IsBinary:     isBinary,
-				Error:        readErr,
+// readFile reads a single file of fsys, applying the size limit, binary
+// detection, notebook parsing, comment and whitespace stripping and line
+// numbering. Files on disk are located below absRoot.
+func readFile(fsys fs.FS, absRoot, relPath string, config Config) types.FileInfo {
+	result := types.FileInfo{
+		RelativePath: relPath,
+	}
+	if absRoot != "" {
+		result.AbsolutePath = filepath.Join(absRoot, filepath.FromSlash(relPath))
+	}
+
+	file, err := fsys.Open(relPath)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	defer file.Close()
+
+	// Get file info to check size
+	fileInfo, err := file.Stat()
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Size = fileInfo.Size()
+
+	// Check file size if maxFileSize is specified
+	if config.MaxFileSize > 0 && fileInfo.Size() > config.MaxFileSize {
+		sizeMB := float64(fileInfo.Size()) / (1024 * 1024)
+		result.Content = fmt.Sprintf("[File content skipped: Exceeds max size (%.1f MB > %.1f MB)]",
+			sizeMB, float64(config.MaxFileSize)/(1024*1024))
+		result.SkipReason = types.SkipReasonTooLarge
+	} else if utils.IsJupyterNotebook(relPath) {
+		// Notebooks are treated as text
+		var data []byte
+		if data, result.Error = io.ReadAll(file); result.Error == nil {
+			result.Content, result.Error = notebookparser.ParseNotebookDataWithOptions(data, notebookparser.Options{LineNumbers: config.LineNumbers})
+			result.Language = utils.DetectLanguage(relPath, "")
+		} else {
+			result.Error = fmt.Errorf("failed to read notebook file: %w", result.Error)
+		}
+	} else {
+		// Check if file is binary before reading full content
+		head := make([]byte, utils.BinarySniffSize)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			result.Error = err
+		} else if result.IsBinary = utils.IsBinaryData(head[:n]); result.IsBinary {
+			result.Content = "[Binary File]"
+			result.SkipReason = types.SkipReasonBinary
+		} else {
+			// Read the rest of the content for text files
+			var rest []byte
+			rest, result.Error = io.ReadAll(file)
+			result.Content = string(head[:n]) + string(rest)
+			result.Language = utils.DetectLanguage(relPath, result.Content)
+			var numbers []int
+			if config.StripComments || config.CompactWhitespace {
+				numbers = reduceContent(&result, config)
 			}
+			if config.LineNumbers {
+				result.Content = utils.NumberLinesAt(result.Content, numbers)
+			}
+		}
+	}
 
-			fileInfoChan <- struct {
-				index int
-				info  types.FileInfo
-			}{index, fileInfoStruct}
+	if result.Error == nil {
+		result.Tokens = tokenizer.Or(config.TokenEstimator).CountTokens(result.Content)
+	}
 
-			statsMutex.Lock()
-			stats.NumFilesProcessed++
-			statsMutex.Unlock()
-		}(i, absPath)
+	return result
+}
+
+// reduceContent strips the comments and compacts the whitespace of a text
+// file as config asks, recording what was saved in fileInfo. It returns the
+// line number in the file of each line that is left.
+func reduceContent(fileInfo *types.FileInfo, config Config) []int {
+	original := fileInfo.Content
+	content, numbers := original, []int(nil)
+	if config.StripComments {
+		content, numbers = utils.StripComments(content, fileInfo.Language, utils.CommentOptions{
+			KeepLicense: config.KeepLicense,
+			KeepDocs:    config.KeepDocComments,
+		})
+	}
+	if config.CompactWhitespace {
+		var kept []int
+		content, kept = utils.CompactWhitespace(content, fileInfo.Language)
+		if numbers != nil {
+			for i, n := range kept {
+				kept[i] = numbers[n-1]
+			}
+		}
+		numbers = kept
 	}
 
-	// Collect results from channel
-	go func() {
-		wg.Wait()
-		close(fileInfoChan)
-	}()
+	if len(content) < len(original) {
+		estimator := tokenizer.Or(config.TokenEstimator)
+		fileInfo.Content = content
+		fileInfo.SavedBytes = int64(len(original) - len(content))
+		fileInfo.SavedTokens = estimator.CountTokens(original) - estimator.CountTokens(content)
+	}
+	return numbers
+}
 
-	// Collect all file info structs in order
-	for result := range fileInfoChan {
-		filesData[result.index] = result.info
+// reductions names the content reductions config applies, for the summary
+func (c Config) reductions() []string {
+	var names []string
+	if c.StripComments {
+		names = append(names, "comments")
 	}
+	if c.CompactWhitespace {
+		names = append(names, "whitespace")
+	}
+	return names
+}
 
-	// Store all paths in stats for tree generation
-	stats.AllPaths = allPaths
+// addFileStats accumulates the statistics for a processed file
+func addFileStats(stats *types.Stats, fileInfo types.FileInfo) {
+	stats.NumFilesProcessed++
+
+	switch {
+	case fileInfo.Error != nil:
+		return
+	case fileInfo.SkipReason == types.SkipReasonTooLarge:
+		stats.NumSkippedFiles++
+	case fileInfo.IsBinary:
+		stats.NumBinaryFiles++
+	default:
+		stats.TotalContentBytes += int64(len(fileInfo.Content))
+	}
 
-	return filesData, stats, nil
+	stats.TotalTokens += fileInfo.Tokens
+	stats.SavedBytes += fileInfo.SavedBytes
+	stats.SavedTokens += fileInfo.SavedTokens
 }
@@ -0,0 +1,393 @@
+package ingester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// createWalkTestFiles creates files below dir from a map of slash-separated paths to content
+func createWalkTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func walkedPaths(t *testing.T, rootDir string, config Config) []string {
+	t.Helper()
+
+	_, stats, err := ProcessLocalDirectoryWithConfig(rootDir, config)
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+	paths := append([]string(nil), stats.AllPaths...)
+	sort.Strings(paths)
+	return paths
+}
+
+func TestProcessLocalDirectory_Gitignore(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		".gitignore":           "*.gen.go\n/dist/\n!keep.gen.go\n!/dist/keep.js\n",
+		"main.go":              "package main\n",
+		"main.gen.go":          "package main\n",
+		"keep.gen.go":          "package main\n",
+		"dist/bundle.js":       "bundle\n",
+		"dist/keep.js":         "can't be re-included from an ignored directory\n",
+		"pkg/dist/notes.txt":   "not anchored to pkg\n",
+		"pkg/.gitignore":       "fixtures/\n!important.gen.go\n",
+		"pkg/important.gen.go": "package pkg\n",
+		"pkg/other.gen.go":     "package pkg\n",
+		"pkg/fixtures/a.json":  "{}\n",
+	})
+
+	expected := []string{
+		".gitignore",
+		"keep.gen.go",
+		"main.go",
+		"pkg/.gitignore",
+		"pkg/dist/notes.txt",
+		"pkg/important.gen.go",
+	}
+	paths := walkedPaths(t, testDir, Config{})
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, paths)
+			break
+		}
+	}
+
+	// Include patterns override ignore files for matching files
+	paths = walkedPaths(t, testDir, Config{IncludePatterns: []string{"*.go"}})
+	found := false
+	for _, path := range paths {
+		found = found || path == "main.gen.go"
+	}
+	if !found {
+		t.Errorf("Expected include pattern to override .gitignore, got %v", paths)
+	}
+
+	// NoGitignore walks everything
+	if paths := walkedPaths(t, testDir, Config{NoGitignore: true}); len(paths) != 11 {
+		t.Errorf("Expected all 11 files with NoGitignore, got %v", paths)
+	}
+}
+
+func TestProcessLocalDirectory_GitSubdirectory(t *testing.T) {
+	isolateGit(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// The source is a directory below the top level of the work tree
+	repo := t.TempDir()
+	testGit(t, repo, nil, "init", "--quiet")
+	createWalkTestFiles(t, repo, map[string]string{
+		".git/info/exclude":   "/pkg/local.txt\n",
+		".gitignore":          "*.log\n/pkg/gen/\n/main.go\n",
+		"pkg/.gitignore":      "*.tmp\n",
+		"pkg/main.go":         "package pkg\n",
+		"pkg/local.txt":       "local\n",
+		"pkg/debug.log":       "log\n",
+		"pkg/scratch.tmp":     "tmp\n",
+		"pkg/gen/types.go":    "package gen\n",
+		"pkg/sub/local.txt":   "not anchored to pkg/sub\n",
+		"pkg/sub/sub_test.go": "package sub\n",
+	})
+
+	_, stats, err := ProcessLocalDirectoryWithConfig(filepath.Join(repo, "pkg"), Config{})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+	paths := append([]string(nil), stats.AllPaths...)
+	sort.Strings(paths)
+
+	expected := []string{".gitignore", "main.go", "sub/local.txt", "sub/sub_test.go"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+	expectedFiles := []string{"../.git/info/exclude", "../.gitignore", ".gitignore"}
+	if strings.Join(stats.IgnoreFiles, ",") != strings.Join(expectedFiles, ",") {
+		t.Errorf("Expected ignore files %v, got %v", expectedFiles, stats.IgnoreFiles)
+	}
+}
+
+func TestProcessLocalDirectory_GingestFiles(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		".gitignore":          "dist/\n",
+		".gingestignore":      "*.snap\n!dist/\n",
+		"main.go":             "package main\n",
+		"main.snap":           "snapshot\n",
+		"dist/types.d.ts":     "export {}\n",
+		"web/.gingestinclude": "src/\n",
+		"web/src/app.js":      "app\n",
+		"web/public/logo.svg": "<svg/>\n",
+	})
+
+	_, stats, err := ProcessLocalDirectoryWithConfig(testDir, Config{})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+	paths := append([]string(nil), stats.AllPaths...)
+	sort.Strings(paths)
+
+	// web/.gingestinclude is outside its own include list
+	expected := []string{".gingestignore", ".gitignore", "dist/types.d.ts", "main.go", "web/src/app.js"}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, paths)
+			break
+		}
+	}
+
+	expectedFiles := []string{".gitignore", ".gingestignore", "web/.gingestinclude"}
+	if len(stats.IgnoreFiles) != len(expectedFiles) {
+		t.Fatalf("Expected ignore files %v, got %v", expectedFiles, stats.IgnoreFiles)
+	}
+	for i := range expectedFiles {
+		if stats.IgnoreFiles[i] != expectedFiles[i] {
+			t.Errorf("Expected ignore files %v, got %v", expectedFiles, stats.IgnoreFiles)
+			break
+		}
+	}
+
+	// Include patterns replace .gingestinclude
+	paths = walkedPaths(t, testDir, Config{IncludePatterns: []string{"*"}})
+	found := false
+	for _, path := range paths {
+		found = found || path == "web/public/logo.svg"
+	}
+	if !found {
+		t.Errorf("Expected include patterns to replace .gingestinclude, got %v", paths)
+	}
+}
+
+func TestProcessLocalDirectory_DoublestarInclude(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		"README.md":             "# Project\n",
+		"src/main.go":           "package main\n",
+		"src/pkg/deep/util.go":  "package deep\n",
+		"src/pkg/deep/notes.md": "notes\n",
+		"debug/trace.go":        "package debug\n",
+	})
+
+	// Include patterns no longer stop the walk at directories they don't match
+	paths := walkedPaths(t, testDir, Config{
+		IncludePatterns: []string{"src/**/*.go"},
+		ExcludePatterns: []string{"debug/"},
+	})
+	expected := []string{"src/main.go", "src/pkg/deep/util.go"}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+}
+
+func TestProcessLocalDirectory_Workers(t *testing.T) {
+	testDir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("pkg%d/file%d.txt", i%5, i)] = fmt.Sprintf("content %d\n", i)
+	}
+	createWalkTestFiles(t, testDir, files)
+
+	for _, workers := range []int{1, 3, 100} {
+		filesData, stats, err := ProcessLocalDirectoryWithConfig(testDir, Config{Workers: workers})
+		if err != nil {
+			t.Fatalf("ProcessLocalDirectoryWithConfig with %d workers failed: %v", workers, err)
+		}
+		if len(filesData) != 50 || stats.NumFilesProcessed != 50 {
+			t.Errorf("Expected 50 files with %d workers, got %d", workers, len(filesData))
+		}
+		for _, fileInfo := range filesData {
+			if fileInfo.Content != files[fileInfo.RelativePath] {
+				t.Errorf("Content mismatch for %s with %d workers", fileInfo.RelativePath, workers)
+			}
+		}
+	}
+}
+
+func TestProcessLocalDirectory_LineNumbers(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		"main.go":  "package main\n\nfunc main() {}\n",
+		"bin/tool": "#!/usr/bin/env python3\nprint(1)\n",
+		"logo.png": "\x89PNG\x00\x00",
+	})
+
+	filesData, _, err := ProcessLocalDirectoryWithConfig(testDir, Config{LineNumbers: true})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"main.go":  "1 | package main\n2 |\n3 | func main() {}\n",
+		"bin/tool": "1 | #!/usr/bin/env python3\n2 | print(1)\n",
+		"logo.png": "[Binary File]",
+	}
+	for _, fileInfo := range filesData {
+		if fileInfo.Content != expected[fileInfo.RelativePath] {
+			t.Errorf("Expected %q for %s, got %q", expected[fileInfo.RelativePath], fileInfo.RelativePath, fileInfo.Content)
+		}
+		// The language is detected before the lines are numbered
+		if fileInfo.RelativePath == "bin/tool" && fileInfo.Language != "python" {
+			t.Errorf("Expected python for bin/tool, got %q", fileInfo.Language)
+		}
+	}
+}
+
+func TestProcessLocalDirectory_StripComments(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		"main.go":   "// Copyright 2024 The Authors\n\npackage main\n\n// main runs\nfunc main() {\n\n\tprintln() // hi\n}\n",
+		"README.md": "# App\n\n\nText  \n",
+		"logo.png":  "\x89PNG\x00\x00",
+	})
+
+	testCases := []struct {
+		config   Config
+		expected map[string]string
+		stripped string
+		desc     string
+	}{
+		{
+			Config{StripComments: true},
+			map[string]string{
+				"main.go":   "\npackage main\n\nfunc main() {\n\n\tprintln()\n}\n",
+				"README.md": "# App\n\n\nText  \n",
+			},
+			"comments",
+			"Comments",
+		},
+		{
+			Config{StripComments: true, KeepLicense: true, CompactWhitespace: true, LineNumbers: true},
+			map[string]string{
+				"main.go":   "1 | // Copyright 2024 The Authors\n3 | package main\n6 | func main() {\n8 | \tprintln()\n9 | }\n",
+				"README.md": "1 | # App\n3 |\n4 | Text\n",
+			},
+			"comments,whitespace",
+			"License, whitespace and line numbers",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			filesData, stats, err := ProcessLocalDirectoryWithConfig(testDir, tc.config)
+			if err != nil {
+				t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+			}
+
+			var savedBytes int64
+			for _, fileInfo := range filesData {
+				savedBytes += fileInfo.SavedBytes
+				if expected, ok := tc.expected[fileInfo.RelativePath]; ok && fileInfo.Content != expected {
+					t.Errorf("Expected %q for %s, got %q", expected, fileInfo.RelativePath, fileInfo.Content)
+				}
+			}
+			if strings.Join(stats.Stripped, ",") != tc.stripped {
+				t.Errorf("Expected stripped %q, got %v", tc.stripped, stats.Stripped)
+			}
+			if stats.SavedBytes == 0 || stats.SavedBytes != savedBytes || stats.SavedTokens <= 0 {
+				t.Errorf("Expected the saved bytes and tokens of the files, got %d bytes and %d tokens", stats.SavedBytes, stats.SavedTokens)
+			}
+		})
+	}
+}
+
+func TestApplyTokenBudget_LineNumbers(t *testing.T) {
+	testDir := t.TempDir()
+	var content strings.Builder
+	for i := 1; i <= 500; i++ {
+		content.WriteString(fmt.Sprintf("line %d of a long file\n", i))
+	}
+	createWalkTestFiles(t, testDir, map[string]string{"long.txt": content.String()})
+
+	filesData, stats, err := ProcessLocalDirectoryWithConfig(testDir, Config{LineNumbers: true})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+	result, _ := ApplyTokenBudget(filesData, stats, Budget{MaxTokens: filesData[0].Tokens / 2})
+
+	truncated := result[0]
+	if !truncated.Truncated {
+		t.Fatal("Expected the file to be truncated")
+	}
+	// Numbers still match the original lines, and the notice isn't numbered
+	lines := strings.Split(truncated.Content, "\n")
+	last := lines[len(lines)-3]
+	var number, original int
+	if _, err := fmt.Sscanf(last, "%d | line %d", &number, &original); err != nil || number != original {
+		t.Errorf("Expected the last kept line to keep its number, got %q", last)
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "[... truncated") {
+		t.Errorf("Expected an unnumbered truncation notice, got %q", lines[len(lines)-1])
+	}
+}
+
+func TestProcessLocalDirectory_Cancelled(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{"main.go": "package main\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := ProcessLocalDirectoryContext(ctx, testDir, Config{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestProcessLocalDirectory_Subdir(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		".gitignore":                  "*.gen.go\n/services/api/local.env\n",
+		"main.go":                     "package main\n",
+		"services/.gitignore":         "tmp/\n",
+		"services/api/server.go":      "package api\n",
+		"services/api/server.gen.go":  "package api\n",
+		"services/api/local.env":      "SECRET=1\n",
+		"services/api/tmp/cache.txt":  "cache\n",
+		"services/api/handlers/x.go":  "package handlers\n",
+		"services/worker/worker.go":   "package worker\n",
+		"services/api/.gingestignore": "handlers/\n",
+	})
+
+	// Paths are relative to the subdirectory, and ignore files above it still apply
+	paths := walkedPaths(t, testDir, Config{Subdir: "services/api/"})
+	expected := []string{".gingestignore", "server.go"}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+
+	_, stats, err := ProcessLocalDirectoryWithConfig(testDir, Config{Subdir: "services/api"})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+	if stats.Subdir != "services/api" {
+		t.Errorf("Expected subdir services/api, got %q", stats.Subdir)
+	}
+
+	for _, subdir := range []string{"missing", "main.go", "../outside", "/abs"} {
+		if _, _, err := ProcessLocalDirectoryWithConfig(testDir, Config{Subdir: subdir}); err == nil {
+			t.Errorf("Expected error for subdirectory %q", subdir)
+		}
+	}
+}
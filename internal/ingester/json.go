@@ -0,0 +1,98 @@
+package ingester
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// jsonFile is the JSON representation of a single file in a digest
+type jsonFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Binary     bool   `json:"binary"`
+	Language   string `json:"language,omitempty"`
+	SkipReason string `json:"skip_reason,omitempty"`
+	Tokens     int    `json:"tokens"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Content    string `json:"content"`
+
+	Change  *types.FileChange `json:"change,omitempty"`  // How the file changed, in diff digests
+	Related bool              `json:"related,omitempty"` // Included because it references a changed file
+
+	LastCommit *types.Commit `json:"last_commit,omitempty"` // Last commit that changed the file, when history is included
+}
+
+// jsonDigest is the JSON representation of a whole digest
+type jsonDigest struct {
+	Generated string      `json:"generated"`
+	Stats     types.Stats `json:"stats"`
+	Tree      string      `json:"tree"`
+	Files     []jsonFile  `json:"files"`
+}
+
+// newJSONFile converts a FileInfo into its JSON record. Placeholder content
+// for skipped files is dropped since the skip reason carries that information.
+func newJSONFile(fileInfo types.FileInfo) jsonFile {
+	record := jsonFile{
+		Path:       fileInfo.RelativePath,
+		Size:       fileInfo.Size,
+		Binary:     fileInfo.IsBinary,
+		Language:   fileInfo.Language,
+		SkipReason: fileInfo.SkipReason,
+		Tokens:     fileInfo.Tokens,
+		Truncated:  fileInfo.Truncated,
+		Change:     fileInfo.Change,
+		Related:    fileInfo.Related,
+		LastCommit: fileInfo.LastCommit,
+	}
+	if fileInfo.SkipReason == "" {
+		record.Content = fileInfo.Content
+	}
+	return record
+}
+
+// WriteJSONDigest writes the digest to w as a single JSON document holding
+// the stats, the directory tree and a files array
+func WriteJSONDigest(w io.Writer, filesData []types.FileInfo, stats types.Stats) error {
+	digest := jsonDigest{
+		Generated: time.Now().Format(time.RFC3339),
+		Stats:     stats,
+		Tree:      treeString(filesData, stats),
+		Files:     []jsonFile{},
+	}
+
+	for _, fileInfo := range orderFiles(filesData) {
+		digest.Files = append(digest.Files, newJSONFile(fileInfo))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(digest); err != nil {
+		return fmt.Errorf("failed to write JSON digest: %w", err)
+	}
+
+	return nil
+}
+
+// WriteJSONLDigest writes the digest to w as JSON Lines, one record per file
+func WriteJSONLDigest(w io.Writer, filesData []types.FileInfo, stats types.Stats) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	for _, fileInfo := range orderFiles(filesData) {
+		if err := encoder.Encode(newJSONFile(fileInfo)); err != nil {
+			return fmt.Errorf("failed to write JSONL record for %s: %w", fileInfo.RelativePath, err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to flush JSONL digest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package ingester
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// Order decides the order of the files in a digest
+type Order string
+
+// Supported file orders
+const (
+	OrderPath   Order = "path"   // README files first, then alphabetical
+	OrderChurn  Order = "churn"  // Files changed by the most commits first
+	OrderRecent Order = "recent" // Most recently committed files first
+	OrderSize   Order = "size"   // Largest files first
+	OrderDepth  Order = "depth"  // Files closest to the root first
+	OrderCustom Order = "custom" // Files matching the order globs first, in glob order
+)
+
+// ParseOrder converts an order name into an Order
+func ParseOrder(name string) (Order, error) {
+	switch Order(strings.ToLower(strings.TrimSpace(name))) {
+	case "", OrderPath:
+		return OrderPath, nil
+	case OrderChurn:
+		return OrderChurn, nil
+	case OrderRecent:
+		return OrderRecent, nil
+	case OrderSize:
+		return OrderSize, nil
+	case OrderDepth:
+		return OrderDepth, nil
+	case OrderCustom:
+		return OrderCustom, nil
+	}
+	return "", fmt.Errorf("unsupported order %q (expected path, churn, recent, size, depth or custom)", name)
+}
+
+// usesHistory reports whether the order is read from the commit log
+func (o Order) usesHistory() bool {
+	return o == OrderChurn || o == OrderRecent
+}
+
+// addOrder records config.Order in stats and returns the rank of each file
+// in stats.AllPaths, or nil for the default order
+func addOrder(fsys fs.FS, stats *types.Stats, history *fileHistory, config Config) (map[string]int, error) {
+	ranks, err := rankFiles(fsys, stats.AllPaths, history, config)
+	if err != nil {
+		return nil, err
+	}
+	if ranks != nil {
+		stats.Order = string(config.Order)
+	}
+	return ranks, nil
+}
+
+// rankFiles returns the position of each of paths in the digest under
+// config.Order, starting at 1, or nil for the default order. Files in fsys
+// are only looked at to order by size. Files that were never committed come
+// last when ordering by churn or recency, and ties follow the default order.
+func rankFiles(fsys fs.FS, paths []string, history *fileHistory, config Config) (map[string]int, error) {
+	if config.Order == "" || config.Order == OrderPath {
+		return nil, nil
+	}
+
+	ordered := orderPaths(paths, nil)
+	var less func(a, b string) bool
+
+	switch config.Order {
+	case OrderChurn:
+		less = func(a, b string) bool {
+			return history.commitCount(a) > history.commitCount(b)
+		}
+	case OrderRecent:
+		less = func(a, b string) bool {
+			commitA, commitB := history.lastCommit(a), history.lastCommit(b)
+			if commitA == nil || commitB == nil {
+				return commitB == nil && commitA != nil
+			}
+			return commitA.Date.After(commitB.Date)
+		}
+	case OrderSize:
+		sizes := make(map[string]int64, len(paths))
+		for _, relPath := range paths {
+			info, err := fs.Stat(fsys, relPath)
+			if err != nil {
+				continue // Read errors are reported with the file
+			}
+			sizes[relPath] = info.Size()
+		}
+		less = func(a, b string) bool {
+			return sizes[a] > sizes[b]
+		}
+	case OrderDepth:
+		less = func(a, b string) bool {
+			return strings.Count(a, "/") < strings.Count(b, "/")
+		}
+	case OrderCustom:
+		less = func(a, b string) bool {
+			return globRank(a, config.OrderGlobs) < globRank(b, config.OrderGlobs)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported order %q", config.Order)
+	}
+
+	// Stable sorting from the default order breaks ties the same way everywhere
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return less(ordered[i], ordered[j])
+	})
+
+	ranks := make(map[string]int, len(ordered))
+	for i, relPath := range ordered {
+		ranks[relPath] = i + 1
+	}
+	return ranks, nil
+}
@@ -0,0 +1,180 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/tokenizer"
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// createOrderRepo builds a work tree whose files differ in commit count,
+// last commit date, size and depth, and returns its directory
+func createOrderRepo(t *testing.T) string {
+	t.Helper()
+	isolateGit(t)
+
+	dir := t.TempDir()
+	commit := func(date string, files map[string]string) {
+		t.Helper()
+		commitFiles(t, dir, []string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}, "Commit of "+date, files)
+	}
+
+	testGit(t, dir, nil, "init", "--quiet", "--initial-branch=main")
+	commit("2024-01-01T10:00:00Z", map[string]string{
+		"README.md":        "# App\n",
+		"big.txt":          strings.Repeat("x", 100),
+		"docs/guide.md":    "# Guide\n",
+		"src/core/core.go": "package core\n",
+		"src/util.go":      "package src\n",
+	})
+	commit("2024-02-01T10:00:00Z", map[string]string{"src/core/core.go": "package core\n\n// v2\n"})
+	commit("2024-03-01T10:00:00Z", map[string]string{"src/core/core.go": "package core\n\n// v3\n", "src/util.go": "package src\n\n// v2\n"})
+	commit("2024-04-01T10:00:00Z", map[string]string{"docs/guide.md": "# Guide\n\nv2\n"})
+
+	createWalkTestFiles(t, dir, map[string]string{"src/new.go": "package src\n"})
+	return dir
+}
+
+// fileOrder returns the paths of the FILE blocks of a Markdown digest in order
+func fileOrder(digest string) []string {
+	var paths []string
+	for _, line := range strings.Split(digest, "\n") {
+		if strings.HasPrefix(line, "FILE: ") {
+			paths = append(paths, strings.TrimPrefix(line, "FILE: "))
+		}
+	}
+	return paths
+}
+
+func TestParseOrder(t *testing.T) {
+	for _, name := range []string{"", "path", "churn", "recent", "size", "depth", "custom", "CHURN"} {
+		if _, err := ParseOrder(name); err != nil {
+			t.Errorf("ParseOrder(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := ParseOrder("random"); err == nil {
+		t.Error("Expected error for unknown order")
+	}
+}
+
+func TestWriteDigest_Order(t *testing.T) {
+	dir := createOrderRepo(t)
+
+	testCases := []struct {
+		order    Order
+		globs    []string
+		expected []string
+	}{
+		{OrderPath, nil, []string{"README.md", "big.txt", "docs/guide.md", "src/core/core.go", "src/new.go", "src/util.go"}},
+		{OrderChurn, nil, []string{"src/core/core.go", "docs/guide.md", "src/util.go", "README.md", "big.txt", "src/new.go"}},
+		{OrderRecent, nil, []string{"docs/guide.md", "src/core/core.go", "src/util.go", "README.md", "big.txt", "src/new.go"}},
+		{OrderSize, nil, []string{"big.txt", "src/core/core.go", "src/util.go", "docs/guide.md", "src/new.go", "README.md"}},
+		{OrderDepth, nil, []string{"README.md", "big.txt", "docs/guide.md", "src/new.go", "src/util.go", "src/core/core.go"}},
+		{OrderCustom, []string{"src/**", "*.md"}, []string{"src/core/core.go", "src/new.go", "src/util.go", "README.md", "docs/guide.md", "big.txt"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.order), func(t *testing.T) {
+			config := Config{Order: tc.order, OrderGlobs: tc.globs, ExcludePatterns: []string{".git/"}}
+			filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, config)
+			if err != nil {
+				t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+			}
+			var digest bytes.Buffer
+			if err := WriteDigestTo(&digest, filesData, stats); err != nil {
+				t.Fatalf("WriteDigestTo failed: %v", err)
+			}
+			if order := fileOrder(digest.String()); strings.Join(order, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected order %v, got %v", tc.expected, order)
+			}
+
+			// Streaming reads the files in the same order
+			var streamed bytes.Buffer
+			if _, err := StreamLocalDirectoryContext(context.Background(), &streamed, FormatMarkdown, dir, config); err != nil {
+				t.Fatalf("StreamLocalDirectoryContext failed: %v", err)
+			}
+			if order := fileOrder(streamed.String()); strings.Join(order, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected streamed order %v, got %v", tc.expected, order)
+			}
+
+			expectedLine := "**File Order:** " + string(tc.order)
+			if strings.Contains(digest.String(), expectedLine) != (tc.order != OrderPath) {
+				t.Errorf("Expected %q only for a non-default order", expectedLine)
+			}
+		})
+	}
+}
+
+func TestApplyTokenBudget_Order(t *testing.T) {
+	dir := createOrderRepo(t)
+	estimator := tokenizer.Default
+
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{Order: OrderChurn, ExcludePatterns: []string{".git/"}})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+
+	// Room for the hottest file, the budget line and too little to truncate another
+	hottest := findFile(filesData, "src/core/core.go")
+	layout := budgetLayout{format: FormatMarkdown, estimator: estimator, numFiles: len(filesData)}
+	maxTokens := layout.fixedOverhead(filesData, stats) + estimator.CountTokens(fileHeader(hottest.RelativePath, nil)+fileFooter) + hottest.Tokens + 30
+	result, _ := ApplyTokenBudget(filesData, stats, Budget{MaxTokens: maxTokens, Estimator: estimator})
+
+	for _, fileInfo := range result {
+		omitted := fileInfo.RelativePath != "src/core/core.go"
+		if fileInfo.Omitted != omitted {
+			t.Errorf("Expected %s omitted=%v, got %v", fileInfo.RelativePath, omitted, fileInfo.Omitted)
+		}
+	}
+}
+
+func TestProcessRemoteRepo_Order(t *testing.T) {
+	dir := createOrderRepo(t)
+
+	tempDir, filesData, _, err := ProcessRemoteRepoContext(context.Background(), fileURL(dir), "", Config{Order: OrderChurn})
+	if err != nil {
+		t.Fatalf("ProcessRemoteRepoContext failed: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if first := orderFiles(filesData)[0].RelativePath; first != "src/core/core.go" {
+		t.Errorf("Expected the most changed file first, got %s", first)
+	}
+}
+
+func TestProcessLocalDirectory_OrderErrors(t *testing.T) {
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{"main.go": "package main\n", "lib/lib.go": "package lib\n\nfunc Lib() {}\n"})
+
+	if _, _, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{Order: OrderRecent}); err == nil || !strings.Contains(err.Error(), "ordering by recent requires a Git repository") {
+		t.Errorf("Expected recency to require a Git repository, got %v", err)
+	}
+
+	// Orders that don't read the history work anywhere
+	filesData, _, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{Order: OrderSize})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+	if ordered := orderFiles(filesData); ordered[0].RelativePath != "lib/lib.go" || ordered[0].Rank != 1 {
+		t.Errorf("Expected the largest file first, got %+v", ordered[0])
+	}
+}
+
+func TestOrderFiles_Rank(t *testing.T) {
+	filesData := []types.FileInfo{
+		{RelativePath: "a.go", Rank: 3},
+		{RelativePath: "README.md", Rank: 2},
+		{RelativePath: "z.go", Rank: 1},
+	}
+	var paths []string
+	for _, fileInfo := range orderFiles(filesData) {
+		paths = append(paths, fileInfo.RelativePath)
+	}
+	if strings.Join(paths, ",") != "z.go,README.md,a.go" {
+		t.Errorf("Expected files by rank, got %v", paths)
+	}
+}
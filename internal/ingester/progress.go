@@ -0,0 +1,96 @@
+package ingester
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// reporter serializes progress events from the walk and the read workers and
+// keeps the running counts. A reporter without a Func does nothing.
+type reporter struct {
+	mu    sync.Mutex
+	fn    progress.Func
+	event progress.Event
+}
+
+// newReporter returns a reporter for fn, which may be nil
+func newReporter(fn progress.Func) *reporter {
+	return &reporter{fn: fn}
+}
+
+// discovered reports a file found by the walk
+func (r *reporter) discovered(relPath string) {
+	if r.fn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event.Discovered++
+	r.emit(progress.KindFileDiscovered, progress.Event{Path: relPath})
+}
+
+// start records the number of files about to be read
+func (r *reporter) start(total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event.Total = total
+}
+
+// read reports a file that was read, or skipped if it had no usable content
+func (r *reporter) read(fileInfo types.FileInfo) {
+	if r.fn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event.Processed++
+	event := progress.Event{
+		Path:       fileInfo.RelativePath,
+		SkipReason: fileInfo.SkipReason,
+		Err:        fileInfo.Error,
+		Size:       fileInfo.Size,
+	}
+	if fileInfo.Error != nil || fileInfo.SkipReason != "" {
+		r.emit(progress.KindFileSkipped, event)
+		return
+	}
+	r.emit(progress.KindFileRead, event)
+}
+
+// emit sends event with the running counts filled in. The caller holds r.mu.
+func (r *reporter) emit(kind progress.Kind, event progress.Event) {
+	event.Kind = kind
+	event.Discovered = r.event.Discovered
+	event.Processed = r.event.Processed
+	event.Total = r.event.Total
+	r.fn(event)
+}
+
+// cloneOutput collects the output of git clone and reports its progress
+// lines, which git separates with carriage returns while it counts
+type cloneOutput struct {
+	output bytes.Buffer
+	line   []byte
+	fn     progress.Func
+}
+
+func (c *cloneOutput) Write(p []byte) (int, error) {
+	c.output.Write(p)
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			c.line = append(c.line, b)
+			continue
+		}
+		if message := strings.TrimSpace(string(c.line)); message != "" {
+			c.fn(progress.Event{Kind: progress.KindCloneProgress, Message: message})
+		}
+		c.line = c.line[:0]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,78 @@
+package ingester
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/progress"
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+func TestProcessLocalDirectory_Progress(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{
+		"main.go":    "package main\n",
+		"lib/lib.go": "package lib\n",
+		"big.txt":    string(bytes.Repeat([]byte("x"), 100)),
+		"image.bin":  "\x00\x01\x02binary",
+	})
+
+	var mu sync.Mutex
+	counts := make(map[progress.Kind]int)
+	var last progress.Event
+	config := Config{MaxFileSize: 50, Workers: 2, Progress: func(event progress.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[event.Kind]++
+		last = event
+	}}
+
+	if _, _, err := ProcessLocalDirectoryWithConfig(testDir, config); err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+
+	if counts[progress.KindFileDiscovered] != 4 {
+		t.Errorf("Expected 4 discovered events, got %d", counts[progress.KindFileDiscovered])
+	}
+	if counts[progress.KindFileRead] != 2 || counts[progress.KindFileSkipped] != 2 {
+		t.Errorf("Expected 2 read and 2 skipped events, got %v", counts)
+	}
+	if last.Processed != 4 || last.Total != 4 || last.Discovered != 4 {
+		t.Errorf("Expected final counts of 4, got %+v", last)
+	}
+}
+
+func TestReporter_SkipReason(t *testing.T) {
+	var events []progress.Event
+	r := newReporter(func(event progress.Event) { events = append(events, event) })
+	r.start(1)
+	r.read(types.FileInfo{RelativePath: "big.bin", SkipReason: types.SkipReasonTooLarge, Size: 10})
+
+	if len(events) != 1 || events[0].Kind != progress.KindFileSkipped || events[0].SkipReason != types.SkipReasonTooLarge {
+		t.Errorf("Expected a skip event for the large file, got %+v", events)
+	}
+}
+
+func TestCloneOutput(t *testing.T) {
+	var messages []string
+	output := &cloneOutput{fn: func(event progress.Event) {
+		messages = append(messages, event.Message)
+	}}
+
+	output.Write([]byte("Cloning into 'repo'...\nReceiving objects:  50% (1/2)\rReceiv"))
+	output.Write([]byte("ing objects: 100% (2/2), done.\n\n"))
+
+	expected := []string{"Cloning into 'repo'...", "Receiving objects:  50% (1/2)", "Receiving objects: 100% (2/2), done."}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], messages[i])
+		}
+	}
+	if output.output.Len() == 0 {
+		t.Error("Expected the raw output to be kept for error messages")
+	}
+}
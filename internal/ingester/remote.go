@@ -1,10 +1,16 @@
 package ingester
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/prashanth1k/gingest/internal/progress"
 	"github.com/prashanth1k/gingest/internal/types"
 )
 
@@ -21,10 +27,25 @@ func ProcessRemoteRepoWithOptions(gitURL string, targetBranch string, maxFileSiz
 
 // ProcessRemoteRepoWithPatterns clones a Git repository and processes its files with patterns
 func ProcessRemoteRepoWithPatterns(gitURL string, targetBranch string, maxFileSize int64, includePatterns, excludePatterns []string) (string, []types.FileInfo, types.Stats, error) {
-	// Create temporary directory for cloning
-	tempDir, err := os.MkdirTemp("", "gingest-clone-*")
+	return ProcessRemoteRepoWithConfig(gitURL, targetBranch, Config{
+		MaxFileSize:     maxFileSize,
+		IncludePatterns: includePatterns,
+		ExcludePatterns: excludePatterns,
+	})
+}
+
+// ProcessRemoteRepoWithConfig clones a Git repository and processes its files using the given config
+func ProcessRemoteRepoWithConfig(gitURL string, targetBranch string, config Config) (string, []types.FileInfo, types.Stats, error) {
+	return ProcessRemoteRepoContext(context.Background(), gitURL, targetBranch, config)
+}
+
+// ProcessRemoteRepoContext clones a Git repository and processes its files
+// using the given config. Cancelling ctx kills the clone or stops processing,
+// and the temporary clone is removed either way.
+func ProcessRemoteRepoContext(ctx context.Context, gitURL string, targetBranch string, config Config) (string, []types.FileInfo, types.Stats, error) {
+	tempDir, commit, err := cloneRepo(ctx, gitURL, targetBranch, config)
 	if err != nil {
-		return "", nil, types.Stats{}, fmt.Errorf("failed to create temp directory: %w", err)
+		return "", nil, types.Stats{}, err
 	}
 
 	// Defer cleanup
@@ -32,32 +53,263 @@ func ProcessRemoteRepoWithPatterns(gitURL string, targetBranch string, maxFileSi
 		os.RemoveAll(tempDir)
 	}()
 
+	// Process the cloned directory with size filtering and patterns
+	filesData, stats, err := ProcessLocalDirectoryContext(ctx, tempDir, config)
+	if err != nil {
+		return "", nil, types.Stats{}, fmt.Errorf("failed to process cloned directory: %w", err)
+	}
+
+	setRemoteStats(&stats, gitURL, targetBranch, commit, config)
+
+	return tempDir, filesData, stats, nil
+}
+
+// setRemoteStats records where a cloned repository came from
+func setRemoteStats(stats *types.Stats, gitURL, targetBranch, commit string, config Config) {
+	stats.Source = gitURL
+	stats.Commit = commit
+	if config.Ref != "" {
+		stats.Ref = config.Ref
+	} else {
+		stats.Branch = targetBranch
+	}
+}
+
+// cloneRepo clones the repository into a new temporary directory and returns
+// it with the commit SHA that was checked out. config.Ref, if set, takes the
+// place of targetBranch. With config.Subdir set, only that subtree is fetched
+// when the server and the local git support partial clone and sparse
+// checkout; otherwise the whole tree is cloned. The caller removes the
+// directory; on error it is already gone. With config.CacheDir set, the
+// clone is made from an up-to-date cached mirror of gitURL.
+func cloneRepo(ctx context.Context, gitURL string, targetBranch string, config Config) (string, string, error) {
+	if config.CacheDir != "" {
+		mirrorURL, unlock, err := syncMirror(ctx, config.CacheDir, gitURL, config.Progress)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", "", ctx.Err()
+			}
+			return "", "", fmt.Errorf("failed to update cached mirror: %w", err)
+		}
+		defer unlock()
+		gitURL = mirrorURL
+	}
+
+	// Create temporary directory for cloning
+	tempDir, err := os.MkdirTemp("", "gingest-clone-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	sparseDir := sparseSubdir(config.Subdir)
+	err = cloneInto(ctx, tempDir, gitURL, targetBranch, sparseDir, config)
+	if err != nil && sparseDir != "" && ctx.Err() == nil {
+		// Fall back to a full clone, for git versions without sparse checkout
+		if err = resetDir(tempDir); err == nil {
+			err = cloneInto(ctx, tempDir, gitURL, targetBranch, "", config)
+		}
+	}
+
+	var commit string
+	if err == nil {
+		commit, err = gitOutput(ctx, tempDir, "rev-parse", "HEAD")
+	}
+	if err != nil {
+		os.RemoveAll(tempDir)
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", err
+	}
+
+	return tempDir, commit, nil
+}
+
+// cloneInto clones the repository into the empty directory dir. With
+// sparseDir set, it makes a blobless clone and checks out only sparseDir and
+// the files in its parent directories, which hold the ignore files that
+// apply to it. Servers without partial clone support send every blob, but
+// the checkout stays sparse. Only the checked out commit is fetched unless
+// config needs the history, which is then fetched without old blobs.
+func cloneInto(ctx context.Context, dir, gitURL, targetBranch, sparseDir string, config Config) error {
+	depth := cloneDepth(config)
+	if config.Ref != "" {
+		return fetchRef(ctx, dir, gitURL, config.Ref, sparseDir, depth, config.Progress)
+	}
+
 	// Construct git clone command
-	args := []string{"clone", "--depth", "1"}
+	args := append([]string{"clone"}, progressFlags(config.Progress)...)
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	if sparseDir != "" || depth == 0 {
+		args = append(args, "--filter=blob:none")
+	}
+	if sparseDir != "" {
+		args = append(args, "--sparse")
+	}
 
 	// Add branch-specific arguments if targetBranch is specified
 	if targetBranch != "" {
 		args = append(args, "-b", targetBranch, "--single-branch")
 	}
 
-	args = append(args, gitURL, tempDir)
+	args = append(args, gitURL, dir)
+	if err := runGit(ctx, config.Progress, args...); err != nil {
+		return err
+	}
+
+	if sparseDir != "" {
+		return runGit(ctx, config.Progress, "-C", dir, "sparse-checkout", "set", "--cone", sparseDir)
+	}
+	return nil
+}
+
+// cloneDepth returns the number of commits to fetch for a digest, or 0 for
+// the whole history, which the history section and history orders need
+func cloneDepth(config Config) int {
+	if config.needsHistory() {
+		return 0
+	}
+	return 1
+}
 
-	// Execute git clone
-	cmd := exec.Command("git", args...)
-	output, err := cmd.CombinedOutput()
+// sparseSubdir returns subdir as a sparse checkout pattern, or "" if the
+// whole tree is needed or subdir isn't a plain relative path
+func sparseSubdir(subdir string) string {
+	subdir = path.Clean(filepath.ToSlash(subdir))
+	if subdir == "." || path.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+		return ""
+	}
+	return subdir
+}
+
+// resetDir removes everything inside dir
+func resetDir(dir string) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return "", nil, types.Stats{}, fmt.Errorf("git clone failed: %w\nOutput: %s", err, string(output))
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Process the cloned directory with size filtering and patterns
-	filesData, stats, err := ProcessLocalDirectoryWithPatterns(tempDir, maxFileSize, includePatterns, excludePatterns)
+// fetchRef checks out ref, a branch, tag or full or abbreviated commit SHA,
+// into dir. It fetches only that commit, or depth commits of history (0 for
+// all of it), when the server allows it, and falls back to fetching all
+// branches and tags and resolving ref locally, which abbreviated SHAs always
+// need. With sparseDir set or the whole history fetched, blobs are fetched
+// on demand, and with sparseDir only that directory is checked out, as in
+// cloneInto.
+func fetchRef(ctx context.Context, dir, gitURL, ref, sparseDir string, depth int, progressFunc progress.Func) error {
+	if err := runGit(ctx, nil, "init", "--quiet", dir); err != nil {
+		return err
+	}
+	if err := runGit(ctx, nil, "-C", dir, "remote", "add", "origin", gitURL); err != nil {
+		return err
+	}
+
+	fetch := append([]string{"-C", dir, "fetch"}, progressFlags(progressFunc)...)
+	if sparseDir != "" {
+		if err := runGit(ctx, nil, "-C", dir, "sparse-checkout", "set", "--cone", sparseDir); err != nil {
+			return err
+		}
+	}
+	if sparseDir != "" || depth == 0 {
+		fetch = append(fetch, "--filter=blob:none")
+	}
+
+	commit, err := fetchCommit(ctx, dir, gitURL, ref, depth, fetch, progressFunc)
 	if err != nil {
-		return "", nil, types.Stats{}, fmt.Errorf("failed to process cloned directory: %w", err)
+		return err
 	}
+	return runGit(ctx, nil, "-C", dir, "checkout", "--quiet", "--detach", commit)
+}
 
-	// Update stats with Git-specific information
-	stats.Source = gitURL
-	stats.Branch = targetBranch
+// fetchCommit fetches ref from the origin remote of the repository in dir
+// with the fetch command line and returns its commit SHA. Only ref and depth
+// commits of its history (0 for all of it) are fetched when the server
+// allows it; otherwise all branches and tags are fetched and ref is resolved
+// locally.
+func fetchCommit(ctx context.Context, dir, gitURL, ref string, depth int, fetch []string, progressFunc progress.Func) (string, error) {
+	args := fetch
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	shallowErr := runGit(ctx, progressFunc, append(args, "origin", ref)...)
+	if shallowErr == nil {
+		return gitOutput(ctx, dir, "rev-parse", "FETCH_HEAD^{commit}")
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
 
-	return tempDir, filesData, stats, nil
+	if err := runGit(ctx, progressFunc, append(fetch, "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*")...); err != nil {
+		return "", err
+	}
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		commit, err := gitOutput(ctx, dir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err == nil {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("ref %q not found in %s: %w", ref, gitURL, shallowErr)
+}
+
+// progressFlags returns the flags that make git clone and fetch report
+// progress, which they only do on a terminal unless asked
+func progressFlags(progressFunc progress.Func) []string {
+	if progressFunc == nil {
+		return nil
+	}
+	return []string{"--progress"}
+}
+
+// runGit runs a git command, reporting its output lines to progressFunc if
+// it is set. The command's output is included in the error if it fails.
+func runGit(ctx context.Context, progressFunc progress.Func, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var output []byte
+	var err error
+	if progressFunc != nil {
+		cloneOut := &cloneOutput{fn: progressFunc}
+		cmd.Stdout, cmd.Stderr = cloneOut, cloneOut
+		err = cmd.Run()
+		output = cloneOut.output.Bytes()
+	} else {
+		output, err = cmd.CombinedOutput()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("git %s failed: %w\nOutput: %s", gitCommandName(args), err, string(output))
+	}
+	return nil
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitCommandName returns the git subcommand in args, skipping -C options
+func gitCommandName(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-C" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
 }
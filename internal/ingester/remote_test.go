@@ -0,0 +1,177 @@
+package ingester
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRepo is a bare repository with two commits on main, a tag on the
+// first commit and a feature branch with a third commit
+type testRepo struct {
+	url     string
+	first   string // SHA of the first commit, tagged v1.0
+	second  string // SHA of the second commit, the head of main
+	feature string // SHA of the commit on the feature branch
+}
+
+// createTestRepo builds a testRepo below t.TempDir, skipping the test without git
+func createTestRepo(t *testing.T) testRepo {
+	t.Helper()
+	isolateGit(t)
+
+	work := t.TempDir()
+	commit := func(content string) string {
+		t.Helper()
+		commitFiles(t, work, nil, content, map[string]string{"version.txt": content})
+		return testGit(t, work, nil, "rev-parse", "HEAD")
+	}
+
+	testGit(t, work, nil, "init", "--quiet", "--initial-branch=main")
+	repo := testRepo{first: commit("first\n")}
+	testGit(t, work, nil, "tag", "-a", "v1.0", "-m", "v1.0")
+	repo.second = commit("second\n")
+	testGit(t, work, nil, "checkout", "--quiet", "-b", "feature")
+	repo.feature = commit("feature\n")
+	testGit(t, work, nil, "checkout", "--quiet", "main")
+
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	if output, err := exec.Command("git", "clone", "--quiet", "--bare", work, bare).CombinedOutput(); err != nil {
+		t.Fatalf("git clone --bare failed: %v\n%s", err, output)
+	}
+	repo.url = "file://" + filepath.ToSlash(bare)
+	return repo
+}
+
+func TestProcessRemoteRepo_Ref(t *testing.T) {
+	repo := createTestRepo(t)
+
+	testCases := []struct {
+		ref      string
+		branch   string
+		commit   string
+		expected string
+		desc     string
+	}{
+		{"", "", repo.second, "second\n", "Default branch"},
+		{"", "feature", repo.feature, "feature\n", "Branch argument"},
+		{"feature", "", repo.feature, "feature\n", "Branch ref"},
+		{"v1.0", "", repo.first, "first\n", "Annotated tag"},
+		{repo.first, "", repo.first, "first\n", "Full SHA"},
+		{repo.first[:8], "", repo.first, "first\n", "Short SHA"},
+		{"v1.0", "feature", repo.first, "first\n", "Ref overrides the branch"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, filesData, stats, err := ProcessRemoteRepoContext(context.Background(), repo.url, tc.branch, Config{Ref: tc.ref, ExcludePatterns: []string{".git"}})
+			if err != nil {
+				t.Fatalf("ProcessRemoteRepoContext failed: %v", err)
+			}
+			if stats.Commit != tc.commit {
+				t.Errorf("Expected commit %s, got %s", tc.commit, stats.Commit)
+			}
+			if stats.Ref != tc.ref {
+				t.Errorf("Expected ref %q, got %q", tc.ref, stats.Ref)
+			}
+			if tc.ref != "" && stats.Branch != "" {
+				t.Errorf("Expected no branch when a ref is checked out, got %q", stats.Branch)
+			}
+			if len(filesData) != 1 || filesData[0].Content != tc.expected {
+				t.Errorf("Expected version.txt with %q, got %+v", tc.expected, filesData)
+			}
+		})
+	}
+}
+
+func TestProcessRemoteRepo_MissingRef(t *testing.T) {
+	repo := createTestRepo(t)
+
+	_, _, _, err := ProcessRemoteRepoContext(context.Background(), repo.url, "", Config{Ref: "no-such-ref"})
+	if err == nil || !strings.Contains(err.Error(), "no-such-ref") {
+		t.Errorf("Expected error naming the missing ref, got %v", err)
+	}
+}
+
+func TestCloneRepo_Sparse(t *testing.T) {
+	files := map[string]string{
+		".gitignore":         "*.log\n",
+		"README.md":          "# Monorepo\n",
+		"pkg/.gingestignore": "*.tmp\n",
+		"pkg/foo/foo.go":     "package foo\n",
+		"pkg/foo/foo.log":    "log\n",
+		"pkg/foo/foo.tmp":    "tmp\n",
+		"pkg/bar/bar.go":     "package bar\n",
+		"other/big.txt":      strings.Repeat("x", 1000),
+	}
+
+	testCases := []struct {
+		serverConfig []string
+		ref          string
+		partial      bool
+		desc         string
+	}{
+		{[]string{"uploadpack.allowFilter", "true"}, "", true, "Partial clone"},
+		{[]string{"uploadpack.allowFilter", "true", "uploadpack.allowAnySHA1InWant", "true"}, "v1.0", true, "Partial fetch of a ref"},
+		{nil, "", false, "Server without partial clone support"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			url := createBareRepo(t, files, tc.serverConfig...)
+			config := Config{Subdir: "pkg/foo", Ref: tc.ref}
+
+			dir, commit, err := cloneRepo(context.Background(), url, "", config)
+			if err != nil {
+				t.Fatalf("cloneRepo failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			if commit == "" {
+				t.Error("Expected the checked out commit")
+			}
+			for _, name := range []string{".gitignore", "pkg/.gingestignore", "pkg/foo/foo.go"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Errorf("Expected %s to be checked out: %v", name, err)
+				}
+			}
+			for _, name := range []string{"pkg/bar", "other"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					t.Errorf("Expected %s outside the sparse checkout to be missing", name)
+				}
+			}
+
+			// Blobs outside the subtree are only left out when the server filters
+			missing, err := gitOutput(context.Background(), dir, "rev-list", "--objects", "--all", "--missing=print")
+			if err != nil {
+				t.Fatalf("git rev-list failed: %v", err)
+			}
+			if partial := strings.Contains(missing, "\n?") || strings.HasPrefix(missing, "?"); partial != tc.partial {
+				t.Errorf("Expected partial=%v, got objects:\n%s", tc.partial, missing)
+			}
+		})
+	}
+}
+
+func TestProcessRemoteRepo_Subdir(t *testing.T) {
+	url := createBareRepo(t, map[string]string{
+		".gitignore":      "*.log\n",
+		"pkg/foo/foo.go":  "package foo\n",
+		"pkg/foo/foo.log": "log\n",
+		"pkg/bar/bar.go":  "package bar\n",
+	}, "uploadpack.allowFilter", "true")
+
+	_, filesData, stats, err := ProcessRemoteRepoContext(context.Background(), url, "", Config{Subdir: "pkg/foo"})
+	if err != nil {
+		t.Fatalf("ProcessRemoteRepoContext failed: %v", err)
+	}
+	if len(filesData) != 1 || filesData[0].RelativePath != "foo.go" {
+		t.Errorf("Expected only foo.go, got %+v", filesData)
+	}
+	if stats.Subdir != "pkg/foo" {
+		t.Errorf("Expected subdir pkg/foo, got %q", stats.Subdir)
+	}
+}
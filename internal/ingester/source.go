@@ -0,0 +1,372 @@
+package ingester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// source is the tree a digest is read from: the directory on disk, or a
+// revision of the Git repository it belongs to, read straight from the object
+// database without touching the working copy
+type source struct {
+	fsys    fs.FS  // Files below the source root, by slash-separated path
+	rootDir string // Directory the source was opened from
+	onDisk  bool   // Whether fsys reads the directory itself, so files have absolute paths
+	commit  string // Commit SHA when reading a revision
+	close   func() error
+}
+
+// openSource opens rootDir as it is on disk, or at config.Rev if it is set.
+// The caller closes the source when done.
+func openSource(ctx context.Context, rootDir string, config Config) (*source, error) {
+	if config.Rev != "" {
+		return openRevision(ctx, rootDir, config.Rev)
+	}
+
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory", rootDir)
+	}
+	return &source{
+		fsys:    os.DirFS(rootDir),
+		rootDir: rootDir,
+		onDisk:  true,
+		close:   func() error { return nil },
+	}, nil
+}
+
+// files returns the files below the walked directory, subdir or the root,
+// and their absolute directory on disk ("" for a revision)
+func (s *source) files(subdir string) (fs.FS, string, error) {
+	fsys := s.fsys
+	if subdir != "" {
+		var err error
+		if fsys, err = fs.Sub(s.fsys, subdir); err != nil {
+			return nil, "", err
+		}
+	}
+	if !s.onDisk {
+		return fsys, "", nil
+	}
+
+	absRoot, err := filepath.Abs(filepath.Join(s.rootDir, filepath.FromSlash(subdir)))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return fsys, absRoot, nil
+}
+
+// openRevision opens rev of the Git repository containing rootDir. Only the
+// part of the tree below rootDir is visible, as with a working copy. Symbolic
+// links and submodules are left out, since their targets aren't part of the
+// revision's tree.
+func openRevision(ctx context.Context, rootDir, rev string) (*source, error) {
+	if _, err := gitOutput(ctx, rootDir, "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("revision %q requires a Git repository, and %s is not one", rev, rootDir)
+	}
+	commit, err := gitOutput(ctx, rootDir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("revision %q not found in %s", rev, rootDir)
+	}
+
+	// ls-tree run below the top of the work tree lists that directory only,
+	// with paths relative to it
+	cmd := exec.CommandContext(ctx, "git", "-C", rootDir, "ls-tree", "-r", "-t", "-l", "-z", commit)
+	listing, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("git ls-tree failed: %w", err)
+	}
+	tree, err := parseTree(listing)
+	if err != nil {
+		return nil, err
+	}
+
+	tree.blobs, err = startCatFile(ctx, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return &source{
+		fsys:    tree,
+		rootDir: rootDir,
+		commit:  commit,
+		close:   tree.blobs.close,
+	}, nil
+}
+
+// trackedFiles returns the files in the Git index below rootDir, which
+// includes staged files that aren't committed yet, by path relative to rootDir
+func trackedFiles(ctx context.Context, rootDir string) (map[string]bool, error) {
+	if _, err := gitOutput(ctx, rootDir, "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("tracked files require a Git repository, and %s is not one", rootDir)
+	}
+
+	// ls-files run below the top of the work tree lists that directory only,
+	// with paths relative to it
+	cmd := exec.CommandContext(ctx, "git", "-C", rootDir, "ls-files", "--cached", "-z")
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("git ls-files failed: %w", err)
+	}
+
+	tracked := make(map[string]bool)
+	for _, name := range bytes.Split(output, []byte{0}) {
+		if len(name) > 0 {
+			tracked[string(name)] = true
+		}
+	}
+	return tracked, nil
+}
+
+// gitTree is a read-only fs.FS over a Git tree listing. File contents are
+// read from the object database when a file is first read.
+type gitTree struct {
+	entries map[string]*gitEntry     // Every file and directory by path
+	dirs    map[string][]fs.DirEntry // Directory contents by path, sorted by name; "." is the root
+	blobs   *catFile
+}
+
+// gitEntry describes a file or directory of a gitTree
+type gitEntry struct {
+	name string
+	dir  bool
+	size int64
+	oid  string // Object ID of the blob, for files
+}
+
+func (e *gitEntry) Name() string               { return e.name }
+func (e *gitEntry) IsDir() bool                { return e.dir }
+func (e *gitEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *gitEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *gitEntry) Size() int64                { return e.size }
+func (e *gitEntry) ModTime() time.Time         { return time.Time{} }
+func (e *gitEntry) Sys() interface{}           { return nil }
+
+func (e *gitEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// parseTree builds a gitTree from the output of git ls-tree -r -t -l -z
+func parseTree(listing []byte) (*gitTree, error) {
+	tree := &gitTree{
+		entries: map[string]*gitEntry{".": {name: ".", dir: true}},
+		dirs:    map[string][]fs.DirEntry{".": nil},
+	}
+
+	for _, record := range bytes.Split(listing, []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+		// <mode> SP <type> SP <object> SP <size> TAB <path>
+		meta, name, ok := strings.Cut(string(record), "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", record)
+		}
+
+		entry := &gitEntry{name: path.Base(name)}
+		switch {
+		case fields[1] == "tree":
+			entry.dir = true
+			tree.dirs[name] = nil
+		case fields[1] == "blob" && fields[0] != "120000":
+			size, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected git ls-tree output %q", record)
+			}
+			entry.size, entry.oid = size, fields[2]
+		default:
+			continue // Symbolic links and submodules
+		}
+
+		tree.entries[name] = entry
+		parent := path.Dir(name)
+		tree.dirs[parent] = append(tree.dirs[parent], entry)
+	}
+
+	for _, entries := range tree.dirs {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+	}
+	return tree, nil
+}
+
+// lookup returns the entry at name, or an fs.PathError for op
+func (t *gitTree) lookup(op, name string) (*gitEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// Open opens the file or directory at name. File contents are read on the
+// first Read, so opening a file to check its size is cheap.
+func (t *gitTree) Open(name string) (fs.File, error) {
+	entry, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.dir {
+		return &gitDir{entry: entry, entries: t.dirs[name]}, nil
+	}
+	return &gitFile{entry: entry, blobs: t.blobs}, nil
+}
+
+// ReadDir returns the entries of the directory at name, sorted by name
+func (t *gitTree) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := t.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return append([]fs.DirEntry(nil), t.dirs[name]...), nil
+}
+
+// Stat returns the FileInfo of the file or directory at name
+func (t *gitTree) Stat(name string) (fs.FileInfo, error) {
+	entry, err := t.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// gitFile is an open file of a gitTree
+type gitFile struct {
+	entry  *gitEntry
+	blobs  *catFile
+	reader *bytes.Reader
+}
+
+func (f *gitFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *gitFile) Close() error               { return nil }
+
+func (f *gitFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		content, err := f.blobs.read(f.entry.oid)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: err}
+		}
+		f.reader = bytes.NewReader(content)
+	}
+	return f.reader.Read(p)
+}
+
+// gitDir is an open directory of a gitTree
+type gitDir struct {
+	entry   *gitEntry
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *gitDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *gitDir) Close() error               { return nil }
+
+func (d *gitDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *gitDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	d.offset += len(remaining)
+	return append([]fs.DirEntry(nil), remaining...), nil
+}
+
+// catFile reads blobs through a single long-running git cat-file --batch,
+// which is far cheaper than a git process per file. Reads are serialized.
+type catFile struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// startCatFile starts git cat-file --batch for the repository containing dir
+func startCatFile(ctx context.Context, dir string) (*catFile, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	return &catFile{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// read returns the content of the object oid
+func (c *catFile) read(oid string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := io.WriteString(c.stdin, oid+"\n"); err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+	// <oid> SP <type> SP <size> LF <content> LF, or <oid> SP missing LF
+	header, err := c.stdout.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("object %s not found", oid)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected git cat-file output %q", header)
+	}
+
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(c.stdout, content); err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+	return content[:size], nil
+}
+
+// close stops git cat-file
+func (c *catFile) close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
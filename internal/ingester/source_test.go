@@ -0,0 +1,280 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// createRevisionRepo builds a work tree whose tag v1 differs from its
+// uncommitted state, and returns its directory
+func createRevisionRepo(t *testing.T) string {
+	t.Helper()
+	isolateGit(t)
+
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{
+		".gitignore":          "*.log\n",
+		"README.md":           "# Project v1\n",
+		"debug.log":           "committed despite .gitignore\n",
+		"image.bin":           "\x00\x01\x02",
+		"pkg/.gingestignore":  "*.tmp\n",
+		"pkg/lib/lib.go":      "package lib\n",
+		"pkg/lib/scratch.tmp": "tmp\n",
+		"notebook.ipynb":      `{"cells": [{"cell_type": "code", "source": ["print(1)"]}]}`,
+	})
+	testGit(t, dir, nil, "init", "--quiet", "--initial-branch=main")
+	testGit(t, dir, nil, "add", "--force", ".")
+	if err := os.Symlink("README.md", filepath.Join(dir, "link.md")); err == nil {
+		testGit(t, dir, nil, "add", "link.md")
+	}
+	testGit(t, dir, nil, "commit", "--quiet", "-m", "v1")
+	testGit(t, dir, nil, "tag", "v1")
+
+	// Uncommitted work that the revision must not see
+	createWalkTestFiles(t, dir, map[string]string{
+		"README.md":      "# Project work in progress\n",
+		"untracked.go":   "package main\n",
+		"pkg/lib/new.go": "package lib\n",
+	})
+	return dir
+}
+
+func TestProcessLocalDirectory_Rev(t *testing.T) {
+	dir := createRevisionRepo(t)
+
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{Rev: "v1", ExcludePatterns: []string{".git"}})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, fileInfo := range filesData {
+		if fileInfo.Error != nil {
+			t.Errorf("Unexpected error for %s: %v", fileInfo.RelativePath, fileInfo.Error)
+		}
+		if fileInfo.AbsolutePath != "" {
+			t.Errorf("Expected no absolute path for %s in a revision, got %s", fileInfo.RelativePath, fileInfo.AbsolutePath)
+		}
+		files[fileInfo.RelativePath] = fileInfo.Content
+	}
+
+	expected := map[string]string{
+		".gitignore":         "*.log\n",
+		"README.md":          "# Project v1\n",
+		"image.bin":          "[Binary File]",
+		"pkg/.gingestignore": "*.tmp\n",
+		"pkg/lib/lib.go":     "package lib\n",
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Errorf("Expected %s to be %q, got %q", name, content, files[name])
+		}
+	}
+	if !strings.Contains(files["notebook.ipynb"], "print(1)") {
+		t.Errorf("Expected the notebook to be parsed, got %q", files["notebook.ipynb"])
+	}
+	for _, name := range []string{"debug.log", "pkg/lib/scratch.tmp", "untracked.go", "pkg/lib/new.go", "link.md"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("Expected %s to be left out", name)
+		}
+	}
+	if len(files) != len(expected)+1 {
+		t.Errorf("Expected %d files, got %v", len(expected)+1, stats.AllPaths)
+	}
+
+	if stats.Ref != "v1" || len(stats.Commit) != 40 {
+		t.Errorf("Expected ref v1 at a full commit SHA, got %q at %q", stats.Ref, stats.Commit)
+	}
+	if strings.Join(stats.IgnoreFiles, ",") != ".git/info/exclude,.gitignore,pkg/.gingestignore" {
+		t.Errorf("Expected ignore files read from the revision, got %v", stats.IgnoreFiles)
+	}
+
+	// The working copy is untouched
+	content, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil || string(content) != "# Project work in progress\n" {
+		t.Errorf("Expected the working copy to keep its changes, got %q (%v)", content, err)
+	}
+}
+
+func TestProcessLocalDirectory_RevSubdirectories(t *testing.T) {
+	dir := createRevisionRepo(t)
+
+	testCases := []struct {
+		rootDir string
+		subdir  string
+		desc    string
+	}{
+		{filepath.Join(dir, "pkg"), "lib", "Source below the top of the repository"},
+		{dir, "pkg/lib", "Subdir option"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), tc.rootDir, Config{Rev: "v1", Subdir: tc.subdir})
+			if err != nil {
+				t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+			}
+			if len(filesData) != 1 || filesData[0].RelativePath != "lib.go" {
+				t.Errorf("Expected only lib.go, got %v", stats.AllPaths)
+			}
+		})
+	}
+}
+
+func TestProcessLocalDirectory_RevErrors(t *testing.T) {
+	dir := createRevisionRepo(t)
+
+	testCases := []struct {
+		rootDir  string
+		rev      string
+		expected string
+		desc     string
+	}{
+		{dir, "no-such-rev", `revision "no-such-rev" not found`, "Unknown revision"},
+		{t.TempDir(), "v1", "requires a Git repository", "Not a repository"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, _, err := ProcessLocalDirectoryContext(context.Background(), tc.rootDir, Config{Rev: tc.rev})
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestStreamLocalDirectory_Rev(t *testing.T) {
+	dir := createRevisionRepo(t)
+	config := Config{Rev: "v1", ExcludePatterns: []string{".git"}}
+
+	filesData, stats, err := ProcessLocalDirectoryContext(context.Background(), dir, config)
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+	}
+	var expected, streamed bytes.Buffer
+	if err := WriteDigestFormat(&expected, FormatJSONL, filesData, stats); err != nil {
+		t.Fatalf("WriteDigestFormat failed: %v", err)
+	}
+	if _, err := StreamLocalDirectory(&streamed, FormatJSONL, dir, config); err != nil {
+		t.Fatalf("StreamLocalDirectory failed: %v", err)
+	}
+	if streamed.String() != expected.String() {
+		t.Errorf("Expected the streamed revision to match the buffered digest, got:\n%s", streamed.String())
+	}
+}
+
+func TestGitTree(t *testing.T) {
+	dir := createRevisionRepo(t)
+	src, err := openSource(context.Background(), dir, Config{Rev: "v1"})
+	if err != nil {
+		t.Fatalf("openSource failed: %v", err)
+	}
+	defer src.close()
+
+	expected := fstest.MapFS{
+		".gitignore":          {Data: []byte("*.log\n")},
+		"README.md":           {Data: []byte("# Project v1\n")},
+		"debug.log":           {Data: []byte("committed despite .gitignore\n")},
+		"image.bin":           {Data: []byte("\x00\x01\x02")},
+		"notebook.ipynb":      {Data: []byte(`{"cells": [{"cell_type": "code", "source": ["print(1)"]}]}`)},
+		"pkg/.gingestignore":  {Data: []byte("*.tmp\n")},
+		"pkg/lib/lib.go":      {Data: []byte("package lib\n")},
+		"pkg/lib/scratch.tmp": {Data: []byte("tmp\n")},
+	}
+	var names []string
+	for name := range expected {
+		names = append(names, name)
+	}
+	if err := fstest.TestFS(src.fsys, names...); err != nil {
+		t.Errorf("gitTree is not a valid fs.FS: %v", err)
+	}
+	for name, file := range expected {
+		content, err := fs.ReadFile(src.fsys, name)
+		if err != nil || !bytes.Equal(content, file.Data) {
+			t.Errorf("Expected %s to be %q, got %q (%v)", name, file.Data, content, err)
+		}
+	}
+}
+
+func TestProcessLocalDirectory_TrackedOnly(t *testing.T) {
+	dir := createRevisionRepo(t)
+	testGit(t, dir, nil, "add", "pkg/lib/new.go")
+	createWalkTestFiles(t, dir, map[string]string{
+		"secrets.txt":    "password\n",
+		"pkg/scratch.go": "package scratch\n",
+		"trace.log":      "ignored, so never counted\n",
+	})
+
+	testCases := []struct {
+		rootDir   string
+		config    Config
+		expected  []string
+		untracked int
+		desc      string
+	}{
+		{
+			dir, Config{ExcludePatterns: []string{".git", "link.md"}},
+			[]string{".gitignore", "README.md", "image.bin", "notebook.ipynb", "pkg/.gingestignore", "pkg/lib/lib.go", "pkg/lib/new.go"},
+			3, "Committed and staged files",
+		},
+		{
+			dir, Config{IncludePatterns: []string{"**/*.go"}},
+			[]string{"pkg/lib/lib.go", "pkg/lib/new.go"},
+			2, "Combined with include patterns",
+		},
+		{
+			dir, Config{ExcludePatterns: []string{".git", "link.md", "untracked.go", "secrets.txt"}},
+			[]string{".gitignore", "README.md", "image.bin", "notebook.ipynb", "pkg/.gingestignore", "pkg/lib/lib.go", "pkg/lib/new.go"},
+			1, "Excluded files aren't counted",
+		},
+		{
+			filepath.Join(dir, "pkg"), Config{},
+			[]string{".gingestignore", "lib/lib.go", "lib/new.go"},
+			1, "Source below the top of the repository",
+		},
+		{
+			dir, Config{Subdir: "pkg"},
+			[]string{".gingestignore", "lib/lib.go", "lib/new.go"},
+			1, "Subdir option",
+		},
+		{
+			dir, Config{Rev: "v1", ExcludePatterns: []string{".git"}},
+			[]string{".gitignore", "README.md", "image.bin", "notebook.ipynb", "pkg/.gingestignore", "pkg/lib/lib.go"},
+			0, "Revision",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.config.TrackedOnly = true
+			_, stats, err := ProcessLocalDirectoryContext(context.Background(), tc.rootDir, tc.config)
+			if err != nil {
+				t.Fatalf("ProcessLocalDirectoryContext failed: %v", err)
+			}
+			if strings.Join(stats.AllPaths, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, stats.AllPaths)
+			}
+			if !stats.TrackedOnly || stats.NumUntrackedFiles != tc.untracked {
+				t.Errorf("Expected %d untracked files, got %d", tc.untracked, stats.NumUntrackedFiles)
+			}
+		})
+	}
+}
+
+func TestProcessLocalDirectory_TrackedOnlyNotRepository(t *testing.T) {
+	isolateGit(t)
+	dir := t.TempDir()
+	createWalkTestFiles(t, dir, map[string]string{"main.go": "package main\n"})
+
+	_, _, err := ProcessLocalDirectoryContext(context.Background(), dir, Config{TrackedOnly: true})
+	if err == nil || !strings.Contains(err.Error(), "require a Git repository") {
+		t.Errorf("Expected error for a directory outside Git, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package ingester
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// StreamLocalDirectory walks rootDir and writes the digest to w as files are
+// read, without holding every file's content in memory
+func StreamLocalDirectory(w io.Writer, format Format, rootDir string, config Config) (types.Stats, error) {
+	return StreamLocalDirectoryContext(context.Background(), w, format, rootDir, config)
+}
+
+// StreamLocalDirectoryContext is StreamLocalDirectory with cancellation.
+// Files are written in digest order while at most config.Workers files are
+// read ahead, so memory use is bounded by the largest files rather than the
+// whole tree. Only Markdown and JSONL can be streamed; the Markdown digest
+// carries its statistics in a trailer after the last file.
+func StreamLocalDirectoryContext(ctx context.Context, w io.Writer, format Format, rootDir string, config Config) (types.Stats, error) {
+	if err := checkStreamFormat(format); err != nil {
+		return types.Stats{}, err
+	}
+
+	src, err := openSource(ctx, rootDir, config)
+	if err != nil {
+		return types.Stats{}, err
+	}
+	defer src.close()
+
+	progressReporter := newReporter(config.Progress)
+	stats, err := walkDirectory(ctx, src, config, progressReporter)
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	return streamDigest(ctx, w, format, src, stats, config, progressReporter)
+}
+
+// StreamRemoteRepoContext clones a Git repository and streams its digest to
+// w like StreamLocalDirectoryContext. The temporary clone is removed afterwards.
+func StreamRemoteRepoContext(ctx context.Context, w io.Writer, format Format, gitURL string, targetBranch string, config Config) (types.Stats, error) {
+	if err := checkStreamFormat(format); err != nil {
+		return types.Stats{}, err
+	}
+
+	tempDir, commit, err := cloneRepo(ctx, gitURL, targetBranch, config)
+	if err != nil {
+		return types.Stats{}, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	src, err := openSource(ctx, tempDir, config)
+	if err != nil {
+		return types.Stats{}, fmt.Errorf("failed to process cloned directory: %w", err)
+	}
+	defer src.close()
+
+	progressReporter := newReporter(config.Progress)
+	stats, err := walkDirectory(ctx, src, config, progressReporter)
+	if err != nil {
+		return types.Stats{}, fmt.Errorf("failed to process cloned directory: %w", err)
+	}
+
+	setRemoteStats(&stats, gitURL, targetBranch, commit, config)
+
+	return streamDigest(ctx, w, format, src, stats, config, progressReporter)
+}
+
+// CanStream reports whether digests in format can be streamed
+func CanStream(format Format) bool {
+	return checkStreamFormat(format) == nil
+}
+
+// checkStreamFormat rejects formats that need every file before writing
+func checkStreamFormat(format Format) error {
+	switch format {
+	case FormatMarkdown, FormatJSONL, "":
+		return nil
+	}
+	return fmt.Errorf("format %q can't be streamed (expected markdown or jsonl)", format)
+}
+
+// streamDigest reads the walked files of src in digest order and writes
+// each one as soon as it is read, accumulating stats on the way
+func streamDigest(ctx context.Context, w io.Writer, format Format, src *source, stats types.Stats, config Config, progressReporter *reporter) (types.Stats, error) {
+	history, err := addHistory(ctx, src, &stats, config)
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	files, absRoot, err := src.files(stats.Subdir)
+	if err != nil {
+		return types.Stats{}, err
+	}
+	ranks, err := addOrder(files, &stats, history, config)
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	buffered := bufio.NewWriter(contextWriter{ctx: ctx, w: w})
+	var writeFile func(fileInfo types.FileInfo) error
+
+	if format == FormatJSONL {
+		encoder := json.NewEncoder(buffered)
+		writeFile = func(fileInfo types.FileInfo) error {
+			if err := encoder.Encode(newJSONFile(fileInfo)); err != nil {
+				return fmt.Errorf("failed to write JSONL record for %s: %w", fileInfo.RelativePath, err)
+			}
+			return nil
+		}
+	} else {
+		if _, err := buffered.WriteString(streamHeader(stats)); err != nil {
+			return types.Stats{}, fmt.Errorf("failed to write summary: %w", err)
+		}
+		if _, err := buffered.WriteString(utils.GenerateHistoryString(stats.History) + treeSection(nil, stats)); err != nil {
+			return types.Stats{}, fmt.Errorf("failed to write tree: %w", err)
+		}
+		writeFile = func(fileInfo types.FileInfo) error {
+			return writeFileBlock(buffered, fileInfo)
+		}
+	}
+
+	err = readOrdered(ctx, files, absRoot, orderPaths(stats.AllPaths, ranks), config, progressReporter, func(fileInfo types.FileInfo) error {
+		if config.History > 0 {
+			fileInfo.LastCommit = history.lastCommit(fileInfo.RelativePath)
+		}
+		fileInfo.Rank = ranks[fileInfo.RelativePath]
+		addFileStats(&stats, fileInfo)
+		if fileInfo.Error != nil {
+			return nil
+		}
+		return writeFile(fileInfo)
+	})
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	if format != FormatJSONL {
+		if _, err := buffered.WriteString("---\n\n" + utils.GenerateStatisticsString(stats)); err != nil {
+			return types.Stats{}, fmt.Errorf("failed to write statistics: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return types.Stats{}, fmt.Errorf("failed to flush digest: %w", err)
+	}
+
+	return stats, nil
+}
+
+// streamHeader is the summary written before a streamed Markdown digest.
+// The statistics aren't known yet, so they follow the last file instead.
+func streamHeader(stats types.Stats) string {
+	return "# Codebase Digest Summary\n\n" + utils.GenerateSourceString(stats) +
+		"_Statistics are listed at the end of this digest._\n\n---\n\n"
+}
+
+// readOrdered reads the files at paths in fsys with a bounded pool of workers and
+// calls fn with each one in the order of paths. At most config.Workers files
+// are read ahead of the one fn is waiting for. It stops at the first error
+// from fn or once ctx is cancelled.
+func readOrdered(ctx context.Context, fsys fs.FS, absRoot string, paths []string, config Config, progressReporter *reporter, fn func(fileInfo types.FileInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	progressReporter.start(len(paths))
+
+	// Each pending read delivers its result on its own channel, so results
+	// come out in order however the reads finish
+	pending := make(chan chan types.FileInfo, config.workers(len(paths)))
+
+	go func() {
+		defer close(pending)
+		for _, relPath := range paths {
+			result := make(chan types.FileInfo, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(relPath string) {
+				fileInfo := readFile(fsys, absRoot, relPath, config)
+				progressReporter.read(fileInfo)
+				result <- fileInfo
+			}(relPath)
+		}
+	}()
+
+	for result := range pending {
+		var fileInfo types.FileInfo
+		select {
+		case fileInfo = <-result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := fn(fileInfo); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,131 @@
+package ingester
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prashanth1k/gingest/internal/types"
+)
+
+// fileBlocks returns the part of a Markdown digest from the first file header on
+func fileBlocks(digest string) string {
+	if index := strings.Index(digest, FILE_SEPARATOR_START); index >= 0 {
+		return digest[index:]
+	}
+	return ""
+}
+
+func TestStreamLocalDirectory_MatchesDigest(t *testing.T) {
+	testDir := t.TempDir()
+	files := map[string]string{"README.md": "# Project\n"}
+	for i := 0; i < 30; i++ {
+		files[fmt.Sprintf("pkg%d/file%02d.go", i%4, i)] = fmt.Sprintf("package pkg\n\nconst N = %d\n", i)
+	}
+	createWalkTestFiles(t, testDir, files)
+
+	filesData, expectedStats, err := ProcessLocalDirectoryWithConfig(testDir, Config{})
+	if err != nil {
+		t.Fatalf("ProcessLocalDirectoryWithConfig failed: %v", err)
+	}
+
+	for _, format := range []Format{FormatMarkdown, FormatJSONL} {
+		var expected bytes.Buffer
+		if err := WriteDigestFormat(&expected, format, filesData, expectedStats); err != nil {
+			t.Fatalf("WriteDigestFormat failed: %v", err)
+		}
+
+		for _, workers := range []int{1, 4, 100} {
+			var streamed bytes.Buffer
+			stats, err := StreamLocalDirectory(&streamed, format, testDir, Config{Workers: workers})
+			if err != nil {
+				t.Fatalf("StreamLocalDirectory failed: %v", err)
+			}
+
+			if stats.NumFilesProcessed != expectedStats.NumFilesProcessed ||
+				stats.TotalContentBytes != expectedStats.TotalContentBytes ||
+				stats.TotalTokens != expectedStats.TotalTokens {
+				t.Errorf("Expected stats %+v, got %+v", expectedStats, stats)
+			}
+
+			if format == FormatJSONL {
+				if streamed.String() != expected.String() {
+					t.Errorf("Streamed JSONL with %d workers differs from the buffered digest", workers)
+				}
+				continue
+			}
+
+			// File blocks match; the statistics move to a trailer
+			blocks := fileBlocks(streamed.String())
+			trailer := strings.Index(blocks, "---\n\n## Statistics")
+			if trailer < 0 {
+				t.Fatalf("Expected statistics trailer, got %q", blocks)
+			}
+			if blocks[:trailer] != fileBlocks(expected.String()) {
+				t.Errorf("Streamed Markdown with %d workers differs from the buffered digest", workers)
+			}
+			if !strings.Contains(blocks[trailer:], "- **Total Files:** 31") {
+				t.Errorf("Expected trailer to count 31 files, got %q", blocks[trailer:])
+			}
+		}
+	}
+}
+
+func TestStreamLocalDirectory_UnsupportedFormat(t *testing.T) {
+	var streamed bytes.Buffer
+	for _, format := range []Format{FormatJSON, FormatXML} {
+		if _, err := StreamLocalDirectory(&streamed, format, t.TempDir(), Config{}); err == nil {
+			t.Errorf("Expected error streaming %s", format)
+		}
+	}
+}
+
+func TestReadOrdered_StopsOnError(t *testing.T) {
+	testDir := t.TempDir()
+	var paths []string
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("file%02d.txt", i)
+		files[path] = path
+		paths = append(paths, path)
+	}
+	createWalkTestFiles(t, testDir, files)
+
+	errStop := errors.New("stop")
+	var seen []string
+	err := readOrdered(context.Background(), os.DirFS(testDir), testDir, paths, Config{Workers: 3}, newReporter(nil), func(fileInfo types.FileInfo) error {
+		seen = append(seen, fileInfo.RelativePath)
+		if len(seen) == 5 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+	if len(seen) != 5 {
+		t.Fatalf("Expected 5 files before stopping, got %v", seen)
+	}
+	for i, path := range seen {
+		if path != paths[i] {
+			t.Errorf("Expected %s at position %d, got %s", paths[i], i, path)
+		}
+	}
+}
+
+func TestStreamLocalDirectory_Cancelled(t *testing.T) {
+	testDir := t.TempDir()
+	createWalkTestFiles(t, testDir, map[string]string{"main.go": "package main\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var streamed bytes.Buffer
+	if _, err := StreamLocalDirectoryContext(ctx, &streamed, FormatMarkdown, testDir, Config{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package ingester
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prashanth1k/gingest/internal/types"
+	"github.com/prashanth1k/gingest/internal/utils"
+)
+
+// WriteXMLDigest writes the digest to w using XML-style tags, with each file
+// wrapped in a <document> element as recommended for long-context prompts
+func WriteXMLDigest(w io.Writer, filesData []types.FileInfo, stats types.Stats) error {
+	// bufio.Writer errors are sticky, so individual writes are checked by the final Flush
+	buffered := bufio.NewWriter(w)
+
+	if err := writeXMLHeader(buffered, filesData, stats); err != nil {
+		return err
+	}
+	for i, fileInfo := range orderFiles(filesData) {
+		if err := writeXMLDocument(buffered, i+1, fileInfo); err != nil {
+			return err
+		}
+	}
+	buffered.WriteString(xmlFooter)
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write XML digest: %w", err)
+	}
+
+	return nil
+}
+
+// xmlFooter closes the documents and the digest opened by writeXMLHeader
+const xmlFooter = "</documents>\n</digest>\n"
+
+// writeXMLHeader writes the opening tags, summary, history and directory
+// tree of an XML digest, up to the start of the documents
+func writeXMLHeader(buffered *bufio.Writer, filesData []types.FileInfo, stats types.Stats) error {
+	buffered.WriteString("<digest>\n")
+
+	buffered.WriteString("<summary>\n")
+	if err := xml.EscapeText(buffered, []byte(utils.GenerateSummaryString(stats))); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	buffered.WriteString("</summary>\n")
+
+	if history := utils.GenerateHistoryString(stats.History); history != "" {
+		buffered.WriteString("<history>\n")
+		if err := xml.EscapeText(buffered, []byte(history)); err != nil {
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+		buffered.WriteString("</history>\n")
+	}
+
+	if tree := treeString(filesData, stats); tree != "" {
+		buffered.WriteString("<directory_structure>\n")
+		if err := xml.EscapeText(buffered, []byte(tree)); err != nil {
+			return fmt.Errorf("failed to write tree: %w", err)
+		}
+		buffered.WriteString("</directory_structure>\n")
+	}
+
+	buffered.WriteString("<documents>\n")
+	return nil
+}
+
+// writeXMLDocument writes a single file as the document with the given index
+func writeXMLDocument(buffered *bufio.Writer, index int, fileInfo types.FileInfo) error {
+	fmt.Fprintf(buffered, "<document index=\"%d\">\n", index)
+
+	buffered.WriteString("<source>")
+	if err := xml.EscapeText(buffered, []byte(fileInfo.RelativePath)); err != nil {
+		return fmt.Errorf("failed to write source for %s: %w", fileInfo.RelativePath, err)
+	}
+	buffered.WriteString("</source>\n")
+
+	if fileInfo.LastCommit != nil {
+		buffered.WriteString("<last_modified>")
+		if err := xml.EscapeText(buffered, []byte(utils.FormatLastCommit(fileInfo.LastCommit))); err != nil {
+			return fmt.Errorf("failed to write last commit for %s: %w", fileInfo.RelativePath, err)
+		}
+		buffered.WriteString("</last_modified>\n")
+	}
+
+	if change := fileInfo.Change; change != nil {
+		fmt.Fprintf(buffered, "<change status=\"%s\" additions=\"%d\" deletions=\"%d\"", change.Status, change.Additions, change.Deletions)
+		if change.OldPath != "" {
+			buffered.WriteString(" old_path=\"")
+			if err := xml.EscapeText(buffered, []byte(change.OldPath)); err != nil {
+				return fmt.Errorf("failed to write change for %s: %w", fileInfo.RelativePath, err)
+			}
+			buffered.WriteString("\"")
+		}
+		if change.Binary {
+			buffered.WriteString(" binary=\"true\"")
+		}
+		buffered.WriteString(">")
+		buffered.WriteString(cdata(change.Patch))
+		buffered.WriteString("</change>\n")
+	} else if fileInfo.Related {
+		buffered.WriteString("<related>true</related>\n")
+	}
+
+	buffered.WriteString("<document_content>")
+	buffered.WriteString(cdata(fileInfo.Content))
+	buffered.WriteString("</document_content>\n")
+
+	buffered.WriteString("</document>\n")
+	return nil
+}
+
+// cdata wraps content in a CDATA section. Occurrences of "]]>" are split
+// across two sections and characters that are not allowed in XML are
+// replaced with U+FFFD, so the result is always well-formed.
+func cdata(content string) string {
+	if content == "" {
+		return ""
+	}
+
+	escaped := strings.ReplaceAll(sanitizeXMLChars(content), "]]>", "]]]]><![CDATA[>")
+	return "<![CDATA[" + escaped + "]]>"
+}
+
+// sanitizeXMLChars replaces runes that are invalid in XML 1.0 documents
+func sanitizeXMLChars(content string) string {
+	return strings.Map(func(r rune) rune {
+		if !isXMLChar(r) {
+			return utf8.RuneError
+		}
+		return r
+	}, content)
+}
+
+// isXMLChar reports whether r is in the XML 1.0 Char production
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/prashanth1k/gingest/internal/utils"
 )
 
 // Cell represents a Jupyter notebook cell
@@ -18,6 +20,11 @@ type Notebook struct {
 	Cells []Cell `json:"cells"`
 }
 
+// Options controls how notebook content is extracted
+type Options struct {
+	LineNumbers bool // Number the lines of each cell from 1, leaving the cell headings unnumbered
+}
+
 // ParseNotebook reads and parses a Jupyter notebook file, extracting text content
 func ParseNotebook(filePath string) (string, error) {
 	// Read the notebook file
@@ -26,9 +33,20 @@ func ParseNotebook(filePath string) (string, error) {
 		return "", fmt.Errorf("failed to read notebook file: %w", err)
 	}
 
+	return ParseNotebookData(data)
+}
+
+// ParseNotebookData parses the content of a Jupyter notebook, extracting text content
+func ParseNotebookData(data []byte) (string, error) {
+	return ParseNotebookDataWithOptions(data, Options{})
+}
+
+// ParseNotebookDataWithOptions parses the content of a Jupyter notebook with
+// the given options, extracting text content
+func ParseNotebookDataWithOptions(data []byte, options Options) (string, error) {
 	// Parse JSON
 	var notebook Notebook
-	err = json.Unmarshal(data, &notebook)
+	err := json.Unmarshal(data, &notebook)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse notebook JSON: %w", err)
 	}
@@ -45,6 +63,10 @@ func ParseNotebook(filePath string) (string, error) {
 			// Join source lines
 			if len(cell.Source) > 0 {
 				cellContent := strings.Join(cell.Source, "")
+				if options.LineNumbers {
+					// Lines are numbered per cell, as notebook tools show them
+					cellContent = utils.NumberLines(cellContent)
+				}
 				content.WriteString(cellContent)
 
 				// Ensure proper spacing between cells
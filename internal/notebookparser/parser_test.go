@@ -94,6 +94,27 @@ func TestParseNotebook(t *testing.T) {
 	}
 }
 
+func TestParseNotebookDataWithOptions_LineNumbers(t *testing.T) {
+	notebookJSON := `{
+ "cells": [
+  {"cell_type": "markdown", "source": ["# Title\n", "\n", "Intro"]},
+  {"cell_type": "code", "source": ["import os\n", "print(os.getcwd())\n"]}
+ ]
+}`
+
+	content, err := ParseNotebookDataWithOptions([]byte(notebookJSON), Options{LineNumbers: true})
+	if err != nil {
+		t.Fatalf("Failed to parse notebook: %v", err)
+	}
+
+	expected := "# Jupyter Notebook Content\n\n" +
+		"## Cell 1 (markdown)\n\n1 | # Title\n2 |\n3 | Intro\n\n" +
+		"## Cell 2 (code)\n\n1 | import os\n2 | print(os.getcwd())\n\n"
+	if content != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
 func TestParseNotebook_InvalidJSON(t *testing.T) {
 	// Create a temporary file with invalid JSON
 	tempDir := t.TempDir()
@@ -0,0 +1,108 @@
+// Package progress defines the progress events reported while a digest is
+// built and renders them for the CLI.
+package progress
+
+import (
+	"io"
+	"sync"
+)
+
+// Kind identifies what a progress event reports
+type Kind string
+
+// Progress event kinds
+const (
+	KindCloneProgress  Kind = "clone_progress"  // A progress line from git clone
+	KindFileDiscovered Kind = "file_discovered" // The walk found a file to include
+	KindFileRead       Kind = "file_read"       // A file's content was read
+	KindFileSkipped    Kind = "file_skipped"    // A file was binary, too large or unreadable
+	KindBytesWritten   Kind = "bytes_written"   // Digest output was written
+)
+
+// Event is a single progress update. Counts are running totals for the run
+// rather than increments; file events carry the file counts and write events
+// carry the bytes written.
+type Event struct {
+	Kind       Kind
+	Path       string // File the event is about, for file events
+	Message    string // Progress line from git, for clone events
+	SkipReason string // Why the file's content was skipped, for skip events
+	Err        error  // Read error, for skip events of unreadable files
+	Size       int64  // Size of the file, for read and skip events
+	Discovered int    // Files found by the walk so far
+	Processed  int    // Files read or skipped so far
+	Total      int    // Files to read, once the walk is done (0 while walking)
+	Written    int64  // Bytes of output written so far
+}
+
+// Func receives progress events. Calls are never made concurrently, but they
+// come from the goroutines doing the work, so a Func should return quickly.
+type Func func(event Event)
+
+// Serialize returns a Func that passes events to fn one at a time, so the
+// reporters and counters of one run can share it without overlapping calls.
+// It returns nil for a nil fn.
+func Serialize(fn Func) Func {
+	if fn == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(event)
+	}
+}
+
+// Counter counts bytes written through its writers and reports the running
+// total as KindBytesWritten events. One Counter can span several outputs,
+// such as the files of a chunked digest.
+type Counter struct {
+	mu      sync.Mutex
+	fn      Func
+	written int64
+}
+
+// NewCounter returns a Counter that reports to fn, which may be nil
+func NewCounter(fn Func) *Counter {
+	return &Counter{fn: fn}
+}
+
+// Writer returns a writer that passes writes to w and counts them. Without a
+// Func it returns w itself.
+func (c *Counter) Writer(w io.Writer) io.Writer {
+	if c == nil || c.fn == nil {
+		return w
+	}
+	return counterWriter{counter: c, w: w}
+}
+
+// Written returns the number of bytes written so far
+func (c *Counter) Written() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written
+}
+
+// add records n written bytes and reports the new total
+func (c *Counter) add(n int) {
+	if n == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written += int64(n)
+	c.fn(Event{Kind: KindBytesWritten, Written: c.written})
+}
+
+// counterWriter is the writer returned by Counter.Writer
+type counterWriter struct {
+	counter *Counter
+	w       io.Writer
+}
+
+func (cw counterWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.counter.add(n)
+	return n, err
+}
@@ -0,0 +1,62 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	var events []Event
+	counter := NewCounter(func(event Event) { events = append(events, event) })
+
+	// One counter spans several outputs
+	var first, second bytes.Buffer
+	counter.Writer(&first).Write([]byte("hello "))
+	counter.Writer(&second).Write([]byte("world"))
+	counter.Writer(&second).Write(nil)
+
+	if first.String() != "hello " || second.String() != "world" {
+		t.Errorf("Expected writes to pass through, got %q and %q", first.String(), second.String())
+	}
+	if counter.Written() != 11 {
+		t.Errorf("Expected 11 bytes written, got %d", counter.Written())
+	}
+	if len(events) != 2 || events[1].Kind != KindBytesWritten || events[1].Written != 11 {
+		t.Errorf("Expected two write events ending at 11 bytes, got %+v", events)
+	}
+}
+
+func TestCounter_NoFunc(t *testing.T) {
+	var out bytes.Buffer
+	if w := NewCounter(nil).Writer(&out); w != &out {
+		t.Error("Expected the writer itself without a Func")
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	if Serialize(nil) != nil {
+		t.Error("Expected nil for a nil Func")
+	}
+
+	// The counter and a second reporter share the serialized Func; the
+	// unsynchronized count is caught by -race if calls overlap
+	var events int
+	fn := Serialize(func(event Event) { events++ })
+	counter := NewCounter(fn)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			fn(Event{Kind: KindFileRead})
+		}
+		close(done)
+	}()
+	var out bytes.Buffer
+	for i := 0; i < 100; i++ {
+		counter.Writer(&out).Write([]byte("x"))
+	}
+	<-done
+
+	if events != 200 {
+		t.Errorf("Expected 200 events, got %d", events)
+	}
+}
@@ -0,0 +1,151 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	barWidth    = 30
+	ttyInterval = 100 * time.Millisecond // Redraw rate of the progress bar
+	logInterval = 5 * time.Second        // Rate of progress lines when not on a terminal
+)
+
+// Renderer draws progress events for the CLI: a progress bar redrawn in
+// place on a terminal, or a log line every few seconds otherwise, so CI logs
+// stay readable
+type Renderer struct {
+	mu       sync.Mutex
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time // When a line was last drawn
+	drawn    int       // Length of the line on screen, for redrawing on a terminal
+	pending  bool      // Whether there are events since the last line
+	phase    Kind
+	message  string
+	event    Event // Latest file counts
+	written  int64
+}
+
+// NewRenderer returns a Renderer writing to out. With tty set, it draws a
+// progress bar; otherwise it writes periodic log lines.
+func NewRenderer(out io.Writer, tty bool) *Renderer {
+	r := &Renderer{out: out, tty: tty, interval: ttyInterval, now: time.Now}
+	if !tty {
+		// The first log line waits a full interval, so quick runs only get the final line
+		r.interval = logInterval
+		r.last = r.now()
+	}
+	return r
+}
+
+// IsTerminal reports whether w is a terminal
+func IsTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Handle records an event and redraws if the interval has passed. It can be
+// passed wherever a Func is expected.
+func (r *Renderer) Handle(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch event.Kind {
+	case KindCloneProgress:
+		r.message = event.Message
+	case KindBytesWritten:
+		r.written = event.Written
+	default:
+		r.event = event
+	}
+	r.phase = event.Kind
+	r.pending = true
+
+	if now := r.now(); now.Sub(r.last) >= r.interval {
+		r.draw()
+		r.last = now
+	}
+}
+
+// Finish draws the latest state if it hasn't been shown and ends the
+// progress bar's line, so later output starts on a fresh line. Finish on a
+// nil Renderer does nothing.
+func (r *Renderer) Finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending {
+		r.draw()
+	}
+	if r.tty && r.drawn > 0 {
+		fmt.Fprintln(r.out)
+		r.drawn = 0
+	}
+}
+
+// draw writes the current state
+func (r *Renderer) draw() {
+	line := r.line()
+	r.pending = false
+	if !r.tty {
+		fmt.Fprintln(r.out, "Progress: "+line)
+		return
+	}
+
+	// Pad with spaces to erase the rest of a longer previous line
+	padding := ""
+	if r.drawn > len(line) {
+		padding = strings.Repeat(" ", r.drawn-len(line))
+	}
+	fmt.Fprint(r.out, "\r"+line+padding)
+	r.drawn = len(line)
+}
+
+// line describes the current state in a single line
+func (r *Renderer) line() string {
+	switch {
+	case r.phase == KindCloneProgress:
+		return "cloning: " + r.message
+	case r.event.Total == 0 && r.event.Discovered > 0:
+		return fmt.Sprintf("scanning: %d files found", r.event.Discovered)
+	case r.event.Total == 0:
+		return "writing: " + FormatBytes(r.written)
+	}
+
+	line := fmt.Sprintf("%d/%d files", r.event.Processed, r.event.Total)
+	if r.tty {
+		filled := barWidth * r.event.Processed / r.event.Total
+		line = "[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "] " + line
+	} else {
+		line = "read " + line
+	}
+	if r.written > 0 {
+		line += ", " + FormatBytes(r.written) + " written"
+	}
+	return line
+}
+
+// FormatBytes formats a byte count for display, such as "512 B" or "1.5 MB"
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,107 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRenderer returns a renderer whose clock advances only when told to
+func newTestRenderer(tty bool) (*Renderer, *bytes.Buffer, *time.Time) {
+	var out bytes.Buffer
+	clock := time.Unix(0, 0)
+	r := NewRenderer(&out, tty)
+	r.now = func() time.Time { return clock }
+	r.last = clock
+	return r, &out, &clock
+}
+
+func TestRenderer_Terminal(t *testing.T) {
+	r, out, clock := newTestRenderer(true)
+
+	*clock = clock.Add(time.Second)
+	r.Handle(Event{Kind: KindFileRead, Processed: 5, Total: 10})
+	if expected := "\r[" + strings.Repeat("=", 15) + strings.Repeat(" ", 15) + "] 5/10 files"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// Events within the redraw interval are only drawn by Finish
+	out.Reset()
+	r.Handle(Event{Kind: KindFileRead, Processed: 10, Total: 10})
+	r.Handle(Event{Kind: KindBytesWritten, Written: 2048})
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw within the interval, got %q", out.String())
+	}
+	r.Finish()
+	if !strings.HasSuffix(out.String(), "10/10 files, 2.0 KB written\n") {
+		t.Errorf("Expected final state and a newline, got %q", out.String())
+	}
+}
+
+func TestRenderer_Log(t *testing.T) {
+	r, out, clock := newTestRenderer(false)
+
+	r.Handle(Event{Kind: KindCloneProgress, Message: "Receiving objects:  50% (5/10)"})
+	r.Handle(Event{Kind: KindFileDiscovered, Discovered: 3})
+	if out.Len() != 0 {
+		t.Errorf("Expected no line before the interval, got %q", out.String())
+	}
+
+	*clock = clock.Add(logInterval)
+	r.Handle(Event{Kind: KindFileRead, Discovered: 3, Processed: 1, Total: 3})
+	if expected := "Progress: read 1/3 files\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// Finish only repeats the state when something changed
+	r.Finish()
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected no extra line from Finish, got %q", out.String())
+	}
+}
+
+func TestRenderer_Lines(t *testing.T) {
+	testCases := []struct {
+		events   []Event
+		expected string
+	}{
+		{[]Event{{Kind: KindCloneProgress, Message: "Resolving deltas: 100% (3/3), done."}}, "cloning: Resolving deltas: 100% (3/3), done."},
+		{[]Event{{Kind: KindFileDiscovered, Discovered: 42}}, "scanning: 42 files found"},
+		{[]Event{{Kind: KindFileSkipped, Processed: 2, Total: 4}}, "read 2/4 files"},
+		{[]Event{{Kind: KindBytesWritten, Written: 3 * 1024 * 1024}}, "writing: 3.0 MB"},
+	}
+
+	for _, tc := range testCases {
+		r, _, _ := newTestRenderer(false)
+		for _, event := range tc.events {
+			r.Handle(event)
+		}
+		if line := r.line(); line != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, line)
+		}
+	}
+}
+
+func TestRenderer_NilFinish(t *testing.T) {
+	var r *Renderer
+	r.Finish() // Must not panic
+}
+
+func TestFormatBytes(t *testing.T) {
+	testCases := []struct {
+		bytes    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+	}
+
+	for _, tc := range testCases {
+		if result := FormatBytes(tc.bytes); result != tc.expected {
+			t.Errorf("FormatBytes(%d): expected %q, got %q", tc.bytes, tc.expected, result)
+		}
+	}
+}
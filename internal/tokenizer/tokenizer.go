@@ -0,0 +1,179 @@
+// Package tokenizer estimates how many LLM tokens a piece of text will use.
+//
+// Exact counts depend on the model's BPE vocabulary, which is large and model
+// specific. The estimators here run offline without a vocabulary and are
+// intended for budgeting context windows, not for billing.
+package tokenizer
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Estimator estimates the number of tokens in a piece of text
+type Estimator interface {
+	CountTokens(text string) int
+}
+
+// EstimatorFunc adapts an ordinary function to the Estimator interface
+type EstimatorFunc func(text string) int
+
+// CountTokens calls f(text)
+func (f EstimatorFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// Default is the estimator used when none is configured. It can be replaced
+// at runtime, for example with an exact tokenizer for a specific model.
+var Default Estimator = Heuristic{}
+
+// Count estimates the number of tokens in text using the Default estimator
+func Count(text string) int {
+	return Default.CountTokens(text)
+}
+
+// Or returns estimator, or Default if estimator is nil
+func Or(estimator Estimator) Estimator {
+	if estimator == nil {
+		return Default
+	}
+	return estimator
+}
+
+// CharsPerToken is a simple estimator that assumes a fixed number of
+// characters per token (about 4 for English text and code)
+type CharsPerToken float64
+
+// CountTokens implements Estimator
+func (c CharsPerToken) CountTokens(text string) int {
+	if text == "" || c <= 0 {
+		return 0
+	}
+	return int(float64(utf8.RuneCountInString(text))/float64(c) + 0.999)
+}
+
+// Heuristic approximates cl100k-style BPE tokenization. Text is split into
+// pre-tokens the way the cl100k pattern does (words with a leading space,
+// digit groups of up to three, punctuation runs, whitespace runs) and each
+// pre-token is charged by length according to how BPE typically merges it.
+type Heuristic struct{}
+
+// CountTokens implements Estimator
+func (Heuristic) CountTokens(text string) int {
+	tokens := 0
+	i := 0
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		switch {
+		case r == '\n' || r == '\r':
+			// Consecutive line breaks merge into a single token
+			i += size
+			for i < len(text) && (text[i] == '\n' || text[i] == '\r') {
+				i++
+			}
+			tokens++
+
+		case unicode.IsSpace(r):
+			// A single space attaches to the following word
+			j := i + size
+			for j < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsSpace(next) || next == '\n' || next == '\r' {
+					break
+				}
+				j += nextSize
+			}
+			if j-i == 1 && j < len(text) && text[i] == ' ' {
+				i = j
+				continue
+			}
+			// Runs of indentation are usually one or two tokens
+			tokens += 1 + (j-i)/16
+			i = j
+
+		case unicode.IsLetter(r):
+			j, ascii, runes := i, 0, 0
+			for j < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsLetter(next) && !unicode.IsMark(next) {
+					break
+				}
+				if next < utf8.RuneSelf {
+					ascii++
+				}
+				runes++
+				j += nextSize
+			}
+			tokens += wordTokens(ascii, runes-ascii, text[i:j])
+			i = j
+
+		case unicode.IsDigit(r):
+			j, digits := i, 0
+			for j < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsDigit(next) {
+					break
+				}
+				digits++
+				j += nextSize
+			}
+			// cl100k splits numbers into groups of at most three digits
+			tokens += (digits + 2) / 3
+			i = j
+
+		default:
+			// Punctuation and symbols: common pairs such as "()" or "=>" merge
+			j, runes := i, 0
+			for j < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[j:])
+				if unicode.IsLetter(next) || unicode.IsDigit(next) || unicode.IsSpace(next) {
+					break
+				}
+				runes++
+				j += nextSize
+			}
+			tokens += (runes + 1) / 2
+			i = j
+		}
+	}
+
+	return tokens
+}
+
+// wordTokens charges a run of letters. Short ASCII words are almost always a
+// single token; longer identifiers split roughly every five characters.
+// Non-ASCII letters split much more aggressively, and ideographs are close to
+// one token each.
+func wordTokens(ascii, nonASCII int, word string) int {
+	tokens := 0
+	if ascii > 0 {
+		tokens += (ascii + 4) / 5
+	}
+	if nonASCII > 0 {
+		ideographs := 0
+		for _, r := range word {
+			if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+				unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+				ideographs++
+			}
+		}
+		tokens += ideographs + (nonASCII-ideographs+1)/2
+	}
+	return tokens
+}
+
+// Format renders a token count for display, for example "950 tokens" or "12.3k tokens"
+func Format(tokens int) string {
+	switch {
+	case tokens == 1:
+		return "1 token"
+	case tokens < 1000:
+		return fmt.Sprintf("%d tokens", tokens)
+	case tokens < 1000000:
+		return fmt.Sprintf("%.1fk tokens", float64(tokens)/1000)
+	}
+	return fmt.Sprintf("%.1fM tokens", float64(tokens)/1000000)
+}
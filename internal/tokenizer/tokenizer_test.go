@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeuristicCountTokens(t *testing.T) {
+	testCases := []struct {
+		text     string
+		min, max int
+		desc     string
+	}{
+		{"", 0, 0, "Empty string"},
+		{"hello", 1, 1, "Single short word"},
+		{"hello world", 2, 2, "Words with leading space"},
+		{"1234567", 3, 3, "Digits grouped by three"},
+		{"func main() {\n\tfmt.Println(\"hi\")\n}\n", 10, 18, "Go snippet"},
+		{"The quick brown fox jumps over the lazy dog.", 9, 11, "English sentence"},
+		{"你好世界", 4, 4, "Ideographs are roughly one token each"},
+		{strings.Repeat(" ", 64) + "x", 2, 6, "Indentation run"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := Heuristic{}.CountTokens(tc.text)
+			if got < tc.min || got > tc.max {
+				t.Errorf("CountTokens(%q) = %d, expected between %d and %d", tc.text, got, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+func TestHeuristicTracksLength(t *testing.T) {
+	// Token estimates for code should stay in the usual 3-5 characters per token range
+	code := strings.Repeat("func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) error {\n\treturn nil\n}\n", 50)
+	tokens := Count(code)
+	ratio := float64(len(code)) / float64(tokens)
+	if ratio < 2.5 || ratio > 6 {
+		t.Errorf("Unexpected characters per token ratio %.2f (%d chars, %d tokens)", ratio, len(code), tokens)
+	}
+}
+
+func TestCharsPerToken(t *testing.T) {
+	estimator := CharsPerToken(4)
+	if got := estimator.CountTokens(""); got != 0 {
+		t.Errorf("Expected 0 tokens for empty text, got %d", got)
+	}
+	if got := estimator.CountTokens("abcdefgh"); got != 2 {
+		t.Errorf("Expected 2 tokens, got %d", got)
+	}
+	if got := estimator.CountTokens("abcdefghi"); got != 3 {
+		t.Errorf("Expected partial tokens to round up to 3, got %d", got)
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Default {
+		t.Error("Or(nil) should return Default")
+	}
+
+	custom := EstimatorFunc(func(text string) int { return 42 })
+	if Or(custom).CountTokens("x") != 42 {
+		t.Error("Or should return the provided estimator")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	testCases := map[int]string{
+		1:       "1 token",
+		950:     "950 tokens",
+		12345:   "12.3k tokens",
+		2500000: "2.5M tokens",
+	}
+
+	for tokens, expected := range testCases {
+		if got := Format(tokens); got != expected {
+			t.Errorf("Format(%d) = %q, expected %q", tokens, got, expected)
+		}
+	}
+}
@@ -1,22 +1,102 @@
 package types
 
+import "time"
+
+// Skip reasons recorded in FileInfo.SkipReason when content is not included
+const (
+	SkipReasonTooLarge = "exceeds max size"
+	SkipReasonBinary   = "binary file"
+)
+
 // FileInfo represents information about a processed file
 type FileInfo struct {
 	RelativePath string
 	AbsolutePath string
 	Content      string
+	Size         int64 // Size of the file on disk in bytes
 	IsBinary     bool
+	Language     string      // Code block language tag detected when the file was read, "" if unknown
+	SkipReason   string      // Why the content was not included, empty if it was
+	Tokens       int         // Estimated token count of Content
+	SavedBytes   int64       // Bytes removed from Content by stripping comments and whitespace
+	SavedTokens  int         // Estimated tokens removed from Content by stripping comments and whitespace
+	Truncated    bool        // Content was cut short to fit a token budget
+	Omitted      bool        // Content was left out to fit a token budget
+	Change       *FileChange // How the file changed, in diff digests
+	Related      bool        // Unchanged file included because it references a changed file, in diff digests
+	LastCommit   *Commit     // Last commit that changed the file, when history is included
+	Rank         int         // Position in the digest under a file order, from 1 (0 = README first, then by path)
 	Error        error
 }
 
+// Commit describes a commit from the Git history of a digested source
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	Files   []string  `json:"files,omitempty"` // Digested files the commit changed, in the history section
+}
+
+// Change statuses recorded in FileChange.Status
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	ChangeRenamed  = "renamed"
+)
+
+// FileChange describes how a file changed between the two revisions of a diff digest
+type FileChange struct {
+	Status    string `json:"status"`             // One of the Change* statuses
+	OldPath   string `json:"old_path,omitempty"` // Path before a rename
+	Additions int    `json:"additions"`          // Lines added
+	Deletions int    `json:"deletions"`          // Lines removed
+	Binary    bool   `json:"binary,omitempty"`   // Binary change, which has no line counts
+	Patch     string `json:"patch"`              // Unified diff of the file
+}
+
+// DiffStats summarizes the changes in a diff digest
+type DiffStats struct {
+	Base          string `json:"base"`                    // Revision the changes are made against
+	BaseCommit    string `json:"base_commit"`             // Commit SHA of Base
+	Head          string `json:"head"`                    // Revision holding the changes
+	HeadCommit    string `json:"head_commit"`             // Commit SHA of Head
+	FilesChanged  int    `json:"files_changed"`           // Files added, modified, deleted or renamed
+	FilesAdded    int    `json:"files_added"`             // Files added
+	FilesModified int    `json:"files_modified"`          // Files modified in place
+	FilesDeleted  int    `json:"files_deleted"`           // Files deleted
+	FilesRenamed  int    `json:"files_renamed"`           // Files renamed, with or without changes
+	BinaryChanges int    `json:"binary_changes"`          // Changed files that are binary
+	LinesAdded    int    `json:"lines_added"`             // Lines added across all files
+	LinesRemoved  int    `json:"lines_removed"`           // Lines removed across all files
+	RelatedFiles  int    `json:"related_files,omitempty"` // Unchanged files included because they reference a changed file
+}
+
 // Stats represents processing statistics
 type Stats struct {
-	NumFilesProcessed int
-	NumDirsProcessed  int
-	NumBinaryFiles    int
-	NumSkippedFiles   int
-	TotalContentBytes int64
-	Source            string
-	Branch            string
-	AllPaths          []string // All file paths for tree generation
+	NumFilesProcessed int        `json:"num_files_processed"`
+	NumDirsProcessed  int        `json:"num_dirs_processed"`
+	NumBinaryFiles    int        `json:"num_binary_files"`
+	NumSkippedFiles   int        `json:"num_skipped_files"`
+	TotalContentBytes int64      `json:"total_content_bytes"`
+	TotalTokens       int        `json:"total_tokens"`
+	TokenBudget       int        `json:"token_budget,omitempty"`
+	NumTruncatedFiles int        `json:"num_truncated_files,omitempty"`
+	NumOmittedFiles   int        `json:"num_omitted_files,omitempty"`
+	Stripped          []string   `json:"stripped,omitempty"`            // Content removed from files: "comments" and "whitespace"
+	SavedBytes        int64      `json:"saved_bytes,omitempty"`         // Bytes saved by stripping content
+	SavedTokens       int        `json:"saved_tokens,omitempty"`        // Estimated tokens saved by stripping content
+	TrackedOnly       bool       `json:"tracked_only,omitempty"`        // Only files tracked by Git were processed
+	NumUntrackedFiles int        `json:"num_untracked_files,omitempty"` // Files left out because Git doesn't track them
+	Source            string     `json:"source"`
+	Branch            string     `json:"branch,omitempty"`
+	Ref               string     `json:"ref,omitempty"`          // Ref requested for a remote repository, or revision read from a local one
+	Commit            string     `json:"commit,omitempty"`       // Commit SHA that was checked out or read
+	Subdir            string     `json:"subdir,omitempty"`       // Directory of the source that was processed, if not the whole source
+	Order             string     `json:"order,omitempty"`        // File order of the digest, if not README first and then by path
+	IgnoreFiles       []string   `json:"ignore_files,omitempty"` // Ignore and include files applied, relative to the source
+	History           []Commit   `json:"history,omitempty"`      // Recent commits that changed digested files, newest first
+	Diff              *DiffStats `json:"diff,omitempty"`         // Changes between two revisions, for diff digests
+	AllPaths          []string   `json:"-"`                      // All file paths for tree generation
 }
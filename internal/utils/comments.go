@@ -0,0 +1,616 @@
+package utils
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// CommentOptions chooses the comments StripComments leaves in place
+type CommentOptions struct {
+	KeepLicense bool // Keep comments with a license or copyright notice before the first code
+	KeepDocs    bool // Keep doc comments: Go declaration comments, /** */ blocks, Rust's /// and //!, and Doxygen's /// and //! in C and C++
+}
+
+// comment is the byte range of a comment in source code
+type comment struct {
+	start, end int
+	doc        bool // Documents the code that follows
+	keep       bool // Changes how the code is built or run, such as a shebang or a //go: directive
+}
+
+// commentScanners find the comments of the languages StripComments supports,
+// keyed by language tag
+var commentScanners = map[string]func(content, lang string) []comment{
+	"go":         cLikeComments,
+	"javascript": cLikeComments,
+	"jsx":        cLikeComments,
+	"typescript": cLikeComments,
+	"tsx":        cLikeComments,
+	"java":       cLikeComments,
+	"c":          cLikeComments,
+	"cpp":        cLikeComments,
+	"rust":       cLikeComments,
+	"python":     pythonComments,
+	"sh":         shellComments,
+	"bash":       shellComments,
+	"zsh":        shellComments,
+	"yaml":       yamlComments,
+}
+
+// licensePattern matches the words of a license or copyright notice
+var licensePattern = regexp.MustCompile(`(?i)\b(copyright|licen[cs]ed?|spdx-license-identifier)\b|\(c\)|©`)
+
+// StripComments removes the line and block comments from content written in
+// lang, a language tag from DetectLanguage, leaving string literals alone. It
+// returns the result and the line number in content of each of its lines:
+// lines that only held a comment are dropped, so the rest can still be cited
+// by their original numbers. Content in other languages is returned
+// unchanged, with nil line numbers.
+func StripComments(content, lang string, options CommentOptions) (string, []int) {
+	scan, ok := commentScanners[lang]
+	if !ok {
+		return content, nil
+	}
+	comments := scan(content, lang)
+	if lang == "go" {
+		markGoComments(content, comments)
+	}
+	if options.KeepLicense {
+		markLicense(content, comments)
+	}
+
+	var stripped strings.Builder
+	stripped.Grow(len(content))
+	last := 0
+	for _, c := range comments {
+		if c.keep || options.KeepDocs && c.doc {
+			continue
+		}
+		stripped.WriteString(content[last:c.start])
+		// Line breaks stay so lines keep their place, and a comment between
+		// two tokens on a line still separates them
+		if breaks := strings.Count(content[c.start:c.end], "\n"); breaks > 0 {
+			stripped.WriteString(strings.Repeat("\n", breaks))
+		} else if c.start > 0 && !isSpace(content[c.start-1]) && c.end < len(content) && !isSpace(content[c.end]) {
+			stripped.WriteString(" ")
+		}
+		last = c.end
+	}
+	stripped.WriteString(content[last:])
+
+	return dropEmptiedLines(content, stripped.String())
+}
+
+// dropEmptiedLines compares content with stripped, the same lines with
+// comments removed, and drops the lines a comment removal left blank and
+// the trailing whitespace it left on the others. It returns the remaining
+// lines and their line numbers in content.
+func dropEmptiedLines(content, stripped string) (string, []int) {
+	originals, lines := splitLines(content), splitLines(stripped)
+
+	var result strings.Builder
+	result.Grow(len(stripped))
+	numbers := make([]int, 0, len(lines))
+	for i, line := range lines {
+		if line != originals[i] {
+			text := strings.TrimRight(strings.TrimSuffix(line, "\n"), " \t\r")
+			if text == "" && strings.TrimSpace(originals[i]) != "" {
+				continue
+			}
+			if strings.HasSuffix(line, "\n") {
+				text += "\n"
+			}
+			line = text
+		}
+		result.WriteString(line)
+		numbers = append(numbers, i+1)
+	}
+	return result.String(), numbers
+}
+
+// CompactWhitespace removes trailing whitespace from each line of content
+// written in lang and drops blank lines. In prose, such as Markdown, plain
+// text and files of unknown language, runs of blank lines collapse into one
+// instead so paragraphs stay apart. It returns the result and the line number
+// in content of each of its lines.
+func CompactWhitespace(content, lang string) (string, []int) {
+	prose := lang == "" || lang == "markdown" || lang == "text" || lang == "rst"
+
+	var result strings.Builder
+	result.Grow(len(content))
+	var numbers []int
+	blank := false // A blank line is pending before the next line of prose
+	for i, line := range splitLines(content) {
+		text := strings.TrimRight(strings.TrimSuffix(line, "\n"), " \t\r")
+		if text == "" {
+			blank = prose && len(numbers) > 0
+			continue
+		}
+		if blank {
+			result.WriteString("\n")
+			numbers = append(numbers, i)
+			blank = false
+		}
+		result.WriteString(text)
+		if strings.HasSuffix(line, "\n") {
+			result.WriteString("\n")
+		}
+		numbers = append(numbers, i+1)
+	}
+	return result.String(), numbers
+}
+
+// splitLines splits content after each line break, without an empty last
+// line when content ends in one
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// markLicense marks the comments before the first code of content that
+// belong to a group mentioning a license or copyright to be kept. Comments on
+// consecutive lines form a group.
+func markLicense(content string, comments []comment) {
+	var group []int // Indexes of the comments in the current group
+	flush := func() {
+		for _, i := range group {
+			if licensePattern.MatchString(content[comments[i].start:comments[i].end]) {
+				for _, j := range group {
+					comments[j].keep = true
+				}
+				break
+			}
+		}
+		group = group[:0]
+	}
+
+	last := 0
+	for i, c := range comments {
+		between := content[last:c.start]
+		if strings.TrimSpace(between) != "" {
+			break // Code comes first
+		}
+		if strings.Count(between, "\n") > 1 {
+			flush()
+		}
+		group = append(group, i)
+		last = c.end
+	}
+	flush()
+}
+
+// markGoComments parses Go content to mark the doc comments of its package,
+// declarations and fields, and the cgo preambles of import "C" to be kept
+func markGoComments(content string, comments []comment) {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if file == nil {
+		return
+	}
+
+	var docs, preambles []*ast.CommentGroup
+	docs = append(docs, file.Doc)
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			docs = append(docs, node.Doc)
+			for _, spec := range node.Specs {
+				if spec, ok := spec.(*ast.ImportSpec); ok && spec.Path.Value == `"C"` {
+					preambles = append(preambles, node.Doc, spec.Doc)
+				}
+			}
+		case *ast.FuncDecl:
+			docs = append(docs, node.Doc)
+		case *ast.TypeSpec:
+			docs = append(docs, node.Doc)
+		case *ast.ValueSpec:
+			docs = append(docs, node.Doc)
+		case *ast.ImportSpec:
+			docs = append(docs, node.Doc)
+		case *ast.Field:
+			docs = append(docs, node.Doc)
+		}
+		return true
+	})
+
+	// within reports whether a comment lies in one of groups
+	within := func(c comment, groups []*ast.CommentGroup) bool {
+		for _, group := range groups {
+			if group != nil && fset.Position(group.Pos()).Offset <= c.start && c.end <= fset.Position(group.End()).Offset {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range comments {
+		comments[i].doc = comments[i].doc || within(comments[i], docs)
+		comments[i].keep = comments[i].keep || within(comments[i], preambles)
+	}
+}
+
+// cLikeComments finds the // and /* */ comments of Go, JavaScript,
+// TypeScript, Java, C, C++ and Rust source, skipping over strings,
+// characters and JavaScript regular expressions
+func cLikeComments(content, lang string) []comment {
+	var comments []comment
+	js := lang == "javascript" || lang == "jsx" || lang == "typescript" || lang == "tsx"
+	prev := byte(0) // Last byte of code before i that isn't whitespace
+
+	for i := 0; i < len(content); {
+		start, c := i, content[i]
+		switch {
+		case strings.HasPrefix(content[i:], "//"):
+			i = lineEnd(content, i)
+			end := i
+			if content[end-1] == '\r' {
+				end-- // The Go parser leaves carriage returns out of comments
+			}
+			text := content[start:end]
+			comments = append(comments, comment{start: start, end: end, doc: cLikeDoc(text, lang), keep: cLikeDirective(text, lang)})
+			continue
+		case strings.HasPrefix(content[i:], "/*"):
+			i = blockCommentEnd(content, i, lang == "rust")
+			comments = append(comments, comment{start: start, end: i, doc: cLikeDoc(content[start:i], lang)})
+			continue
+		case lang == "java" && strings.HasPrefix(content[i:], `"""`):
+			i = quotedEnd(content, i, `"""`, true, true)
+		case c == '"':
+			i = quotedEnd(content, i, `"`, true, lang == "rust")
+		case c == '\'' && lang == "rust":
+			i = rustQuoteEnd(content, i)
+		case c == '\'':
+			i = quotedEnd(content, i, "'", true, false)
+		case c == '`' && lang == "go":
+			i = quotedEnd(content, i, "`", false, true)
+		case c == '`' && js:
+			i = quotedEnd(content, i, "`", true, true)
+		case c == '/' && js && (prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", prev) >= 0):
+			i = regexpEnd(content, i)
+		case lang == "rust" && (c == 'r' || c == 'b') && (i == 0 || !isIdentByte(content[i-1])):
+			i = rustRawStringEnd(content, i)
+		case lang == "cpp" && strings.HasPrefix(content[i:], `R"`) && (i == 0 || !isIdentByte(content[i-1]) || strings.IndexByte("LuU8", content[i-1]) >= 0):
+			i = cppRawStringEnd(content, i)
+		default:
+			i++
+		}
+		if !isSpace(c) {
+			prev = content[i-1]
+		}
+	}
+	return comments
+}
+
+// cLikeDoc reports whether a // or /* */ comment is a doc comment in lang
+func cLikeDoc(text, lang string) bool {
+	if strings.HasPrefix(text, "/**") && !strings.HasPrefix(text, "/***") && text != "/**/" {
+		return true
+	}
+	switch lang {
+	case "rust", "c", "cpp":
+		return strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////") ||
+			strings.HasPrefix(text, "//!") || strings.HasPrefix(text, "/*!")
+	}
+	return false
+}
+
+// cLikeDirective reports whether a // comment instructs the compiler in
+// lang, such as //go:build or TypeScript's /// <reference>
+func cLikeDirective(text, lang string) bool {
+	switch lang {
+	case "go":
+		return strings.HasPrefix(text, "//go:") || strings.HasPrefix(text, "// +build") ||
+			strings.HasPrefix(text, "//line ") || strings.HasPrefix(text, "//export ")
+	case "javascript", "jsx", "typescript", "tsx":
+		return strings.HasPrefix(text, "/// <")
+	}
+	return false
+}
+
+// blockCommentEnd returns the index just past the /* */ comment at i, which
+// may hold nested comments when nested is set
+func blockCommentEnd(content string, i int, nested bool) int {
+	depth := 0
+	for i < len(content) {
+		switch {
+		case strings.HasPrefix(content[i:], "/*") && (nested || depth == 0):
+			depth++
+			i += 2
+		case strings.HasPrefix(content[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(content)
+}
+
+// rustQuoteEnd returns the index just past the character literal at i, or
+// just past the quote of a lifetime such as 'a
+func rustQuoteEnd(content string, i int) int {
+	if strings.HasPrefix(content[i:], `'\`) {
+		return quotedEnd(content, i, "'", true, false)
+	}
+	_, size := utf8.DecodeRuneInString(content[i+1:])
+	if end := i + 1 + size; end < len(content) && content[end] == '\'' {
+		return end + 1
+	}
+	return i + 1
+}
+
+// rustRawStringEnd returns the index just past the raw string, such as
+// r#"..."# or br"...", that starts at i, or i+1 if none does
+func rustRawStringEnd(content string, i int) int {
+	j := i
+	if content[j] == 'b' {
+		j++
+	}
+	if j >= len(content) || content[j] != 'r' {
+		return i + 1
+	}
+	j++
+	hashes := 0
+	for j < len(content) && content[j] == '#' {
+		hashes++
+		j++
+	}
+	if j >= len(content) || content[j] != '"' {
+		return i + 1
+	}
+	closing := `"` + strings.Repeat("#", hashes)
+	if n := strings.Index(content[j+1:], closing); n >= 0 {
+		return j + 1 + n + len(closing)
+	}
+	return len(content)
+}
+
+// cppRawStringEnd returns the index just past the C++ raw string
+// R"delimiter(...)delimiter" that starts at i
+func cppRawStringEnd(content string, i int) int {
+	open := strings.IndexByte(content[i+2:], '(')
+	if open < 0 || open > 16 {
+		return i + 1
+	}
+	closing := ")" + content[i+2:i+2+open] + `"`
+	if n := strings.Index(content[i+3+open:], closing); n >= 0 {
+		return i + 3 + open + n + len(closing)
+	}
+	return len(content)
+}
+
+// regexpEnd returns the index just past the JavaScript regular expression
+// literal at i, whose slashes may appear escaped or in a character class
+func regexpEnd(content string, i int) int {
+	inClass := false
+	for j := i + 1; j < len(content); j++ {
+		switch content[j] {
+		case '\\':
+			j++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return j + 1
+			}
+		case '\n':
+			return j
+		}
+	}
+	return len(content)
+}
+
+// pythonComments finds the # comments of Python source, skipping over
+// strings. A shebang and an encoding declaration are kept.
+func pythonComments(content, lang string) []comment {
+	var comments []comment
+	for i := 0; i < len(content); {
+		switch c := content[i]; {
+		case c == '#':
+			end := lineEnd(content, i)
+			directive := i == 0 && strings.HasPrefix(content, "#!") ||
+				strings.Count(content[:i], "\n") < 2 && strings.Contains(content[i:end], "coding")
+			comments = append(comments, comment{start: i, end: end, keep: directive})
+			i = end
+		case c == '"' || c == '\'':
+			quote := content[i : i+1]
+			if triple := strings.Repeat(quote, 3); strings.HasPrefix(content[i:], triple) {
+				i = quotedEnd(content, i, triple, true, true)
+			} else {
+				i = quotedEnd(content, i, quote, true, false)
+			}
+		default:
+			i++
+		}
+	}
+	return comments
+}
+
+// heredoc is a pending here-document of a shell script
+type heredoc struct {
+	word string // Line that ends the document
+	tabs bool   // Leading tabs are ignored, as with <<-
+}
+
+// shellComments finds the # comments of shell scripts, skipping over quoted
+// strings, escaped characters and here-documents. A shebang is kept.
+func shellComments(content, lang string) []comment {
+	var comments []comment
+	var heredocs []heredoc
+	for i := 0; i < len(content); {
+		switch c := content[i]; {
+		case c == '#' && (i == 0 || isSpace(content[i-1]) || strings.IndexByte(";&|()<>", content[i-1]) >= 0):
+			end := lineEnd(content, i)
+			comments = append(comments, comment{start: i, end: end, keep: i == 0 && strings.HasPrefix(content, "#!")})
+			i = end
+		case c == '\\':
+			i += 2
+		case c == '\'':
+			i = quotedEnd(content, i, "'", i > 0 && content[i-1] == '$', true)
+		case c == '"':
+			i = quotedEnd(content, i, `"`, true, true)
+		case strings.HasPrefix(content[i:], "<<<"):
+			i += 3
+		case strings.HasPrefix(content[i:], "<<"):
+			var doc heredoc
+			doc, i = parseHeredoc(content, i+2)
+			// A number is a shift, as in $((1 << 2))
+			if strings.Trim(doc.word, "0123456789") != "" {
+				heredocs = append(heredocs, doc)
+			}
+		case c == '\n' && len(heredocs) > 0:
+			// Here-documents start on the next line
+			i++
+			for _, doc := range heredocs {
+				i = heredocEnd(content, i, doc)
+			}
+			heredocs = nil
+		default:
+			i++
+		}
+	}
+	return comments
+}
+
+// parseHeredoc reads the delimiter of a here-document after the << at i, and
+// returns it with the index just past it
+func parseHeredoc(content string, i int) (heredoc, int) {
+	var doc heredoc
+	if i < len(content) && content[i] == '-' {
+		doc.tabs = true
+		i++
+	}
+	for i < len(content) && (content[i] == ' ' || content[i] == '\t') {
+		i++
+	}
+	start := i
+	for i < len(content) && !isSpace(content[i]) && strings.IndexByte(";&|()<>", content[i]) < 0 {
+		i++
+	}
+	doc.word = strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(content[start:i])
+	return doc, i
+}
+
+// heredocEnd returns the index of the line break after the line at or past i
+// that ends doc, or len(content)
+func heredocEnd(content string, i int, doc heredoc) int {
+	for i < len(content) {
+		end := lineEnd(content, i)
+		line := strings.TrimSuffix(content[i:end], "\r")
+		if doc.tabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == doc.word {
+			return end
+		}
+		i = end + 1
+	}
+	return len(content)
+}
+
+// yamlBlockScalar matches a line that starts a literal or folded block
+// scalar, such as "key: |" or "- >-"
+var yamlBlockScalar = regexp.MustCompile(`(^|[:-]\s)\s*[|>][1-9+-]{0,2}\s*$`)
+
+// yamlComments finds the # comments of YAML documents, skipping over quoted
+// scalars and the lines of block scalars
+func yamlComments(content, lang string) []comment {
+	var comments []comment
+	block := -1 // Indentation of the line that started a block scalar being skipped, or -1
+
+	for i := 0; i < len(content); {
+		end := lineEnd(content, i)
+		line := content[i:end]
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if block >= 0 {
+			if strings.TrimSpace(line) == "" || indent > block {
+				i = end + 1
+				continue
+			}
+			block = -1
+		}
+
+		lineStart, codeEnd := i, end
+		for j := i + indent; j < end; {
+			switch c := content[j]; {
+			case c == '#' && (j == i || content[j-1] == ' ' || content[j-1] == '\t'):
+				comments = append(comments, comment{start: j, end: end})
+				codeEnd, j = j, end
+			case (c == '"' || c == '\'') && (j == i+indent || strings.IndexByte(" \t[{,:", content[j-1]) >= 0):
+				j = yamlQuotedEnd(content, j)
+				if j > end {
+					// The scalar went on over more lines
+					i = strings.LastIndexByte(content[:j], '\n') + 1
+					end, codeEnd = lineEnd(content, j), lineEnd(content, j)
+				}
+			default:
+				j++
+			}
+		}
+		if i == lineStart && yamlBlockScalar.MatchString(content[i:codeEnd]) {
+			block = indent
+		}
+		i = end + 1
+	}
+	return comments
+}
+
+// yamlQuotedEnd returns the index just past the quoted scalar at i. Double
+// quotes are escaped with a backslash, and single quotes by doubling them.
+func yamlQuotedEnd(content string, i int) int {
+	if content[i] == '"' {
+		return quotedEnd(content, i, `"`, true, true)
+	}
+	end := quotedEnd(content, i, "'", false, true)
+	for end < len(content) && content[end] == '\'' {
+		end = quotedEnd(content, end, "'", false, true)
+	}
+	return end
+}
+
+// quotedEnd returns the index just past the string literal opened by quote
+// at i. A backslash escapes the next byte when escapes is set. A literal
+// left open ends at the line break unless multiline is set.
+func quotedEnd(content string, i int, quote string, escapes, multiline bool) int {
+	for j := i + len(quote); j < len(content); j++ {
+		switch {
+		case escapes && content[j] == '\\':
+			j++
+		case !multiline && content[j] == '\n':
+			return j
+		case strings.HasPrefix(content[j:], quote):
+			return j + len(quote)
+		}
+	}
+	return len(content)
+}
+
+// lineEnd returns the index of the line break ending the line at i, or
+// len(content) on the last line
+func lineEnd(content string, i int) int {
+	if n := strings.IndexByte(content[i:], '\n'); n >= 0 {
+		return i + n
+	}
+	return len(content)
+}
+
+// isSpace reports whether b is ASCII whitespace
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// isIdentByte reports whether b can be part of an identifier
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
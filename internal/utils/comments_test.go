@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	testCases := []struct {
+		lang     string
+		content  string
+		options  CommentOptions
+		expected string
+		desc     string
+	}{
+		{
+			"go",
+			"package main\n\n// Helper is documented\nfunc Helper() {\n\t// inside\n\ts := \"// not a comment\" // trailing\n\t_ = `/* raw */`\n}\n",
+			CommentOptions{},
+			"package main\n\nfunc Helper() {\n\ts := \"// not a comment\"\n\t_ = `/* raw */`\n}\n",
+			"Go",
+		},
+		{
+			"go",
+			"// Copyright 2024 The Authors\n\n// Package main runs\npackage main\n\n// T is a type\ntype T struct {\n\t// F is a field\n\tF int // trailing\n}\n\nfunc f() {\n\t// inside\n}\n",
+			CommentOptions{KeepLicense: true, KeepDocs: true},
+			"// Copyright 2024 The Authors\n\n// Package main runs\npackage main\n\n// T is a type\ntype T struct {\n\t// F is a field\n\tF int\n}\n\nfunc f() {\n}\n",
+			"Go license and docs kept",
+		},
+		{
+			"go",
+			"//go:build linux\n\npackage main\n\n/*\n#include <stdio.h>\n*/\nimport \"C\"\n",
+			CommentOptions{},
+			"//go:build linux\n\npackage main\n\n/*\n#include <stdio.h>\n*/\nimport \"C\"\n",
+			"Go directives and cgo preamble",
+		},
+		{
+			"javascript",
+			"/** Doc */\nconst re = /\\/\\/ not a comment/; // trailing\nconst t = `a ${b} // c`;\n/* block\n   spanning */ const x = a / b; // d\n",
+			CommentOptions{KeepDocs: true},
+			"/** Doc */\nconst re = /\\/\\/ not a comment/;\nconst t = `a ${b} // c`;\n const x = a / b;\n",
+			"JavaScript",
+		},
+		{
+			"typescript",
+			"/// <reference types=\"node\" />\nlet a = 'it\\'s // here'; /* x */\n",
+			CommentOptions{},
+			"/// <reference types=\"node\" />\nlet a = 'it\\'s // here';\n",
+			"TypeScript",
+		},
+		{
+			"java",
+			"/**\n * Greets\n */\nclass A {\n    String s = \"\"\"\n        // text block\n        \"\"\"; // end\n}\n",
+			CommentOptions{},
+			"class A {\n    String s = \"\"\"\n        // text block\n        \"\"\";\n}\n",
+			"Java",
+		},
+		{
+			"cpp",
+			"/// Doxygen\nint a = 1; // one\nauto s = R\"x(// raw)x\";\nchar c = '/'; /* two */ int b;\n",
+			CommentOptions{KeepDocs: true},
+			"/// Doxygen\nint a = 1;\nauto s = R\"x(// raw)x\";\nchar c = '/';  int b;\n",
+			"C++",
+		},
+		{
+			"rust",
+			"//! Crate docs\n/* outer /* nested */ still */ fn f<'a>(s: &'a str) -> char { '\"' } // end\nlet r = r#\"// raw \"#;\n/// Item docs\nfn g() {}\n",
+			CommentOptions{},
+			" fn f<'a>(s: &'a str) -> char { '\"' }\nlet r = r#\"// raw \"#;\nfn g() {}\n",
+			"Rust",
+		},
+		{
+			"python",
+			"#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\n# A comment\ns = \"# not\"  # trailing\nt = '''\n# inside a docstring\n'''\n",
+			CommentOptions{},
+			"#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\ns = \"# not\"\nt = '''\n# inside a docstring\n'''\n",
+			"Python",
+		},
+		{
+			"bash",
+			"#!/bin/bash\n# comment\necho \"a # b\" 'c # d' e#f $# # tail\ncat <<-'END'\n\t# heredoc\n\tEND\necho $((1 << 2)) # shift\n",
+			CommentOptions{},
+			"#!/bin/bash\necho \"a # b\" 'c # d' e#f $#\ncat <<-'END'\n\t# heredoc\n\tEND\necho $((1 << 2))\n",
+			"Shell",
+		},
+		{
+			"yaml",
+			"# comment\nkey: value # tail\nurl: http://example.com/#anchor\nquoted: 'it''s # here' # tail\nscript: |\n  # kept in block\n  echo\nnext: \"# not\"\n",
+			CommentOptions{},
+			"key: value\nurl: http://example.com/#anchor\nquoted: 'it''s # here'\nscript: |\n  # kept in block\n  echo\nnext: \"# not\"\n",
+			"YAML",
+		},
+		{
+			"yaml",
+			"# Copyright 2024 The Authors\n# Licensed under MIT\n\n# Settings\nkey: value\n",
+			CommentOptions{KeepLicense: true},
+			"# Copyright 2024 The Authors\n# Licensed under MIT\n\nkey: value\n",
+			"License header kept",
+		},
+		{
+			"markdown",
+			"# Title <!-- note -->\n",
+			CommentOptions{},
+			"# Title <!-- note -->\n",
+			"Unsupported language",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, _ := StripComments(tc.content, tc.lang, tc.options)
+			if result != tc.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestStripComments_LineNumbers(t *testing.T) {
+	content := "package main\n\n// doc\nfunc main() {\n\t/* a\n\t   b */\n\tprintln() // c\n}"
+
+	result, numbers := StripComments(content, "go", CommentOptions{})
+	if expected := "package main\n\nfunc main() {\n\tprintln()\n}"; result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+	if expected := "[1 2 4 7 8]"; fmt.Sprint(numbers) != expected {
+		t.Errorf("Expected line numbers %s, got %v", expected, numbers)
+	}
+	if _, numbers := StripComments(content, "text", CommentOptions{}); numbers != nil {
+		t.Errorf("Expected nil line numbers for an unsupported language, got %v", numbers)
+	}
+}
+
+func TestCompactWhitespace(t *testing.T) {
+	testCases := []struct {
+		lang     string
+		content  string
+		expected string
+		numbers  string
+		desc     string
+	}{
+		{"go", "package main  \n\n\nfunc main() {}\t\n\n", "package main\nfunc main() {}\n", "[1 4]", "Code"},
+		{"markdown", "\n# Title\n\n\n\nText \r\nMore\n\n", "# Title\n\nText\nMore\n", "[2 5 6 7]", "Prose"},
+		{"", "a\n\nb", "a\n\nb", "[1 2 3]", "Unknown language"},
+		{"python", "", "", "[]", "Empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, numbers := CompactWhitespace(tc.content, tc.lang)
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+			if fmt.Sprint(numbers) != tc.numbers {
+				t.Errorf("Expected line numbers %s, got %v", tc.numbers, numbers)
+			}
+		})
+	}
+}
+
+func TestNumberLinesAt(t *testing.T) {
+	if result := NumberLinesAt("a\nb\n", []int{3, 12}); result != " 3 | a\n12 | b\n" {
+		t.Errorf("Expected the given line numbers, got %q", result)
+	}
+}
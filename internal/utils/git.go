@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"net/url"
 	"os/exec"
+	"path"
 	"strings"
 )
 
@@ -24,7 +26,107 @@ func IsGitURL(source string) bool {
 		return true
 	}
 
-	return false
+	// Check for repository web URLs on other hosts, such as Gitea instances
+	_, ok := ParseRepoURL(source)
+	return ok
+}
+
+// RepoURL is a repository web URL split into what is needed to clone it
+type RepoURL struct {
+	CloneURL string // URL to pass to git clone
+	Ref      string // Branch, tag or commit named in the URL, if any
+	Subpath  string // Directory within the repository named in the URL, if any
+}
+
+// knownHosts are hosts whose plain repository URLs are recognized
+var knownHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+	"codeberg.org":  true,
+}
+
+// ParseRepoURL recognizes repository web URLs as copied from a browser:
+//
+//	https://github.com/org/repo/tree/main/services/api
+//	https://gitlab.com/group/sub/repo/-/tree/main/services/api
+//	https://bitbucket.org/org/repo/src/main/services/api
+//	https://gitea.example.com/org/repo/src/branch/main/services/api
+//
+// and plain repository URLs on known hosts. For links to a file (GitHub and
+// GitLab blob URLs), Subpath is the file's directory. The ref is always a
+// single path segment, so refs containing slashes can't be told apart from
+// the path; pass those separately. ok is false for anything else, including
+// SSH and .git clone URLs, which need no parsing.
+func ParseRepoURL(source string) (repoURL RepoURL, ok bool) {
+	parsed, err := url.Parse(source)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return RepoURL{}, false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	// repoSegments is the number of segments naming the repository; the web
+	// route, if any, follows them
+	repoSegments, route := 0, []string(nil)
+	host := strings.ToLower(parsed.Hostname())
+	switch {
+	case indexOf(segments, "-") >= 2:
+		// GitLab: groups can nest, so the route starts after "/-/"
+		repoSegments = indexOf(segments, "-")
+		route = segments[repoSegments+1:]
+		if len(route) >= 2 && (route[0] == "tree" || route[0] == "blob") {
+			repoURL.Ref, repoURL.Subpath = route[1], subpath(route[2:], route[0] == "blob")
+		}
+	case len(segments) >= 5 && segments[2] == "src" && host != "bitbucket.org" &&
+		(segments[3] == "branch" || segments[3] == "tag" || segments[3] == "commit"):
+		// Gitea and Forgejo
+		repoSegments = 2
+		repoURL.Ref, repoURL.Subpath = segments[4], subpath(segments[5:], false)
+	case len(segments) >= 4 && segments[2] == "src" && host == "bitbucket.org":
+		repoSegments = 2
+		repoURL.Ref, repoURL.Subpath = segments[3], subpath(segments[4:], false)
+	case len(segments) >= 4 && (segments[2] == "tree" || segments[2] == "blob"):
+		// GitHub, and GitLab's older routes without "/-/"
+		repoSegments = 2
+		repoURL.Ref, repoURL.Subpath = segments[3], subpath(segments[4:], segments[2] == "blob")
+	case knownHosts[host] && len(segments) >= 2:
+		repoSegments = len(segments)
+		if host != "gitlab.com" {
+			// Other pages of the repository, such as /issues
+			repoSegments = 2
+		}
+	default:
+		return RepoURL{}, false
+	}
+
+	clone := url.URL{Scheme: parsed.Scheme, User: parsed.User, Host: parsed.Host, Path: "/" + strings.Join(segments[:repoSegments], "/")}
+	repoURL.CloneURL = clone.String()
+	return repoURL, true
+}
+
+// subpath joins the path segments of a web URL, dropping the file name of
+// links to a file
+func subpath(segments []string, isFile bool) string {
+	if isFile && len(segments) > 0 {
+		segments = segments[:len(segments)-1]
+	}
+	return path.Join(segments...)
+}
+
+// indexOf returns the index of the first segment equal to s, or -1
+func indexOf(segments []string, s string) int {
+	for i, segment := range segments {
+		if segment == s {
+			return i
+		}
+	}
+	return -1
 }
 
 // IsGitAvailable checks if git command is available on PATH
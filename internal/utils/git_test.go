@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestParseRepoURL(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected RepoURL
+		ok       bool
+		desc     string
+	}{
+		{"https://github.com/org/repo/tree/main/services/api", RepoURL{"https://github.com/org/repo", "main", "services/api"}, true, "GitHub tree URL"},
+		{"https://github.com/org/repo/tree/v1.2.0", RepoURL{"https://github.com/org/repo", "v1.2.0", ""}, true, "GitHub tree URL without a path"},
+		{"https://github.com/org/repo/blob/main/cmd/tool/main.go", RepoURL{"https://github.com/org/repo", "main", "cmd/tool"}, true, "GitHub blob URL selects the file's directory"},
+		{"https://github.com/org/repo/tree/main/docs/?tab=readme#intro", RepoURL{"https://github.com/org/repo", "main", "docs"}, true, "Query, fragment and trailing slash"},
+		{"https://github.com/org/repo", RepoURL{"https://github.com/org/repo", "", ""}, true, "Plain GitHub URL"},
+		{"https://github.com/org/repo/issues/12", RepoURL{"https://github.com/org/repo", "", ""}, true, "Other GitHub page"},
+		{"https://gitlab.com/group/sub/repo/-/tree/develop/src", RepoURL{"https://gitlab.com/group/sub/repo", "develop", "src"}, true, "GitLab nested group tree URL"},
+		{"https://gitlab.com/group/repo/-/blob/main/README.md", RepoURL{"https://gitlab.com/group/repo", "main", ""}, true, "GitLab blob URL at the root"},
+		{"https://gitlab.com/group/sub/repo", RepoURL{"https://gitlab.com/group/sub/repo", "", ""}, true, "Plain GitLab nested group URL"},
+		{"https://gitlab.example.com/group/repo/-/tree/main/lib", RepoURL{"https://gitlab.example.com/group/repo", "main", "lib"}, true, "Self-hosted GitLab"},
+		{"https://bitbucket.org/org/repo/src/main/api/v1/", RepoURL{"https://bitbucket.org/org/repo", "main", "api/v1"}, true, "Bitbucket src URL"},
+		{"https://gitea.example.com/org/repo/src/branch/main/pkg", RepoURL{"https://gitea.example.com/org/repo", "main", "pkg"}, true, "Gitea branch URL"},
+		{"https://codeberg.org/org/repo/src/tag/v2.0", RepoURL{"https://codeberg.org/org/repo", "v2.0", ""}, true, "Forgejo tag URL"},
+		{"https://git.example.com:3000/org/repo/src/commit/0123abcd/docs", RepoURL{"https://git.example.com:3000/org/repo", "0123abcd", "docs"}, true, "Gitea commit URL with a port"},
+		{"git@github.com:org/repo.git", RepoURL{}, false, "SSH URL"},
+		{"https://example.com/page", RepoURL{}, false, "Unrelated web page"},
+		{"/local/path", RepoURL{}, false, "Local path"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, ok := ParseRepoURL(tc.source)
+			if ok != tc.ok || result != tc.expected {
+				t.Errorf("ParseRepoURL(%q): expected %+v %v, got %+v %v", tc.source, tc.expected, tc.ok, result, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash-separated name matches pattern. On top of
+// the path.Match syntax it supports "**" as a whole path segment, matching any
+// number of directories, and {a,b} alternatives, which may be nested.
+func MatchGlob(pattern, name string) bool {
+	for _, expanded := range ExpandBraces(pattern) {
+		if MatchDoublestar(expanded, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchDoublestar is MatchGlob without brace expansion. A "**" segment matches
+// zero or more directories, except at the end of a pattern, where it matches
+// everything inside the directory but not the directory itself. A "**" that
+// is not a whole segment behaves like "*".
+func MatchDoublestar(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(patternSegments, nameSegments []string) bool {
+	for len(patternSegments) > 0 {
+		if patternSegments[0] == "**" {
+			if len(patternSegments) == 1 {
+				return len(nameSegments) > 0
+			}
+			for i := 0; i <= len(nameSegments); i++ {
+				if matchSegments(patternSegments[1:], nameSegments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(nameSegments) == 0 {
+			return false
+		}
+		segment := strings.ReplaceAll(patternSegments[0], "**", "*")
+		if matched, _ := path.Match(segment, nameSegments[0]); !matched {
+			return false
+		}
+		patternSegments, nameSegments = patternSegments[1:], nameSegments[1:]
+	}
+	return len(nameSegments) == 0
+}
+
+// ExpandBraces expands {a,b} alternatives in pattern into separate patterns.
+// Braces without a closing brace and escaped braces are left as they are.
+func ExpandBraces(pattern string) []string {
+	depth, start := 0, -1
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++ // Skip the escaped character
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			// Expand the first top-level group, then the rest of the pattern recursively
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			var expanded []string
+			for _, alternative := range splitAlternatives(pattern[start+1 : i]) {
+				expanded = append(expanded, ExpandBraces(prefix+alternative+suffix)...)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// splitAlternatives splits the inside of a brace group on top-level commas
+func splitAlternatives(group string) []string {
+	var alternatives []string
+	depth, start := 0, 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, group[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alternatives, group[start:])
+}
+
+// matchPath reports whether pattern matches relPath itself, either the full
+// path or just its name. Patterns with a trailing slash only match directories.
+func matchPath(pattern, relPath string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return MatchGlob(pattern, relPath) || MatchGlob(pattern, path.Base(relPath))
+}
+
+// matchParent reports whether pattern matches one of relPath's parent directories
+func matchParent(pattern, relPath string) bool {
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if matchPath(pattern, dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchInclude reports whether an include pattern selects relPath. A
+// directory pattern with a trailing slash selects everything inside it.
+func matchInclude(pattern, relPath string, isDir bool) bool {
+	if matchPath(pattern, relPath, isDir) {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/") && matchParent(pattern, relPath)
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+		desc     string
+	}{
+		{"*.go", "main.go", true, "Single star"},
+		{"*.go", "src/main.go", false, "Single star does not cross directories"},
+		{"src/**/*.go", "src/main.go", true, "Double star matches zero directories"},
+		{"src/**/*.go", "src/a/b/main.go", true, "Double star matches nested directories"},
+		{"src/**/*.go", "lib/main.go", false, "Double star keeps the prefix"},
+		{"**/testdata/**", "pkg/testdata/input.txt", true, "Double star on both sides"},
+		{"**/testdata/**", "testdata/input.txt", true, "Leading double star matches the root"},
+		{"**/testdata/**", "pkg/testdata", false, "Trailing double star does not match the directory itself"},
+		{"docs/**", "docs/api/index.md", true, "Trailing double star"},
+		{"**", "any/path/at/all", true, "Double star alone"},
+		{"a**b", "axxb", true, "Double star inside a segment acts like a single star"},
+		{"a**b", "ax/xb", false, "Double star inside a segment does not cross directories"},
+		{"*.{go,py}", "main.py", true, "Brace alternatives"},
+		{"*.{go,py}", "main.rs", false, "Brace alternatives do not match others"},
+		{"{cmd,internal}/**/*.go", "internal/utils/glob.go", true, "Brace alternatives with double star"},
+		{"*.{c{,pp},h}", "main.cpp", true, "Nested brace alternatives"},
+		{"*.{c{,pp},h}", "main.c", true, "Empty brace alternative"},
+		{"file[0-9].txt", "file7.txt", true, "Character class"},
+		{"\\{literal\\}", "{literal}", true, "Escaped braces"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := MatchGlob(tc.pattern, tc.name); result != tc.expected {
+				t.Errorf("MatchGlob(%q, %q): expected %v, got %v", tc.pattern, tc.name, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*.go", []string{"*.go"}},
+		{"*.{go,py}", []string{"*.go", "*.py"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"x{a,{b,c}}", []string{"xa", "xb", "xc"}},
+		{"unclosed{a,b", []string{"unclosed{a,b"}},
+	}
+
+	for _, tc := range testCases {
+		if result := ExpandBraces(tc.pattern); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("ExpandBraces(%q): expected %v, got %v", tc.pattern, tc.expected, result)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"*.go, *.py ,,", []string{"*.go", "*.py"}},
+		{"*.{go,py},docs/**", []string{"*.{go,py}", "docs/**"}},
+		{"{a,{b,c}}/*,d", []string{"{a,{b,c}}/*", "d"}},
+	}
+
+	for _, tc := range testCases {
+		if result := ParsePatterns(tc.input); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("ParsePatterns(%q): expected %v, got %v", tc.input, tc.expected, result)
+		}
+	}
+}
+
+// legacyShouldIncludeFile is the filepath.Match based implementation that
+// ShouldIncludeFile replaced, kept to document where behavior changed
+func legacyShouldIncludeFile(relativePath string, includePatterns, excludePatterns []string) bool {
+	fileName := filepath.Base(relativePath)
+	matchesInclude := func() bool {
+		for _, includePattern := range includePatterns {
+			if matched, _ := filepath.Match(includePattern, relativePath); matched {
+				return true
+			}
+			if matched, _ := filepath.Match(includePattern, fileName); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range excludePatterns {
+		matchedPath, _ := filepath.Match(pattern, relativePath)
+		matchedName, _ := filepath.Match(pattern, fileName)
+		if matchedPath || matchedName {
+			return matchesInclude()
+		}
+
+		dir := filepath.Dir(relativePath)
+		for dir != "." && dir != "/" {
+			if matched, _ := filepath.Match(pattern, filepath.Base(dir)); matched {
+				return false
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	if len(includePatterns) > 0 {
+		return matchesInclude()
+	}
+	return true
+}
+
+func TestShouldIncludeFile_Compatibility(t *testing.T) {
+	testCases := []struct {
+		include  []string
+		exclude  []string
+		path     string
+		expected bool
+		changed  bool // The result differs from legacyShouldIncludeFile on purpose
+		desc     string
+	}{
+		// Behavior kept from the filepath.Match implementation
+		{nil, nil, "main.go", true, false, "No patterns"},
+		{nil, []string{"*.log"}, "debug.log", false, false, "Exclude by name"},
+		{nil, []string{"*.log"}, "logs/debug.log", false, false, "Exclude by name in a subdirectory"},
+		{nil, []string{"node_modules"}, "node_modules/pkg/index.js", false, false, "Exclude by parent directory name"},
+		{nil, []string{"src/gen.go"}, "src/gen.go", false, false, "Exclude by full path"},
+		{nil, []string{"src/*.go"}, "src/main.go", false, false, "Exclude by full path glob"},
+		{nil, []string{"src/*.go"}, "src/pkg/main.go", true, false, "Single star does not cross directories"},
+		{[]string{"*.go"}, nil, "main.go", true, false, "Include by name"},
+		{[]string{"*.go"}, nil, "pkg/util.go", true, false, "Include by name in a subdirectory"},
+		{[]string{"*.go"}, nil, "README.md", false, false, "Include list drops other files"},
+		{[]string{"*.go"}, []string{"*_test.go"}, "main_test.go", true, false, "Include overrides a matching exclude"},
+		{[]string{"*.go"}, []string{"vendor"}, "vendor/lib.go", false, false, "Include does not override an excluded parent"},
+		{[]string{"cmd/*.go"}, nil, "cmd/main.go", true, false, "Include by full path glob"},
+
+		// Behavior the glob engine adds
+		{[]string{"src/**/*.go"}, nil, "src/a/b/main.go", true, true, "Double star include"},
+		{[]string{"src/**/*.go"}, nil, "src/main.go", true, true, "Double star include at zero depth"},
+		{nil, []string{"**/testdata/**"}, "pkg/sub/testdata/input.txt", false, true, "Double star exclude"},
+		{nil, []string{"docs/**"}, "docs/api/index.md", false, true, "Trailing double star exclude"},
+		{[]string{"*.{go,py}"}, nil, "tool.py", true, true, "Brace include"},
+		{nil, []string{"*.{tmp,bak}"}, "notes.bak", false, true, "Brace exclude"},
+		{nil, []string{"debug/"}, "debug/trace.txt", false, true, "Directory exclude with trailing slash"},
+		{nil, []string{"debug/"}, "src/debug/trace.txt", false, true, "Directory exclude at any depth"},
+		{nil, []string{"debug/"}, "debug", true, false, "Directory pattern does not match a file"},
+		{[]string{"docs/"}, nil, "docs/guide.md", true, true, "Directory include selects its contents"},
+		{nil, []string{"src/generated"}, "src/generated/types.go", false, true, "Exclude by full parent path"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := ShouldIncludeFile(tc.path, tc.include, tc.exclude); result != tc.expected {
+				t.Errorf("ShouldIncludeFile(%q, %q, %q): expected %v, got %v", tc.path, tc.include, tc.exclude, tc.expected, result)
+			}
+			if legacy := legacyShouldIncludeFile(tc.path, tc.include, tc.exclude); (legacy != tc.expected) != tc.changed {
+				t.Errorf("Legacy result %v for %q: expected changed=%v", legacy, tc.path, tc.changed)
+			}
+		})
+	}
+}
+
+func TestShouldIncludePath_Directories(t *testing.T) {
+	testCases := []struct {
+		include  []string
+		exclude  []string
+		path     string
+		expected bool
+		desc     string
+	}{
+		{nil, []string{"debug/"}, "debug", false, "Directory pattern matches a directory"},
+		{nil, []string{"logs/deep/"}, "logs/deep", false, "Directory pattern with a path"},
+		{[]string{"*.go"}, nil, "src", true, "Include patterns never prune directories"},
+		{[]string{"src/**/*.go"}, []string{"vendor"}, "vendor", false, "Excludes still prune directories"},
+		{[]string{"vendor"}, []string{"vendor"}, "vendor", true, "Include overrides an excluded directory"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := ShouldIncludePath(tc.path, true, tc.include, tc.exclude); result != tc.expected {
+				t.Errorf("ShouldIncludePath(%q): expected %v, got %v", tc.path, tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// languageExtensions maps lowercase file extensions to Markdown code block
+// language tags
+var languageExtensions = map[string]string{
+	".go":         "go",
+	".py":         "python",
+	".pyi":        "python",
+	".js":         "javascript",
+	".mjs":        "javascript",
+	".cjs":        "javascript",
+	".jsx":        "jsx",
+	".ts":         "typescript",
+	".mts":        "typescript",
+	".cts":        "typescript",
+	".tsx":        "tsx",
+	".java":       "java",
+	".kt":         "kotlin",
+	".kts":        "kotlin",
+	".scala":      "scala",
+	".groovy":     "groovy",
+	".gradle":     "groovy",
+	".rb":         "ruby",
+	".php":        "php",
+	".rs":         "rust",
+	".c":          "c",
+	".h":          "c",
+	".cc":         "cpp",
+	".cpp":        "cpp",
+	".cxx":        "cpp",
+	".hh":         "cpp",
+	".hpp":        "cpp",
+	".hxx":        "cpp",
+	".cs":         "csharp",
+	".fs":         "fsharp",
+	".swift":      "swift",
+	".m":          "objectivec",
+	".mm":         "objectivec",
+	".dart":       "dart",
+	".lua":        "lua",
+	".pl":         "perl",
+	".pm":         "perl",
+	".r":          "r",
+	".jl":         "julia",
+	".ex":         "elixir",
+	".exs":        "elixir",
+	".erl":        "erlang",
+	".hs":         "haskell",
+	".clj":        "clojure",
+	".ml":         "ocaml",
+	".zig":        "zig",
+	".nim":        "nim",
+	".sh":         "bash",
+	".bash":       "bash",
+	".zsh":        "zsh",
+	".fish":       "fish",
+	".ps1":        "powershell",
+	".bat":        "batch",
+	".cmd":        "batch",
+	".sql":        "sql",
+	".html":       "html",
+	".htm":        "html",
+	".css":        "css",
+	".scss":       "scss",
+	".sass":       "sass",
+	".less":       "less",
+	".vue":        "vue",
+	".svelte":     "svelte",
+	".json":       "json",
+	".jsonc":      "jsonc",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".toml":       "toml",
+	".xml":        "xml",
+	".svg":        "xml",
+	".ini":        "ini",
+	".cfg":        "ini",
+	".properties": "properties",
+	".md":         "markdown",
+	".markdown":   "markdown",
+	".ipynb":      "markdown", // Notebooks are digested as Markdown cells
+	".rst":        "rst",
+	".tex":        "latex",
+	".graphql":    "graphql",
+	".gql":        "graphql",
+	".proto":      "protobuf",
+	".tf":         "hcl",
+	".hcl":        "hcl",
+	".nix":        "nix",
+	".cmake":      "cmake",
+	".mk":         "makefile",
+	".dockerfile": "dockerfile",
+	".diff":       "diff",
+	".patch":      "diff",
+	".csv":        "csv",
+	".txt":        "text",
+}
+
+// languageFileNames maps lowercase file names without a telling extension
+// to language tags
+var languageFileNames = map[string]string{
+	"dockerfile":     "dockerfile",
+	"containerfile":  "dockerfile",
+	"makefile":       "makefile",
+	"gnumakefile":    "makefile",
+	"cmakelists.txt": "cmake",
+	"gemfile":        "ruby",
+	"rakefile":       "ruby",
+	"jenkinsfile":    "groovy",
+	"vagrantfile":    "ruby",
+	".bashrc":        "bash",
+	".bash_profile":  "bash",
+	".profile":       "bash",
+	".zshrc":         "zsh",
+	".gitignore":     "gitignore",
+	".gingestignore": "gitignore",
+}
+
+// languageInterpreters maps shebang interpreters to language tags
+var languageInterpreters = map[string]string{
+	"sh":      "sh",
+	"bash":    "bash",
+	"dash":    "sh",
+	"ksh":     "sh",
+	"zsh":     "zsh",
+	"fish":    "fish",
+	"python":  "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"php":     "php",
+	"lua":     "lua",
+	"rscript": "r",
+	"pwsh":    "powershell",
+	"awk":     "awk",
+	"tclsh":   "tcl",
+}
+
+// DetectLanguage returns the Markdown code block language tag for a file,
+// from its name, its extension or a #! line at the start of content, or ""
+// if the language isn't known
+func DetectLanguage(relPath, content string) string {
+	name := strings.ToLower(path.Base(relPath))
+	if lang, ok := languageFileNames[name]; ok {
+		return lang
+	}
+	if strings.HasPrefix(name, "dockerfile.") {
+		return "dockerfile"
+	}
+	if lang, ok := languageExtensions[path.Ext(name)]; ok {
+		return lang
+	}
+	return shebangLanguage(content)
+}
+
+// shebangLanguage returns the language of the interpreter named in a #!
+// line at the start of content, such as "python" for #!/usr/bin/env python3
+func shebangLanguage(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+	line, _, _ := strings.Cut(content[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env's options, such as -S, to get to the command
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+
+	// python3 and python3.12 are python
+	interpreter = strings.ToLower(strings.TrimRight(interpreter, "0123456789."))
+	return languageInterpreters[interpreter]
+}
+
+// CodeFence returns a backtick fence for a Markdown code block holding
+// content: three backticks, or one more than the longest run of backticks in
+// content, so no line of content can close the block early
+func CodeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		path     string
+		content  string
+		expected string
+	}{
+		{"main.go", "package main\n", "go"},
+		{"src/App.TSX", "", "tsx"},
+		{"lib/util.py", "", "python"},
+		{"docs/guide.md", "# Guide\n", "markdown"},
+		{"analysis.ipynb", "# Jupyter Notebook Content\n", "markdown"},
+		{"Dockerfile", "FROM alpine\n", "dockerfile"},
+		{"build/Dockerfile.dev", "FROM alpine\n", "dockerfile"},
+		{"Makefile", "all:\n", "makefile"},
+		{"CMakeLists.txt", "", "cmake"},
+		{"scripts/deploy", "#!/bin/bash\necho hi\n", "bash"},
+		{"bin/tool", "#!/usr/bin/env python3\n", "python"},
+		{"bin/serve", "#!/usr/bin/env -S node --no-warnings\n", "javascript"},
+		{"bin/run.sh", "#!/usr/bin/env python3\n", "bash"},
+		{"LICENSE", "MIT License\n", ""},
+		{"data.unknown", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if result := DetectLanguage(tc.path, tc.content); result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected string
+		desc     string
+	}{
+		{"package main\n", "```", "No backticks"},
+		{"Use `go test` and ``x``\n", "```", "Short runs"},
+		{"```go\ncode\n```\n", "````", "Fenced block"},
+		{"`````\n", "``````", "Long run"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := CodeFence(tc.content); result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/prashanth1k/gingest/internal/tokenizer"
 	"github.com/prashanth1k/gingest/internal/types"
 )
 
 // Package utils provides utility functions for file operations and processing
 
+// BinarySniffSize is the number of leading bytes checked for binary content
+const BinarySniffSize = 1024
+
 // ReadFileContent reads the content of a file and returns it as a string
 func ReadFileContent(filePath string) (string, error) {
 	content, err := os.ReadFile(filePath)
@@ -34,14 +38,22 @@ func IsBinaryFile(filePath string) (bool, error) {
 	defer file.Close()
 
 	// Read first 1024 bytes
-	chunk := make([]byte, 1024)
+	chunk := make([]byte, BinarySniffSize)
 	n, err := file.Read(chunk)
 	if err != nil && n == 0 {
 		return false, err
 	}
 
-	// Check for null bytes
-	return bytes.Contains(chunk[:n], []byte{0}), nil
+	return IsBinaryData(chunk[:n]), nil
+}
+
+// IsBinaryData reports whether the start of a file's content looks binary,
+// using the same null byte heuristic as IsBinaryFile
+func IsBinaryData(head []byte) bool {
+	if len(head) > BinarySniffSize {
+		head = head[:BinarySniffSize]
+	}
+	return bytes.Contains(head, []byte{0})
 }
 
 // IsReadmeFile checks if a filename is a README file (case-insensitive)
@@ -55,33 +67,151 @@ func GenerateSummaryString(stats types.Stats) string {
 	var summary strings.Builder
 
 	summary.WriteString("# Codebase Digest Summary\n\n")
+	summary.WriteString(GenerateSourceString(stats))
+	summary.WriteString(GenerateStatisticsString(stats))
+	summary.WriteString("---\n\n")
+
+	return summary.String()
+}
+
+// GenerateSourceString generates the source, branch and generation time lines of the summary
+func GenerateSourceString(stats types.Stats) string {
+	var summary strings.Builder
+
 	summary.WriteString(fmt.Sprintf("**Source:** %s\n", stats.Source))
 
 	if stats.Branch != "" {
 		summary.WriteString(fmt.Sprintf("**Branch:** %s\n", stats.Branch))
 	}
 
+	if stats.Ref != "" {
+		summary.WriteString(fmt.Sprintf("**Ref:** %s\n", stats.Ref))
+	}
+
+	if stats.Commit != "" {
+		summary.WriteString(fmt.Sprintf("**Commit:** %s\n", stats.Commit))
+	}
+
+	if stats.Diff != nil {
+		summary.WriteString(fmt.Sprintf("**Base:** %s (%s)\n", stats.Diff.Base, stats.Diff.BaseCommit))
+		summary.WriteString(fmt.Sprintf("**Head:** %s (%s)\n", stats.Diff.Head, stats.Diff.HeadCommit))
+	}
+
+	if stats.Subdir != "" {
+		summary.WriteString(fmt.Sprintf("**Subdirectory:** %s\n", stats.Subdir))
+	}
+
+	if stats.Order != "" {
+		summary.WriteString(fmt.Sprintf("**File Order:** %s\n", stats.Order))
+	}
+
 	summary.WriteString(fmt.Sprintf("**Generated:** %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
 
+	return summary.String()
+}
+
+// GenerateStatisticsString generates the statistics section of the summary
+func GenerateStatisticsString(stats types.Stats) string {
+	var summary strings.Builder
+
 	summary.WriteString("## Statistics\n\n")
+	if diff := stats.Diff; diff != nil {
+		summary.WriteString(fmt.Sprintf("- **Files Changed:** %d (%d added, %d modified, %d deleted, %d renamed)\n",
+			diff.FilesChanged, diff.FilesAdded, diff.FilesModified, diff.FilesDeleted, diff.FilesRenamed))
+		summary.WriteString(fmt.Sprintf("- **Lines Added:** %d\n", diff.LinesAdded))
+		summary.WriteString(fmt.Sprintf("- **Lines Removed:** %d\n", diff.LinesRemoved))
+		summary.WriteString(fmt.Sprintf("- **Binary Changes:** %d\n", diff.BinaryChanges))
+		if diff.RelatedFiles > 0 {
+			summary.WriteString(fmt.Sprintf("- **Related Files:** %d\n", diff.RelatedFiles))
+		}
+	}
 	summary.WriteString(fmt.Sprintf("- **Total Files:** %d\n", stats.NumFilesProcessed))
 	summary.WriteString(fmt.Sprintf("- **Directories:** %d\n", stats.NumDirsProcessed))
 	summary.WriteString(fmt.Sprintf("- **Binary Files:** %d\n", stats.NumBinaryFiles))
 	summary.WriteString(fmt.Sprintf("- **Skipped Files:** %d\n", stats.NumSkippedFiles))
-	summary.WriteString(fmt.Sprintf("- **Total Content Size:** %.2f KB\n\n", float64(stats.TotalContentBytes)/1024))
-
-	summary.WriteString("---\n\n")
+	summary.WriteString(fmt.Sprintf("- **Total Content Size:** %.2f KB\n", float64(stats.TotalContentBytes)/1024))
+	summary.WriteString(fmt.Sprintf("- **Estimated Tokens:** %d\n", stats.TotalTokens))
+	if stats.TokenBudget > 0 {
+		summary.WriteString(fmt.Sprintf("- **Token Budget:** %d (%d truncated, %d omitted)\n", stats.TokenBudget, stats.NumTruncatedFiles, stats.NumOmittedFiles))
+	}
+	if len(stats.Stripped) > 0 {
+		summary.WriteString(fmt.Sprintf("- **Stripped:** %s (%.2f KB, %d tokens saved)\n", strings.Join(stats.Stripped, " and "), float64(stats.SavedBytes)/1024, stats.SavedTokens))
+	}
+	if stats.TrackedOnly {
+		summary.WriteString(fmt.Sprintf("- **Untracked Files Skipped:** %d\n", stats.NumUntrackedFiles))
+	}
+	if len(stats.IgnoreFiles) > 0 {
+		summary.WriteString(fmt.Sprintf("- **Ignore Files:** %s\n", strings.Join(stats.IgnoreFiles, ", ")))
+	}
+	summary.WriteString("\n")
 
 	return summary.String()
 }
 
-// ParsePatterns parses a comma-separated string of patterns into a slice
+// maxHistoryFiles is the number of changed files listed per commit in the history section
+const maxHistoryFiles = 10
+
+// GenerateHistoryString generates the history section listing recent
+// commits, or "" if there are none
+func GenerateHistoryString(history []types.Commit) string {
+	if len(history) == 0 {
+		return ""
+	}
+
+	var section strings.Builder
+	section.WriteString("## History\n\n")
+	for _, commit := range history {
+		section.WriteString(fmt.Sprintf("- **%s** %s %s: %s\n", ShortSHA(commit.SHA), commit.Date.Format("2006-01-02"), commit.Author, commit.Subject))
+
+		files := commit.Files
+		more := ""
+		if len(files) > maxHistoryFiles {
+			more = fmt.Sprintf(" and %d more", len(files)-maxHistoryFiles)
+			files = files[:maxHistoryFiles]
+		}
+		section.WriteString(fmt.Sprintf("  Files: %s%s\n", strings.Join(files, ", "), more))
+	}
+	section.WriteString("\n---\n\n")
+
+	return section.String()
+}
+
+// FormatLastCommit describes the last commit to change a file for its
+// header, such as "2024-01-15 by Jane Doe (1a2b3c4: Fix the parser)"
+func FormatLastCommit(commit *types.Commit) string {
+	return fmt.Sprintf("%s by %s (%s: %s)", commit.Date.Format("2006-01-02"), commit.Author, ShortSHA(commit.SHA), commit.Subject)
+}
+
+// ShortSHA abbreviates a commit SHA to seven characters
+func ShortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// ParsePatterns parses a comma-separated string of patterns into a slice.
+// Commas inside {a,b} alternatives don't split patterns.
 func ParsePatterns(patternsString string) []string {
 	if patternsString == "" {
 		return nil
 	}
 
-	patterns := strings.Split(patternsString, ",")
+	var patterns []string
+	depth, start := 0, 0
+	for i, char := range patternsString {
+		switch {
+		case char == '{':
+			depth++
+		case char == '}' && depth > 0:
+			depth--
+		case char == ',' && depth == 0:
+			patterns = append(patterns, patternsString[start:i])
+			start = i + 1
+		}
+	}
+	patterns = append(patterns, patternsString[start:])
+
 	var result []string
 
 	for _, pattern := range patterns {
@@ -96,70 +226,46 @@ func ParsePatterns(patternsString string) []string {
 
 // ShouldIncludeFile determines if a file should be included based on include/exclude patterns
 func ShouldIncludeFile(relativePath string, includePatterns, excludePatterns []string) bool {
-	fileName := filepath.Base(relativePath)
+	return ShouldIncludePath(relativePath, false, includePatterns, excludePatterns)
+}
 
+// ShouldIncludePath determines if a file or directory should be included based
+// on include/exclude patterns. Patterns match the full path or the name, and
+// support "**", {a,b} and directory-only patterns with a trailing slash.
+// Include patterns never exclude a directory, so a walk still reaches the
+// nested files they match.
+func ShouldIncludePath(relativePath string, isDir bool, includePatterns, excludePatterns []string) bool {
 	// Check exclude patterns first
 	for _, pattern := range excludePatterns {
-		// Check against full path
-		if matched, _ := filepath.Match(pattern, relativePath); matched {
-			// Check if include patterns override the exclusion
-			if len(includePatterns) > 0 {
-				for _, includePattern := range includePatterns {
-					if matched, _ := filepath.Match(includePattern, relativePath); matched {
-						return true // Include pattern overrides exclude
-					}
-					if matched, _ := filepath.Match(includePattern, fileName); matched {
-						return true // Include pattern overrides exclude
-					}
-				}
-			}
-			return false // Excluded and no include override
-		}
-
-		// Check against filename only
-		if matched, _ := filepath.Match(pattern, fileName); matched {
-			// Check if include patterns override the exclusion
-			if len(includePatterns) > 0 {
-				for _, includePattern := range includePatterns {
-					if matched, _ := filepath.Match(includePattern, relativePath); matched {
-						return true // Include pattern overrides exclude
-					}
-					if matched, _ := filepath.Match(includePattern, fileName); matched {
-						return true // Include pattern overrides exclude
-					}
-				}
-			}
-			return false // Excluded and no include override
+		if matchPath(pattern, relativePath, isDir) {
+			// Include patterns override the exclusion
+			return matchesAnyInclude(includePatterns, relativePath, isDir)
 		}
 
 		// Also check if any parent directory matches exclude pattern
-		dir := filepath.Dir(relativePath)
-		for dir != "." && dir != "/" {
-			if matched, _ := filepath.Match(pattern, filepath.Base(dir)); matched {
-				return false
-			}
-			dir = filepath.Dir(dir)
+		if matchParent(pattern, relativePath) {
+			return false
 		}
 	}
 
 	// If include patterns are specified, file must match at least one
-	if len(includePatterns) > 0 {
-		for _, pattern := range includePatterns {
-			// Check against full path
-			if matched, _ := filepath.Match(pattern, relativePath); matched {
-				return true
-			}
-			// Check against filename only
-			if matched, _ := filepath.Match(pattern, fileName); matched {
-				return true
-			}
-		}
-		return false // Doesn't match any include pattern
+	if len(includePatterns) > 0 && !isDir {
+		return matchesAnyInclude(includePatterns, relativePath, isDir)
 	}
 
 	return true // No exclusion and no include restriction
 }
 
+// matchesAnyInclude reports whether any include pattern selects relPath
+func matchesAnyInclude(includePatterns []string, relPath string, isDir bool) bool {
+	for _, pattern := range includePatterns {
+		if matchInclude(pattern, relPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
 // GenerateTreeString creates a tree representation of file and directory paths
 func GenerateTreeString(paths []string, rootName string, filesData []types.FileInfo) string {
 	if len(paths) == 0 {
@@ -239,10 +345,31 @@ func GenerateTreeString(paths []string, rootName string, filesData []types.FileI
 		// Add file with appropriate suffix
 		suffix := ""
 		if fileInfo, exists := fileInfoMap[path]; exists {
-			if fileInfo.IsBinary {
-				suffix = " (Binary)"
-			} else if strings.Contains(fileInfo.Content, "[File content skipped:") {
-				suffix = " (Skipped - Too Large)"
+			var notes []string
+			if fileInfo.Change != nil {
+				notes = append(notes, FormatChange(fileInfo.Change))
+			} else if fileInfo.Related {
+				notes = append(notes, "related")
+			}
+
+			// A binary change already says it is binary, and has no tokens to count
+			binary := fileInfo.IsBinary || fileInfo.Change != nil && fileInfo.Change.Binary
+			if fileInfo.Omitted {
+				notes = append(notes, "Omitted")
+			} else if binary {
+				if fileInfo.Change == nil {
+					notes = append(notes, "Binary")
+				}
+			} else if fileInfo.SkipReason == types.SkipReasonTooLarge {
+				notes = append(notes, "Skipped - Too Large")
+			} else if fileInfo.Truncated {
+				notes = append(notes, "Truncated, "+tokenizer.Format(fileInfo.Tokens))
+			} else if fileInfo.Tokens > 0 {
+				notes = append(notes, tokenizer.Format(fileInfo.Tokens))
+			}
+
+			if len(notes) > 0 {
+				suffix = " (" + strings.Join(notes, ", ") + ")"
 			}
 		}
 
@@ -256,6 +383,55 @@ func GenerateTreeString(paths []string, rootName string, filesData []types.FileI
 	return tree.String()
 }
 
+// FormatChange describes a file change for tree annotations and diff headers,
+// such as "modified, +3 -1" or "renamed from old.go, +0 -0"
+func FormatChange(change *types.FileChange) string {
+	description := change.Status
+	if change.OldPath != "" {
+		description += " from " + change.OldPath
+	}
+	if change.Binary {
+		return description + ", binary"
+	}
+	return fmt.Sprintf("%s, +%d -%d", description, change.Additions, change.Deletions)
+}
+
+// NumberLines prefixes each line of content with its 1-based line number,
+// right-aligned to the widest number, as in "  7 | return nil". A missing
+// final newline stays missing.
+func NumberLines(content string) string {
+	return NumberLinesAt(content, nil)
+}
+
+// NumberLinesAt numbers the lines of content like NumberLines, but with the
+// line numbers in numbers, such as the original numbers of the lines left by
+// StripComments. Nil numbers count from 1.
+func NumberLinesAt(content string, numbers []int) string {
+	if content == "" {
+		return ""
+	}
+
+	lines := splitLines(content)
+	number := func(i int) int {
+		if numbers == nil {
+			return i + 1
+		}
+		return numbers[i]
+	}
+	width := len(strconv.Itoa(number(len(lines) - 1)))
+
+	var numbered strings.Builder
+	numbered.Grow(len(content) + len(lines)*(width+3))
+	for i, line := range lines {
+		if line == "\n" || line == "" {
+			numbered.WriteString(fmt.Sprintf("%*d |%s", width, number(i), line))
+			continue
+		}
+		numbered.WriteString(fmt.Sprintf("%*d | %s", width, number(i), line))
+	}
+	return numbered.String()
+}
+
 // IsJupyterNotebook checks if a file is a Jupyter notebook by extension
 func IsJupyterNotebook(filePath string) bool {
 	return strings.HasSuffix(strings.ToLower(filePath), ".ipynb")
@@ -3,7 +3,11 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prashanth1k/gingest/internal/types"
 )
 
 func TestReadFileContent(t *testing.T) {
@@ -53,6 +57,7 @@ func TestIsGitURL(t *testing.T) {
 		{"git@github.com:user/repo.git", true, "SSH Git URL"},
 		{"https://example.com/repo.git", true, "Generic Git URL with .git suffix"},
 		{"https://github.com/user/repo", true, "GitHub URL without .git"},
+		{"https://gitea.example.com/user/repo/src/branch/main", true, "Gitea web URL"},
 		{"/local/path", false, "Local path"},
 		{"./relative/path", false, "Relative path"},
 		{"https://example.com/page", false, "Regular HTTPS URL"},
@@ -69,3 +74,202 @@ func TestIsGitURL(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateTreeString_Annotations(t *testing.T) {
+	paths := []string{"big.txt", "image.bin", "src/main.go"}
+	filesData := []types.FileInfo{
+		{RelativePath: "big.txt", SkipReason: types.SkipReasonTooLarge, Tokens: 12},
+		{RelativePath: "image.bin", IsBinary: true, SkipReason: types.SkipReasonBinary, Tokens: 3},
+		{RelativePath: "src/main.go", Tokens: 1234},
+	}
+
+	tree := GenerateTreeString(paths, "project", filesData)
+
+	expected := []string{
+		"big.txt (Skipped - Too Large)",
+		"image.bin (Binary)",
+		"main.go (1.2k tokens)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(tree, line) {
+			t.Errorf("Expected %q in tree:\n%s", line, tree)
+		}
+	}
+}
+
+func TestGenerateSummaryString_Tokens(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "project", TotalTokens: 4321})
+	if !strings.Contains(summary, "**Estimated Tokens:** 4321") {
+		t.Errorf("Expected token total in summary:\n%s", summary)
+	}
+}
+
+func TestGenerateSummaryString_IgnoreFiles(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "project"})
+	if strings.Contains(summary, "Ignore Files") {
+		t.Errorf("Expected no ignore files line without ignore files:\n%s", summary)
+	}
+
+	summary = GenerateSummaryString(types.Stats{Source: "project", IgnoreFiles: []string{".gitignore", "pkg/.gingestignore"}})
+	if !strings.Contains(summary, "**Ignore Files:** .gitignore, pkg/.gingestignore") {
+		t.Errorf("Expected ignore files in summary:\n%s", summary)
+	}
+}
+
+func TestGenerateSummaryString_Commit(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "repo.git", Ref: "v1.0", Commit: "0123456789abcdef0123456789abcdef01234567"})
+	for _, expected := range []string{"**Ref:** v1.0\n", "**Commit:** 0123456789abcdef0123456789abcdef01234567\n"} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("Expected %q in summary:\n%s", expected, summary)
+		}
+	}
+
+	summary = GenerateSummaryString(types.Stats{Source: "project"})
+	if strings.Contains(summary, "**Ref:**") || strings.Contains(summary, "**Commit:**") {
+		t.Errorf("Expected no ref or commit lines for a local source:\n%s", summary)
+	}
+}
+
+func TestGenerateSummaryString_TrackedOnly(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "project", TrackedOnly: true, NumUntrackedFiles: 3})
+	if !strings.Contains(summary, "**Untracked Files Skipped:** 3\n") {
+		t.Errorf("Expected untracked file count in summary:\n%s", summary)
+	}
+
+	summary = GenerateSummaryString(types.Stats{Source: "project"})
+	if strings.Contains(summary, "Untracked") {
+		t.Errorf("Expected no untracked file count without tracked-only mode:\n%s", summary)
+	}
+}
+
+func TestGenerateSummaryString_Stripped(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "project", Stripped: []string{"comments", "whitespace"}, SavedBytes: 2048, SavedTokens: 500})
+	if !strings.Contains(summary, "**Stripped:** comments and whitespace (2.00 KB, 500 tokens saved)\n") {
+		t.Errorf("Expected savings in summary:\n%s", summary)
+	}
+
+	summary = GenerateSummaryString(types.Stats{Source: "project"})
+	if strings.Contains(summary, "Stripped") {
+		t.Errorf("Expected no savings without stripping:\n%s", summary)
+	}
+}
+
+func TestFormatChange(t *testing.T) {
+	testCases := []struct {
+		change   types.FileChange
+		expected string
+		desc     string
+	}{
+		{types.FileChange{Status: types.ChangeModified, Additions: 3, Deletions: 1}, "modified, +3 -1", "Modified file"},
+		{types.FileChange{Status: types.ChangeDeleted, Deletions: 30}, "deleted, +0 -30", "Deleted file"},
+		{types.FileChange{Status: types.ChangeRenamed, OldPath: "old.go"}, "renamed from old.go, +0 -0", "Renamed file"},
+		{types.FileChange{Status: types.ChangeAdded, Binary: true}, "added, binary", "Binary file"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := FormatChange(&tc.change); result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGenerateHistoryString(t *testing.T) {
+	if history := GenerateHistoryString(nil); history != "" {
+		t.Errorf("Expected no section without history, got %q", history)
+	}
+
+	date := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	files := []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go", "g.go", "h.go", "i.go", "j.go", "k.go", "l.go"}
+	history := GenerateHistoryString([]types.Commit{
+		{SHA: "1a2b3c4d5e6f", Author: "Jane Doe", Date: date, Subject: "Fix the parser", Files: []string{"parser.go"}},
+		{SHA: "abcdef0123", Author: "John Roe", Date: date.AddDate(0, 0, -1), Subject: "Reformat", Files: files},
+	})
+
+	expected := "## History\n\n" +
+		"- **1a2b3c4** 2024-01-15 Jane Doe: Fix the parser\n  Files: parser.go\n" +
+		"- **abcdef0** 2024-01-14 John Roe: Reformat\n  Files: a.go, b.go, c.go, d.go, e.go, f.go, g.go, h.go, i.go, j.go and 2 more\n" +
+		"\n---\n\n"
+	if history != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, history)
+	}
+}
+
+func TestFormatLastCommit(t *testing.T) {
+	commit := &types.Commit{SHA: "1a2b3c4d5e6f", Author: "Jane Doe", Date: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), Subject: "Fix the parser"}
+	expected := "2024-01-15 by Jane Doe (1a2b3c4: Fix the parser)"
+	if result := FormatLastCommit(commit); result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestNumberLines(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected string
+		desc     string
+	}{
+		{"", "", "Empty"},
+		{"package main\n", "1 | package main\n", "Single line"},
+		{"a\n\nb", "1 | a\n2 |\n3 | b", "No final newline"},
+		{strings.Repeat("x\n", 10), " 1 | x\n 2 | x\n 3 | x\n 4 | x\n 5 | x\n 6 | x\n 7 | x\n 8 | x\n 9 | x\n10 | x\n", "Aligned"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if result := NumberLines(tc.content); result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGenerateTreeString_Changes(t *testing.T) {
+	paths := []string{"image.png", "main.go", "old.txt", "util.go"}
+	filesData := []types.FileInfo{
+		{RelativePath: "image.png", IsBinary: true, Tokens: 4, Change: &types.FileChange{Status: types.ChangeModified, Binary: true}},
+		{RelativePath: "main.go", Tokens: 10, Related: true},
+		{RelativePath: "old.txt", Change: &types.FileChange{Status: types.ChangeDeleted, Deletions: 2}},
+		{RelativePath: "util.go", Tokens: 1234, Change: &types.FileChange{Status: types.ChangeModified, Additions: 3, Deletions: 1}},
+	}
+
+	tree := GenerateTreeString(paths, "project", filesData)
+
+	expected := []string{
+		"image.png (modified, binary)\n",
+		"main.go (related, 10 tokens)\n",
+		"old.txt (deleted, +0 -2)\n",
+		"util.go (modified, +3 -1, 1.2k tokens)\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(tree, line) {
+			t.Errorf("Expected %q in tree:\n%s", line, tree)
+		}
+	}
+}
+
+func TestGenerateSummaryString_Diff(t *testing.T) {
+	summary := GenerateSummaryString(types.Stats{Source: "project", Diff: &types.DiffStats{
+		Base: "main", BaseCommit: "abc", Head: "HEAD", HeadCommit: "def",
+		FilesChanged: 4, FilesAdded: 1, FilesModified: 1, FilesDeleted: 1, FilesRenamed: 1,
+		LinesAdded: 12, LinesRemoved: 5, RelatedFiles: 2,
+	}})
+	for _, expected := range []string{
+		"**Base:** main (abc)\n",
+		"**Head:** HEAD (def)\n",
+		"**Files Changed:** 4 (1 added, 1 modified, 1 deleted, 1 renamed)\n",
+		"**Lines Added:** 12\n",
+		"**Lines Removed:** 5\n",
+		"**Related Files:** 2\n",
+	} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("Expected %q in summary:\n%s", expected, summary)
+		}
+	}
+
+	summary = GenerateSummaryString(types.Stats{Source: "project"})
+	if strings.Contains(summary, "Files Changed") {
+		t.Errorf("Expected no diff statistics outside diff digests:\n%s", summary)
+	}
+}